@@ -0,0 +1,137 @@
+// Package cluster coordinates backend instances that share one database.
+// One instance at a time holds a Postgres advisory lock and leads: it runs
+// the jobs that must only happen once (station playout, listener stats,
+// reaction batches and analytics rollups). The others serve requests and
+// send commands for those jobs to the leader through the websocket bus.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"groovegarden/database"
+)
+
+const (
+	// leaderLock is the advisory lock key the leader holds
+	leaderLock = 0x67726f6f7665 // "groove"
+	// electionInterval is how often followers try to take over and the
+	// leader checks that its lock connection is still alive
+	electionInterval = 5 * time.Second
+	// lockTimeout bounds each attempt to take or check the lock
+	lockTimeout = 5 * time.Second
+)
+
+// Instance tells this process's rows apart from other instances'
+var Instance = newInstance()
+
+var (
+	leading atomic.Bool
+	// lockConn holds the advisory lock; it is released if the connection drops
+	lockConn *sql.Conn
+
+	handlers   []func(leading bool)
+	handlersMu sync.Mutex
+)
+
+func newInstance() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsLeader reports whether this instance runs the singleton jobs
+func IsLeader() bool {
+	return leading.Load()
+}
+
+// OnLeadership registers a handler called with true when this instance
+// becomes the leader and with false when it stops being it
+func OnLeadership(handler func(leading bool)) {
+	handlersMu.Lock()
+	handlers = append(handlers, handler)
+	handlersMu.Unlock()
+}
+
+// Start runs a first election, so a lone instance leads before it serves
+// requests, then keeps holding or waiting for the lock in the background
+func Start() {
+	elect()
+	go func() {
+		ticker := time.NewTicker(electionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			elect()
+		}
+	}()
+}
+
+// elect takes the lock when nobody holds it, or checks the leader still does
+func elect() {
+	if lockConn != nil {
+		if err := checkLock(); err != nil {
+			log.Printf("Warning: lost the leader lock: %v", err)
+			lockConn.Close()
+			lockConn = nil
+			setLeading(false)
+		}
+		return
+	}
+
+	conn, err := tryLock()
+	if err != nil {
+		log.Printf("Warning: leader election failed: %v", err)
+		return
+	}
+	if conn != nil {
+		lockConn = conn
+		log.Printf("Instance %s is now the leader", Instance)
+		setLeading(true)
+	}
+}
+
+// tryLock takes the leader lock on a dedicated connection, returning nil if
+// another instance holds it
+func tryLock() (*sql.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	conn, err := database.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", leaderLock).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// checkLock makes sure the lock connection (and so the lock) is still alive
+func checkLock() error {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	_, err := lockConn.ExecContext(ctx, "SELECT 1")
+	return err
+}
+
+func setLeading(value bool) {
+	leading.Store(value)
+
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(value)
+	}
+}
@@ -112,6 +112,11 @@ func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The first login of the day earns credits
+	if _, err := awardDailyLogin(userID); err != nil {
+		log.Printf("Warning: could not award daily credits to user %d: %v", userID, err)
+	}
+
 	// Use the role fetched or updated in the database
 	role := user["account_type"].(string)
 
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+const (
+	// maxChatLength caps chat messages, in characters
+	maxChatLength = 500
+	// chatRateLimit messages per chatRateWindow are allowed from each user
+	chatRateLimit  = 5
+	chatRateWindow = 10 * time.Second
+	// maxChatReasonLength caps the reason given for a mute or ban
+	maxChatReasonLength = 280
+	// maxRestrictionMinutes caps a timed mute or ban at a year; 0 is permanent
+	maxRestrictionMinutes = 525600
+)
+
+var (
+	errEmptyChat       = errors.New("message text is required")
+	errChatTooLong     = fmt.Errorf("messages are limited to %d characters", maxChatLength)
+	errChatRateLimited = errors.New("you are sending messages too quickly, wait a few seconds")
+)
+
+// chatRestrictedError is returned when a muted or banned user posts
+type chatRestrictedError struct {
+	restriction models.ChatRestriction
+}
+
+func (e chatRestrictedError) Error() string {
+	verb := "muted"
+	if e.restriction.Kind == database.ChatBan {
+		verb = "banned"
+	}
+	if e.restriction.ExpiresAt != nil {
+		return fmt.Sprintf("you are %s from this station's chat until %s", verb, e.restriction.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("you are %s from this station's chat", verb)
+}
+
+// ChatRejection is returned by a ChatFilter to refuse a message; the sender
+// sees it as the reason
+type ChatRejection string
+
+func (r ChatRejection) Error() string { return string(r) }
+
+// ChatFilter checks a chat message before it is posted. It returns the text
+// to post, which it may rewrite, or a ChatRejection to refuse the message.
+type ChatFilter func(stationID, userID int, text string) (string, error)
+
+var (
+	chatFiltersMu sync.RWMutex
+	// CHAT_BLOCKED_WORDS (comma separated) are masked out of messages
+	chatFilters = []ChatFilter{blockedWordsFilter(os.Getenv("CHAT_BLOCKED_WORDS"))}
+)
+
+// AddChatFilter adds a filter run on every chat message, after those already added
+func AddChatFilter(filter ChatFilter) {
+	chatFiltersMu.Lock()
+	defer chatFiltersMu.Unlock()
+	chatFilters = append(chatFilters, filter)
+}
+
+// blockedWordsFilter masks whole-word, case-insensitive matches of a comma
+// separated word list with asterisks
+func blockedWordsFilter(list string) ChatFilter {
+	words := []string{}
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	if len(words) == 0 {
+		return func(stationID, userID int, text string) (string, error) { return text, nil }
+	}
+
+	blocked := regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	return func(stationID, userID int, text string) (string, error) {
+		return blocked.ReplaceAllStringFunc(text, func(word string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(word))
+		}), nil
+	}
+}
+
+// postChatMessage checks, stores and sends a listener's message to everyone
+// tuned to a station
+func postChatMessage(stationID, userID int, text string) (models.ChatMessage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return models.ChatMessage{}, errEmptyChat
+	}
+	if utf8.RuneCountInString(text) > maxChatLength {
+		return models.ChatMessage{}, errChatTooLong
+	}
+	// The limit counts messages across all stations and instances
+	allowed, err := database.RecordChatSend(userID, chatRateLimit, chatRateWindow)
+	if err != nil {
+		return models.ChatMessage{}, err
+	} else if !allowed {
+		return models.ChatMessage{}, errChatRateLimited
+	}
+
+	restriction, err := database.ActiveChatRestriction(stationID, userID)
+	if err == nil {
+		return models.ChatMessage{}, chatRestrictedError{restriction}
+	} else if err != sql.ErrNoRows {
+		return models.ChatMessage{}, err
+	}
+
+	chatFiltersMu.RLock()
+	filters := chatFilters
+	chatFiltersMu.RUnlock()
+	for _, filter := range filters {
+		if text, err = filter(stationID, userID, text); err != nil {
+			return models.ChatMessage{}, err
+		}
+	}
+	if text = strings.TrimSpace(text); text == "" {
+		return models.ChatMessage{}, errEmptyChat
+	}
+
+	msg := models.ChatMessage{StationID: stationID, UserID: userID, Text: text}
+	if err := database.InsertChatMessage(&msg); err != nil {
+		return msg, err
+	}
+
+	websocket.NotifyTopic(websocket.StationTopic(stationID), websocket.EventChatMessage, msg)
+	return msg, nil
+}
+
+// GetStationChat returns a station's chat scrollback, oldest first. Pass
+// ?before=<message id> to page further back.
+func GetStationChat(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	var before int64
+	if value := r.URL.Query().Get("before"); value != "" {
+		var err error
+		if before, err = strconv.ParseInt(value, 10, 64); err != nil || before <= 0 {
+			http.Error(w, "Invalid before message ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	messages, err := database.ListChatMessages(station.ID, before, parseLimit(r, 50, 200))
+	if err != nil {
+		log.Printf("Error listing chat on station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch chat", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, messages)
+}
+
+// PostChatMessage posts to a station's chat over HTTP, for clients following
+// events without a websocket
+func PostChatMessage(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := postChatMessage(station.ID, userID, req.Text)
+	if err != nil {
+		var rejection ChatRejection
+		var restricted chatRestrictedError
+		switch {
+		case err == errEmptyChat, err == errChatTooLong, errors.As(err, &rejection):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.As(err, &restricted):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case err == errChatRateLimited:
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		default:
+			log.Printf("Error posting chat on station %d: %v", station.ID, err)
+			http.Error(w, "Failed to post message", http.StatusInternalServerError)
+		}
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, msg)
+}
+
+// DeleteChatMessage removes a message from a station's chat (admin only)
+func DeleteChatMessage(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID format", http.StatusBadRequest)
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	err = database.DeleteChatMessage(station.ID, messageID, adminID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error deleting chat message %d on station %d: %v", messageID, station.ID, err)
+		http.Error(w, "Failed to delete message", http.StatusInternalServerError)
+		return
+	}
+
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventChatDeleted, websocket.ChatDeleted{
+		StationID:  station.ID,
+		MessageIDs: []int64{messageID},
+	})
+	render.JSON(w, r, map[string]string{"message": "Chat message deleted"})
+}
+
+// GetChatRestrictions lists who is muted or banned from a station's chat (admin only)
+func GetChatRestrictions(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	restrictions, err := database.ListChatRestrictions(station.ID)
+	if err != nil {
+		log.Printf("Error listing chat restrictions on station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch chat restrictions", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, restrictions)
+}
+
+// RestrictChatUser mutes or bans a user from a station's chat for a number
+// of minutes, or indefinitely when minutes is 0 (admin only). Banning also
+// removes the user's messages.
+func RestrictChatUser(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	var req struct {
+		Kind    string `json:"kind"`
+		Minutes int    `json:"minutes"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Kind != database.ChatMute && req.Kind != database.ChatBan {
+		http.Error(w, "kind must be 'mute' or 'ban'", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes < 0 {
+		http.Error(w, "minutes can't be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes > maxRestrictionMinutes {
+		http.Error(w, fmt.Sprintf("minutes can't be more than %d, use 0 for a permanent restriction", maxRestrictionMinutes), http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(req.Reason) > maxChatReasonLength {
+		http.Error(w, fmt.Sprintf("Reasons are limited to %d characters", maxChatReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	restriction, err := database.SetChatRestriction(station.ID, userID, req.Kind, req.Reason,
+		time.Duration(req.Minutes)*time.Minute, adminID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error restricting user %d on station %d chat: %v", userID, station.ID, err)
+		http.Error(w, "Failed to restrict user", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Kind == database.ChatBan {
+		deleted, err := database.DeleteUserChatMessages(station.ID, userID, adminID)
+		if err != nil {
+			log.Printf("Warning: failed to remove banned user %d's messages on station %d: %v", userID, station.ID, err)
+		} else if len(deleted) > 0 {
+			websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventChatDeleted, websocket.ChatDeleted{
+				StationID:  station.ID,
+				MessageIDs: deleted,
+			})
+		}
+	}
+
+	log.Printf("Station %d: user %d chat %s by admin %d (%d minutes)", station.ID, userID, req.Kind, adminID, req.Minutes)
+	websocket.NotifyUser(userID, websocket.EventYourChatRestricted, restriction)
+	render.JSON(w, r, restriction)
+}
+
+// LiftChatRestriction unmutes or unbans a user on a station's chat (admin only)
+func LiftChatRestriction(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	err = database.LiftChatRestriction(station.ID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User is not restricted", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error lifting chat restriction for user %d on station %d: %v", userID, station.ID, err)
+		http.Error(w, "Failed to lift restriction", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Chat restriction lifted"})
+}
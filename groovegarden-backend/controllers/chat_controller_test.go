@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestChatRateLimitHoldsUnderConcurrentMessages(t *testing.T) {
+	openTestDB(t)
+	stationID := createTestStation(t)
+	userID := createTestUser(t)
+
+	const messages = 2 * chatRateLimit
+	errs := make(chan error, messages)
+	var wg sync.WaitGroup
+	for i := 0; i < messages; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := postChatMessage(stationID, userID, "hello")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	posted := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			posted++
+		case errChatRateLimited:
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if posted != chatRateLimit {
+		t.Errorf("%d messages posted, want %d", posted, chatRateLimit)
+	}
+
+	// The limit follows the user to other stations
+	if _, err := postChatMessage(createTestStation(t), userID, "hello"); err != errChatRateLimited {
+		t.Errorf("message on another station: got %v, want %v", err, errChatRateLimited)
+	}
+}
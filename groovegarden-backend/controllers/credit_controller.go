@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/playout"
+)
+
+// Credit earning and spending rules
+const (
+	dailyLoginCredits = 10
+	listeningCredits  = 2 // Earned per listeningPeriod tuned in
+	listeningPeriod   = 15 * time.Minute
+	listeningMaxGap   = 2 * time.Minute // Longer gaps between heartbeats don't count as listening
+	voteBoostCost     = 5               // Per extra unit of vote weight
+	maxVoteBoost      = 10
+	queueJumpCost     = 100
+	maxGrantAmount    = 100000
+)
+
+// parseBoost reads the optional ?boost= extra vote weight
+func parseBoost(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("boost")
+	if value == "" {
+		return 0, nil
+	}
+	boost, err := strconv.Atoi(value)
+	if err != nil || boost < 0 || boost > maxVoteBoost {
+		return 0, fmt.Errorf("boost must be between 0 and %d", maxVoteBoost)
+	}
+	return boost, nil
+}
+
+// GetMyCredits returns the caller's balance and latest transactions (?limit=)
+func GetMyCredits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+	renderCreditAccount(w, r, userID)
+}
+
+// GetUserCredits returns any user's balance and latest transactions (admin only)
+func GetUserCredits(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+	renderCreditAccount(w, r, userID)
+}
+
+func renderCreditAccount(w http.ResponseWriter, r *http.Request, userID int) {
+	balance, err := database.CreditBalance(database.DB, userID)
+	if err != nil {
+		log.Printf("Error reading credit balance for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch credits", http.StatusInternalServerError)
+		return
+	}
+	transactions, err := database.ListCreditTransactions(userID, parseLimit(r, 50, 500))
+	if err != nil {
+		log.Printf("Error listing credit transactions for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch credits", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, models.CreditAccount{UserID: userID, Balance: balance, Transactions: transactions})
+}
+
+// ClaimDailyCredits awards the caller's daily login credits, once per UTC day
+func ClaimDailyCredits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	awarded, err := awardDailyLogin(userID)
+	if err != nil {
+		log.Printf("Error awarding daily credits to user %d: %v", userID, err)
+		http.Error(w, "Failed to award credits", http.StatusInternalServerError)
+		return
+	}
+	if !awarded {
+		http.Error(w, "Daily credits already claimed today", http.StatusConflict)
+		return
+	}
+	renderCreditAccount(w, r, userID)
+}
+
+// awardDailyLogin credits a user's first login of the day and reports whether it did
+func awardDailyLogin(userID int) (bool, error) {
+	id, err := database.AddCredits(database.DB, models.CreditTransaction{
+		UserID: userID,
+		Amount: dailyLoginCredits,
+		Kind:   database.CreditDailyLogin,
+	}, fmt.Sprintf("daily_login:%d:%s", userID, time.Now().UTC().Format("2006-01-02")))
+	return id != 0, err
+}
+
+// RecordListening is the player's heartbeat while tuned in to a station. Time
+// between heartbeats (up to listeningMaxGap) adds up, and every full
+// listeningPeriod earns listeningCredits. Heartbeats only count while the
+// user also has a live connection subscribed to the station (its presence),
+// so a script posting heartbeats alone earns nothing.
+func RecordListening(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		StationID int `json:"station_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.StationID == 0 {
+		http.Error(w, "A station_id is required", http.StatusBadRequest)
+		return
+	}
+	if !playout.IsRunning(req.StationID) {
+		http.Error(w, "Station is not on air", http.StatusConflict)
+		return
+	}
+	present, err := database.IsPresent(req.StationID, userID)
+	if err != nil {
+		log.Printf("Error checking presence of user %d on station %d: %v", userID, req.StationID, err)
+		http.Error(w, "Failed to record listening", http.StatusInternalServerError)
+		return
+	}
+	if !present {
+		http.Error(w, "Connect to the station's live updates to earn listening credits", http.StatusConflict)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to record listening", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Switching stations starts counting again from this heartbeat
+	var seconds int
+	err = tx.QueryRow(`
+		INSERT INTO credit_listening (user_id, station_id, last_heartbeat) VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			seconds = credit_listening.seconds + CASE
+				WHEN credit_listening.station_id = EXCLUDED.station_id
+				THEN LEAST(EXTRACT(EPOCH FROM NOW() - credit_listening.last_heartbeat), $3)::INTEGER
+				ELSE 0 END,
+			station_id = EXCLUDED.station_id,
+			last_heartbeat = NOW()
+		RETURNING seconds
+	`, userID, req.StationID, int(listeningMaxGap.Seconds())).Scan(&seconds)
+	if err != nil {
+		log.Printf("Error recording listening for user %d: %v", userID, err)
+		http.Error(w, "Failed to record listening", http.StatusInternalServerError)
+		return
+	}
+
+	earned := 0
+	if periods := seconds / int(listeningPeriod.Seconds()); periods > 0 {
+		earned = periods * listeningCredits
+		_, err = tx.Exec("UPDATE credit_listening SET seconds = seconds - $1 WHERE user_id = $2",
+			periods*int(listeningPeriod.Seconds()), userID)
+		if err == nil {
+			_, err = database.AddCredits(tx, models.CreditTransaction{
+				UserID:    userID,
+				Amount:    earned,
+				Kind:      database.CreditListening,
+				StationID: &req.StationID,
+			}, "")
+		}
+		if err != nil {
+			log.Printf("Error awarding listening credits to user %d: %v", userID, err)
+			http.Error(w, "Failed to record listening", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to record listening", http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"earned":          earned,
+		"pending_seconds": seconds % int(listeningPeriod.Seconds()),
+	})
+}
+
+// JumpQueue puts a song at the front of a station's queue for queueJumpCost credits
+func JumpQueue(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		SongID int `json:"song_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SongID == 0 {
+		http.Error(w, "A song_id is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to queue song", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var inPool, playedRecently bool
+	err = tx.QueryRow(`
+		SELECT `+database.StationPoolFilter+`, `+database.RecentlyPlayed+`
+		FROM songs s JOIN stations st ON st.id = $1
+		WHERE s.id = $2
+	`, station.ID, req.SongID).Scan(&inPool, &playedRecently)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking queue jump for song %d on station %d: %v", req.SongID, station.ID, err)
+		http.Error(w, "Failed to queue song", http.StatusInternalServerError)
+		return
+	}
+	if !inPool {
+		http.Error(w, errNotInPool.Error(), http.StatusBadRequest)
+		return
+	}
+	// Don't charge for a jump that would wait out the repeat window in the queue
+	if playedRecently {
+		http.Error(w, "This song played recently, queue it again later", http.StatusConflict)
+		return
+	}
+
+	_, err = database.SpendCredits(tx, models.CreditTransaction{
+		UserID:    userID,
+		Amount:    queueJumpCost,
+		Kind:      database.CreditQueueJump,
+		StationID: &station.ID,
+		SongID:    &req.SongID,
+	})
+	if err == database.ErrInsufficientCredits {
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	} else if err != nil {
+		log.Printf("Error charging queue jump for user %d: %v", userID, err)
+		http.Error(w, "Failed to queue song", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO station_queue (station_id, song_id, source, added_by, priority) VALUES ($1, $2, 'jump', $3, 1)",
+		station.ID, req.SongID, userID,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error queueing jump for song %d on station %d: %v", req.SongID, station.ID, err)
+		http.Error(w, "Failed to queue song", http.StatusInternalServerError)
+		return
+	}
+
+	notifyQueueUpdated(station.ID)
+	render.JSON(w, r, map[string]string{"message": "Song moved to the front of the queue"})
+}
+
+// GrantCredits adds credits to a user's balance (admin only)
+func GrantCredits(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	var req struct {
+		Amount int    `json:"amount"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 || req.Amount > maxGrantAmount {
+		http.Error(w, fmt.Sprintf("amount must be between 1 and %d", maxGrantAmount), http.StatusBadRequest)
+		return
+	}
+
+	_, err = database.AddCredits(database.DB, models.CreditTransaction{
+		UserID:    userID,
+		Amount:    req.Amount,
+		Kind:      database.CreditGrant,
+		Note:      req.Note,
+		CreatedBy: &adminID,
+	}, "")
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error granting credits to user %d: %v", userID, err)
+		http.Error(w, "Failed to grant credits", http.StatusInternalServerError)
+		return
+	}
+	renderCreditAccount(w, r, userID)
+}
+
+// RefundCredits reverses a spend (admin only). A transaction can only be refunded once.
+func RefundCredits(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.ParseInt(chi.URLParam(r, "transactionID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID format", http.StatusBadRequest)
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	spend, err := database.ScanCreditTransaction(database.DB.QueryRow(`
+		SELECT id, user_id, amount, kind, station_id, song_id, ref_id, note, created_by, created_at
+		FROM credit_transactions WHERE id = $1
+	`, transactionID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+	if spend.Amount >= 0 {
+		http.Error(w, "Only spends can be refunded", http.StatusBadRequest)
+		return
+	}
+
+	id, err := database.AddCredits(database.DB, models.CreditTransaction{
+		UserID:    spend.UserID,
+		Amount:    -spend.Amount,
+		Kind:      database.CreditRefund,
+		StationID: spend.StationID,
+		SongID:    spend.SongID,
+		RefID:     &spend.ID,
+		Note:      req.Note,
+		CreatedBy: &adminID,
+	}, fmt.Sprintf("refund:%d", spend.ID))
+	if err != nil {
+		log.Printf("Error refunding credit transaction %d: %v", spend.ID, err)
+		http.Error(w, "Failed to refund credits", http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		http.Error(w, "Transaction already refunded", http.StatusConflict)
+		return
+	}
+	renderCreditAccount(w, r, spend.UserID)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"groovegarden/database"
+)
+
+// openTestDB points database.DB at the database in TEST_DATABASE_URL, with the
+// schema created, and skips the test when it isn't set. Tests share the
+// database, so each one creates the rows it needs.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+	})
+	if err := database.InitializeDatabase(); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+}
+
+// uniqueName returns a name no other test run has used
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+}
+
+func createTestUser(t *testing.T) int {
+	t.Helper()
+	var id int
+	err := database.DB.QueryRow("INSERT INTO users (name, email) VALUES ('Test listener', $1) RETURNING id",
+		uniqueName("listener")+"@example.com").Scan(&id)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return id
+}
+
+func createTestSong(t *testing.T) int {
+	t.Helper()
+	var id int
+	err := database.DB.QueryRow("INSERT INTO songs (title, storage_path) VALUES ('Test song', $1) RETURNING id",
+		uniqueName("song")+".mp3").Scan(&id)
+	if err != nil {
+		t.Fatalf("creating song: %v", err)
+	}
+	return id
+}
+
+func createTestStation(t *testing.T) int {
+	t.Helper()
+	name := uniqueName("station")
+	var id int
+	err := database.DB.QueryRow("INSERT INTO stations (name, slug, mount) VALUES ($1, $1, $2) RETURNING id",
+		name, "/"+name).Scan(&id)
+	if err != nil {
+		t.Fatalf("creating station: %v", err)
+	}
+	return id
+}
+
+// withRoute adds chi URL parameters and the authenticated user to a request
+func withRoute(r *http.Request, userID int, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, "user_id", userID)
+	return r.WithContext(ctx)
+}
@@ -10,8 +10,14 @@ import (
 	"github.com/go-chi/render"
 
 	"groovegarden/database"
+	"groovegarden/websocket"
 )
 
+// GetWebSocketMetrics reports websocket connections, send queue depths and drops (admin only)
+func GetWebSocketMetrics(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, websocket.Stats())
+}
+
 // ListUploads returns a list of all files in the uploads directory
 func ListUploads(w http.ResponseWriter, r *http.Request) {
 	uploadDir := "./uploads/"
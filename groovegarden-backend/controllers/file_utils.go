@@ -4,9 +4,13 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"groovegarden/database"
@@ -44,6 +48,78 @@ func SanitizeFilePath(originalPath string) string {
 	return sanitized
 }
 
+// allowedAudioExtensions lists the upload formats the stream can play
+var allowedAudioExtensions = []string{".mp3", ".aac"}
+
+// isAllowedAudioFile checks the filename extension against allowedAudioExtensions
+func isAllowedAudioFile(filename string) bool {
+	for _, ext := range allowedAudioExtensions {
+		if len(filename) > len(ext) && strings.EqualFold(filename[len(filename)-len(ext):], ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFileAtomically copies src into a temporary file next to finalPath and
+// renames it into place once fully written, so readers never see a partial file
+func writeFileAtomically(src io.Reader, finalPath string) error {
+	tmpPath, err := stageFile(src, finalPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	return nil
+}
+
+// stageFile copies src into a temporary file next to finalPath, flushed to
+// disk, and returns its path for the caller to rename into place. The name
+// keeps finalPath's extension so the file can be probed before then.
+func stageFile(src io.Reader, finalPath string) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(finalPath), ".upload-*.part"+filepath.Ext(finalPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to flush temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	return tmpPath, nil
+}
+
+// probeDuration reads the duration of an audio file in seconds using ffprobe
+func probeDuration(path string) (int, error) {
+	out, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed for %s: %w", path, err)
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe output for %s: %q", path, out)
+	}
+	return int(math.Round(seconds)), nil
+}
+
 // sanitizeFilename removes invalid characters from a filename
 func sanitizeFilename(name string) string {
 	// Replace spaces and special characters with underscores
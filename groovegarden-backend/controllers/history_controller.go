@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+// GetHistory returns recently played songs, newest first.
+// Optional: ?since=<RFC 3339 time>, ?station=<id>, ?limit= (default 50, max 200).
+func GetHistory(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+	stationID := 0
+	if value := r.URL.Query().Get("station"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+			return
+		}
+		stationID = id
+	}
+
+	plays, err := fetchPlays(`($1 = 0 OR p.station_id = $1) AND p.started_at >= $2`,
+		stationID, since, parseLimit(r, 50, 200))
+	if err != nil {
+		log.Printf("Error loading play history: %v", err)
+		http.Error(w, "Failed to fetch history", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, plays)
+}
+
+// GetSongPlays returns when and where a song was played, newest first.
+// Optional: ?since=<RFC 3339 time>, ?limit= (default 50, max 200).
+func GetSongPlays(w http.ResponseWriter, r *http.Request) {
+	songID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid song ID format", http.StatusBadRequest)
+		return
+	}
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM songs WHERE id = $1)", songID).Scan(&exists); err != nil {
+		http.Error(w, "Failed to fetch song", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+
+	plays, err := fetchPlays(`p.song_id = $1 AND p.started_at >= $2`, songID, since, parseLimit(r, 50, 200))
+	if err != nil {
+		log.Printf("Error loading plays of song %d: %v", songID, err)
+		http.Error(w, "Failed to fetch plays", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, plays)
+}
+
+// parseSince reads the optional ?since= parameter; without it everything is included
+func parseSince(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		return time.Time{}, true
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		http.Error(w, "Invalid since, expected an RFC 3339 time such as 2024-01-02T15:04:05Z", http.StatusBadRequest)
+		return since, false
+	}
+	return since, true
+}
+
+// fetchPlays lists plays matching filter, which uses $1 and $2; the limit is $3
+func fetchPlays(filter string, arg interface{}, since time.Time, limit int) ([]models.Play, error) {
+	rows, err := database.DB.Query(`
+		SELECT p.id, p.song_id, p.station_id, p.title, p.artist, p.source,
+		       p.started_at, p.ended_at, p.listener_count, p.skipped
+		FROM plays p
+		WHERE `+filter+`
+		ORDER BY p.started_at DESC, p.id DESC
+		LIMIT $3
+	`, arg, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plays := []models.Play{}
+	for rows.Next() {
+		var play models.Play
+		var songID, stationID sql.NullInt64
+		var endedAt sql.NullTime
+		err := rows.Scan(&play.ID, &songID, &stationID, &play.Title, &play.Artist, &play.Source,
+			&play.StartedAt, &endedAt, &play.ListenerCount, &play.Skipped)
+		if err != nil {
+			return nil, err
+		}
+		if songID.Valid {
+			id := int(songID.Int64)
+			play.SongID = &id
+		}
+		play.StationID = database.NullIntPtr(stationID)
+		if endedAt.Valid {
+			play.EndedAt = &endedAt.Time
+		}
+		plays = append(plays, play)
+	}
+	return plays, rows.Err()
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+// isJingleKind checks a jingle or insertion rule kind
+func isJingleKind(kind string) bool {
+	switch kind {
+	case database.JingleStationID, database.JingleSponsor, database.JinglePromo:
+		return true
+	}
+	return false
+}
+
+// UploadJingle stores a station ID, sponsor spot or promo (admin only).
+// Form fields: "jingle" file, title, kind and an optional station_id (omit for all stations).
+func UploadJingle(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(int)
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "File too large or invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("jingle")
+	if err != nil {
+		http.Error(w, "Invalid file upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if !isAllowedAudioFile(header.Filename) {
+		http.Error(w, "Invalid file type. Only MP3 and AAC files are allowed.", http.StatusBadRequest)
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if !isJingleKind(kind) {
+		http.Error(w, "kind must be station_id, sponsor or promo", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+
+	var stationID *int
+	if value := r.FormValue("station_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+			return
+		}
+		stationID = &id
+	}
+
+	EnsureUploadsDirectory()
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database connection error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	jingle := models.Jingle{Title: title, Kind: kind, StationID: stationID}
+	err = tx.QueryRow(
+		"INSERT INTO jingles (title, kind, storage_path, station_id, created_by) VALUES ($1, $2, '', $3, $4) RETURNING id, created_at",
+		title, kind, stationID, userID,
+	).Scan(&jingle.ID, &jingle.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			http.Error(w, "Station not found", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error creating jingle: %v", err)
+		http.Error(w, "Failed to save jingle", http.StatusInternalServerError)
+		return
+	}
+
+	path := SanitizeFilePath(fmt.Sprintf("jingle_%d_%s", jingle.ID, filepath.Base(header.Filename)))
+	if err := writeFileAtomically(file, path); err != nil {
+		log.Printf("Error storing jingle %d: %v", jingle.ID, err)
+		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
+
+	jingle.Duration, err = probeDuration(path)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE jingles SET storage_path = $1, duration = $2 WHERE id = $3", path, jingle.Duration, jingle.ID); err != nil {
+		os.Remove(path)
+		http.Error(w, "Failed to save jingle", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		os.Remove(path)
+		http.Error(w, "Failed to save jingle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Jingle %d (%s, %s) uploaded by user_id %d", jingle.ID, title, kind, userID)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, jingle)
+}
+
+// ListJingles returns jingles, optionally only those airing on ?station=ID (admin only)
+func ListJingles(w http.ResponseWriter, r *http.Request) {
+	stationID := 0
+	if value := r.URL.Query().Get("station"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+			return
+		}
+		stationID = id
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, title, kind, duration, station_id, created_at
+		FROM jingles
+		WHERE $1 = 0 OR station_id IS NULL OR station_id = $1
+		ORDER BY kind, title, id
+	`, stationID)
+	if err != nil {
+		log.Printf("Error listing jingles: %v", err)
+		http.Error(w, "Failed to fetch jingles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	jingles := []models.Jingle{}
+	for rows.Next() {
+		var jingle models.Jingle
+		var station sql.NullInt64
+		if err := rows.Scan(&jingle.ID, &jingle.Title, &jingle.Kind, &jingle.Duration, &station, &jingle.CreatedAt); err != nil {
+			http.Error(w, "Failed to read jingles", http.StatusInternalServerError)
+			return
+		}
+		jingle.StationID = database.NullIntPtr(station)
+		jingles = append(jingles, jingle)
+	}
+	render.JSON(w, r, jingles)
+}
+
+// DeleteJingle removes a jingle and its audio file (admin only)
+func DeleteJingle(w http.ResponseWriter, r *http.Request) {
+	jingleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid jingle ID format", http.StatusBadRequest)
+		return
+	}
+
+	var path string
+	err = database.DB.QueryRow("DELETE FROM jingles WHERE id = $1 RETURNING storage_path", jingleID).Scan(&path)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Jingle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error deleting jingle %d: %v", jingleID, err)
+		http.Error(w, "Failed to delete jingle", http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: could not remove %s: %v", path, err)
+	}
+	render.JSON(w, r, map[string]string{"message": "Jingle deleted"})
+}
+
+// GetInsertionRules lists a station's jingle insertion rules (admin only)
+func GetInsertionRules(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := database.ListInsertionRules(station.ID)
+	if err != nil {
+		log.Printf("Error loading insertion rules for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch insertion rules", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, rules)
+}
+
+// CreateInsertionRule adds a rule such as "station ID every 4 tracks"
+// ({"kind": "station_id", "every_tracks": 4}) or "promo at :00 and :30"
+// ({"kind": "promo", "at_minutes": [0, 30]}) (admin only)
+func CreateInsertionRule(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	var rule models.InsertionRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !isJingleKind(rule.Kind) {
+		http.Error(w, "kind must be station_id, sponsor or promo", http.StatusBadRequest)
+		return
+	}
+	if (rule.EveryTracks == nil) == (len(rule.AtMinutes) == 0) {
+		http.Error(w, "Set exactly one of every_tracks and at_minutes", http.StatusBadRequest)
+		return
+	}
+	if rule.EveryTracks != nil && *rule.EveryTracks < 1 {
+		http.Error(w, "every_tracks must be at least 1", http.StatusBadRequest)
+		return
+	}
+
+	var minutes []int
+	if len(rule.AtMinutes) > 0 {
+		seen := make(map[int]bool)
+		for _, minute := range rule.AtMinutes {
+			if minute < 0 || minute > 59 {
+				http.Error(w, "at_minutes values must be between 0 and 59", http.StatusBadRequest)
+				return
+			}
+			if !seen[minute] {
+				seen[minute] = true
+				minutes = append(minutes, minute)
+			}
+		}
+		sort.Ints(minutes)
+	}
+	rule.AtMinutes = minutes
+	rule.StationID = station.ID
+
+	var atMinutes interface{}
+	if minutes != nil {
+		atMinutes = pq.Array(minutes)
+	}
+	err := database.DB.QueryRow(
+		"INSERT INTO insertion_rules (station_id, kind, every_tracks, at_minutes) VALUES ($1, $2, $3, $4) RETURNING id",
+		station.ID, rule.Kind, rule.EveryTracks, atMinutes,
+	).Scan(&rule.ID)
+	if err != nil {
+		log.Printf("Error creating insertion rule on station %d: %v", station.ID, err)
+		http.Error(w, "Failed to create insertion rule", http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, rule)
+}
+
+// DeleteInsertionRule removes a station's insertion rule (admin only)
+func DeleteInsertionRule(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.Atoi(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID format", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM insertion_rules WHERE id = $1 AND station_id = $2", ruleID, station.ID)
+	if err != nil {
+		log.Printf("Error deleting insertion rule %d: %v", ruleID, err)
+		http.Error(w, "Failed to delete insertion rule", http.StatusInternalServerError)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		http.Error(w, "Insertion rule not found", http.StatusNotFound)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Insertion rule deleted"})
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	gorillaws "github.com/gorilla/websocket"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/playout"
+	"groovegarden/utils"
+	"groovegarden/websocket"
+)
+
+// liveUpgrader accepts websocket live sources; audio arrives as binary frames.
+// Browsers may only connect from the same origins as /ws.
+var liveUpgrader = gorillaws.Upgrader{
+	CheckOrigin: websocket.CheckOrigin,
+}
+
+// LiveSource accepts an Icecast-style source (SOURCE or PUT /live/{id}) and
+// puts it on air. Source clients authenticate with their JWT as the password
+// (any username) or as a Bearer token.
+func LiveSource(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	info, ok := authorizeLive(w, r, station)
+	if !ok {
+		return
+	}
+	info.Via = "source"
+	if title := r.Header.Get("Ice-Name"); title != "" {
+		info.Title = title
+	}
+
+	// Legacy SOURCE clients send no Content-Length and stream until they
+	// disconnect, which net/http reads as an empty body: take over the connection
+	if r.Body == http.NoBody {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("HTTP/1.0 200 OK\r\n\r\n")); err != nil {
+			return
+		}
+		if err := playout.GoLive(context.Background(), station.ID, info, buf.Reader); err != nil {
+			log.Printf("Live source on station %d rejected: %v", station.ID, err)
+		}
+		return
+	}
+
+	// Chunked PUT: answer straight away and keep reading the body
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil {
+		log.Printf("Warning: full duplex unavailable for live source: %v", err)
+	}
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	if err := playout.GoLive(r.Context(), station.ID, info, r.Body); err != nil {
+		log.Printf("Live source on station %d rejected: %v", station.ID, err)
+	}
+}
+
+// LiveWebSocket accepts a live source over a websocket (GET /live/{id}/ws?token=...).
+// Each binary frame carries the next piece of an encoded stream, e.g. from MediaRecorder.
+func LiveWebSocket(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	info, ok := authorizeLive(w, r, station)
+	if !ok {
+		return
+	}
+	info.Via = "websocket"
+	if title := r.URL.Query().Get("title"); title != "" {
+		info.Title = title
+	}
+
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading live websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src, sink := io.Pipe()
+	defer src.Close()
+	go func() {
+		defer cancel()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				sink.CloseWithError(err)
+				return
+			}
+			if messageType != gorillaws.BinaryMessage {
+				continue
+			}
+			if _, err := sink.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = playout.GoLive(ctx, station.ID, info, src)
+	message := "live session ended"
+	if err != nil {
+		message = err.Error()
+	}
+	conn.WriteMessage(gorillaws.CloseMessage, gorillaws.FormatCloseMessage(gorillaws.CloseNormalClosure, message))
+}
+
+// EndLiveSession disconnects the live source on a station (admin only)
+func EndLiveSession(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	if !playout.EndLive(station.ID) {
+		http.Error(w, "Station is not live", http.StatusNotFound)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Live session ended"})
+}
+
+// authorizeLive checks the caller may broadcast on a station: admins at any
+// time, artists only during their own scheduled live show
+func authorizeLive(w http.ResponseWriter, r *http.Request, station models.Station) (models.LiveSession, bool) {
+	var info models.LiveSession
+
+	token := liveToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="GrooveGarden live"`)
+		http.Error(w, "Authorization required", http.StatusUnauthorized)
+		return info, false
+	}
+	claims, err := utils.ValidateJWTAndGetClaims(token)
+	if err != nil {
+		http.Error(w, "Invalid or expired token: "+err.Error(), http.StatusUnauthorized)
+		return info, false
+	}
+	userID, _ := claims["user_id"].(float64) // JWT numbers are float64
+	role, _ := claims["role"].(string)
+	info.ArtistID = int(userID)
+
+	switch role {
+	case "admin":
+	case "artist":
+		slot, err := playout.ActiveSlot(station)
+		if err != nil {
+			log.Printf("Error loading schedule for station %d: %v", station.ID, err)
+			http.Error(w, "Failed to check schedule", http.StatusInternalServerError)
+			return info, false
+		}
+		if slot == nil || slot.Rule != database.RuleLive || slot.ArtistID == nil || *slot.ArtistID != info.ArtistID {
+			http.Error(w, "Artists can only go live during their scheduled show", http.StatusForbidden)
+			return info, false
+		}
+		info.Title = slot.Name
+	default:
+		http.Error(w, "Access denied: insufficient permissions", http.StatusForbidden)
+		return info, false
+	}
+
+	if !playout.IsRunning(station.ID) {
+		http.Error(w, playout.ErrOffAir.Error(), http.StatusConflict)
+		return info, false
+	}
+	if !playout.RunsHere(station.ID) {
+		// The audio can't be relayed between instances
+		http.Error(w, playout.ErrOtherInstance.Error(), http.StatusServiceUnavailable)
+		return info, false
+	}
+	if playout.LiveSession(station.ID) != nil {
+		http.Error(w, playout.ErrAlreadyLive.Error(), http.StatusConflict)
+		return info, false
+	}
+
+	if err := database.DB.QueryRow("SELECT name FROM users WHERE id = $1", info.ArtistID).Scan(&info.ArtistName); err != nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return info, false
+	}
+	return info, true
+}
+
+// liveToken reads the JWT from a Bearer header, a Basic password (what
+// Icecast source clients send) or the token query parameter (browsers' websockets)
+func liveToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return r.URL.Query().Get("token")
+}
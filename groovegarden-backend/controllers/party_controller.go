@@ -0,0 +1,387 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+const (
+	// maxPartyMembers caps how many users can join one party, host included
+	maxPartyMembers = 50
+	// maxPartyNameLength caps party names, in characters
+	maxPartyNameLength = 100
+	// partyCodeLength is the length of invite codes, drawn from partyCodeAlphabet
+	partyCodeLength   = 8
+	partyCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // No 0/O or 1/I to misread
+)
+
+var (
+	errPartyNotFound   = errors.New("Party not found")
+	errNotPartyHost    = errors.New("Only the host controls playback")
+	errNoPartySong     = errors.New("Load a song before playing")
+	errUnknownAction   = errors.New("action must be one of load, play, pause or seek")
+	errSongNotPlayable = errors.New("Song not found or has no audio")
+)
+
+// partyControl is a host's playback command
+type partyControl struct {
+	Action     string `json:"action"` // 'load', 'play', 'pause' or 'seek'
+	SongID     int    `json:"song_id"`
+	PositionMS *int64 `json:"position_ms"`
+}
+
+// CreateParty opens a listening party hosted by the caller, optionally with a song loaded
+func CreateParty(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name   string `json:"name"`
+		SongID int    `json:"song_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if utf8.RuneCountInString(req.Name) > maxPartyNameLength {
+		http.Error(w, fmt.Sprintf("Party names are limited to %d characters", maxPartyNameLength), http.StatusBadRequest)
+		return
+	}
+
+	var songID *int
+	if req.SongID != 0 {
+		if err := checkPlayableSong(req.SongID); err != nil {
+			partyHTTPError(w, err, "Failed to create party")
+			return
+		}
+		songID = &req.SongID
+	}
+
+	// Retry the rare invite code collision
+	var party models.ListeningParty
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		party, err = database.CreateParty(userID, req.Name, newPartyCode(), songID)
+		if pqErr, ok := err.(*pq.Error); !ok || pqErr.Code != "23505" {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("Error creating listening party for user %d: %v", userID, err)
+		http.Error(w, "Failed to create party", http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, party)
+}
+
+// JoinParty adds the caller to the party with the given invite code
+func JoinParty(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		http.Error(w, "An invite code is required", http.StatusBadRequest)
+		return
+	}
+
+	party, err := database.GetPartyByCode(strings.ToUpper(strings.TrimSpace(req.Code)))
+	if err == sql.ErrNoRows {
+		http.Error(w, "No party with that code", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error finding party by code: %v", err)
+		http.Error(w, "Failed to join party", http.StatusInternalServerError)
+		return
+	}
+
+	joined, err := database.JoinParty(party.ID, userID, maxPartyMembers)
+	if err != nil {
+		log.Printf("Error joining user %d to party %d: %v", userID, party.ID, err)
+		http.Error(w, "Failed to join party", http.StatusInternalServerError)
+		return
+	}
+	if !joined {
+		if member, err := database.IsPartyMember(party.ID, userID); err != nil || !member {
+			http.Error(w, "Party is full", http.StatusConflict)
+			return
+		}
+	}
+
+	if party, err = database.GetParty(party.ID); err != nil {
+		log.Printf("Error loading party %d: %v", party.ID, err)
+		http.Error(w, "Failed to join party", http.StatusInternalServerError)
+		return
+	}
+	if joined {
+		for _, member := range party.Members {
+			if member.UserID == userID {
+				websocket.NotifyTopic(websocket.PartyTopic(party.ID), websocket.EventPartyMemberJoined, member)
+			}
+		}
+	}
+	render.JSON(w, r, party)
+}
+
+// GetParty returns a party's playback state and members, to its members
+func GetParty(w http.ResponseWriter, r *http.Request) {
+	party, userID, ok := loadParty(w, r)
+	if !ok {
+		return
+	}
+	if !isInParty(party, userID) {
+		http.Error(w, "Party not found", http.StatusNotFound)
+		return
+	}
+	render.JSON(w, r, party)
+}
+
+// ControlParty changes a party's playback (host only). Members get the new
+// state as a party_state event.
+func ControlParty(w http.ResponseWriter, r *http.Request) {
+	partyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid party ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req partyControl
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	state, err := controlParty(partyID, userID, req)
+	if err != nil {
+		partyHTTPError(w, err, "Failed to update playback")
+		return
+	}
+	render.JSON(w, r, state)
+}
+
+// controlParty applies a host's playback command and broadcasts the result
+func controlParty(partyID, userID int, req partyControl) (models.PartyState, error) {
+	var songID int
+	switch req.Action {
+	case "load":
+		if req.SongID == 0 {
+			return models.PartyState{}, errSongNotPlayable
+		}
+		if err := checkPlayableSong(req.SongID); err != nil {
+			return models.PartyState{}, err
+		}
+		songID = req.SongID
+	case "play", "pause", "seek":
+	default:
+		return models.PartyState{}, errUnknownAction
+	}
+
+	var hostID int
+	err := database.DB.QueryRow("SELECT host_id FROM listening_parties WHERE id = $1 AND ended_at IS NULL", partyID).Scan(&hostID)
+	if err == sql.ErrNoRows {
+		return models.PartyState{}, errPartyNotFound
+	} else if err != nil {
+		return models.PartyState{}, err
+	}
+	if hostID != userID {
+		return models.PartyState{}, errNotPartyHost
+	}
+
+	state, err := database.UpdatePartyState(partyID, func(state *models.PartyState, now time.Time) error {
+		switch req.Action {
+		case "load":
+			state.SongID = &songID
+			state.Playing = false
+			state.PositionMS = 0
+		case "play":
+			if state.SongID == nil {
+				return errNoPartySong
+			}
+			state.Playing = true
+		case "pause":
+			state.Playing = false
+		}
+		if req.PositionMS != nil && req.Action != "load" {
+			state.PositionMS = *req.PositionMS
+			if state.PositionMS < 0 {
+				state.PositionMS = 0
+			}
+			if state.DurationMS > 0 && state.PositionMS > state.DurationMS {
+				state.PositionMS = state.DurationMS
+			}
+		}
+		return nil
+	})
+	if err == sql.ErrNoRows {
+		return state, errPartyNotFound
+	} else if err != nil {
+		return state, err
+	}
+
+	websocket.NotifyTopic(websocket.PartyTopic(partyID), websocket.EventPartyState, state)
+	return state, nil
+}
+
+// LeaveParty takes the caller out of a party; the host leaving ends it
+func LeaveParty(w http.ResponseWriter, r *http.Request) {
+	party, userID, ok := loadParty(w, r)
+	if !ok {
+		return
+	}
+	if party.EndedAt != nil || !isInParty(party, userID) {
+		http.Error(w, "Party not found", http.StatusNotFound)
+		return
+	}
+	if party.HostID == userID {
+		endParty(w, r, party)
+		return
+	}
+
+	if _, err := database.LeaveParty(party.ID, userID); err != nil {
+		log.Printf("Error removing user %d from party %d: %v", userID, party.ID, err)
+		http.Error(w, "Failed to leave party", http.StatusInternalServerError)
+		return
+	}
+	for _, member := range party.Members {
+		if member.UserID == userID {
+			websocket.NotifyTopic(websocket.PartyTopic(party.ID), websocket.EventPartyMemberLeft, member)
+		}
+	}
+	// Their open connections stop following the party once they're out
+	websocket.UnsubscribeUser(userID, websocket.PartyTopic(party.ID))
+	render.JSON(w, r, map[string]string{"message": "Left party"})
+}
+
+// EndParty closes a party for all its members (host or admin)
+func EndParty(w http.ResponseWriter, r *http.Request) {
+	party, userID, ok := loadParty(w, r)
+	if !ok {
+		return
+	}
+	role, _ := r.Context().Value("role").(string)
+	if party.HostID != userID && role != "admin" {
+		http.Error(w, "Only the host can end the party", http.StatusForbidden)
+		return
+	}
+	endParty(w, r, party)
+}
+
+func endParty(w http.ResponseWriter, r *http.Request, party models.ListeningParty) {
+	err := database.EndParty(party.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Party has already ended", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error ending party %d: %v", party.ID, err)
+		http.Error(w, "Failed to end party", http.StatusInternalServerError)
+		return
+	}
+	websocket.NotifyTopic(websocket.PartyTopic(party.ID), websocket.EventPartyEnded, websocket.Deleted{ID: party.ID})
+	websocket.CloseTopic(websocket.PartyTopic(party.ID))
+	render.JSON(w, r, map[string]string{"message": "Party ended"})
+}
+
+// loadParty reads the party named in the URL along with the caller, writing
+// the error response if either is missing
+func loadParty(w http.ResponseWriter, r *http.Request) (models.ListeningParty, int, bool) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return models.ListeningParty{}, 0, false
+	}
+	partyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid party ID format", http.StatusBadRequest)
+		return models.ListeningParty{}, 0, false
+	}
+
+	party, err := database.GetParty(partyID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Party not found", http.StatusNotFound)
+		return party, 0, false
+	} else if err != nil {
+		log.Printf("Error loading party %d: %v", partyID, err)
+		http.Error(w, "Failed to fetch party", http.StatusInternalServerError)
+		return party, 0, false
+	}
+	return party, userID, true
+}
+
+func isInParty(party models.ListeningParty, userID int) bool {
+	for _, member := range party.Members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPlayableSong makes sure a song exists and has audio to stream
+func checkPlayableSong(songID int) error {
+	var playable bool
+	err := database.DB.QueryRow("SELECT storage_path IS NOT NULL FROM songs WHERE id = $1", songID).Scan(&playable)
+	if err == sql.ErrNoRows || (err == nil && !playable) {
+		return errSongNotPlayable
+	}
+	return err
+}
+
+// newPartyCode draws a random invite code
+func newPartyCode() string {
+	b := make([]byte, partyCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = partyCodeAlphabet[int(b[i])%len(partyCodeAlphabet)]
+	}
+	return string(b)
+}
+
+// partyHTTPError writes the response for an error from the party helpers
+func partyHTTPError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case errPartyNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errNotPartyHost:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errNoPartySong:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errUnknownAction, errSongNotPlayable:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
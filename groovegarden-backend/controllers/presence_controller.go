@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"groovegarden/cluster"
+	"groovegarden/database"
+	"groovegarden/websocket"
+)
+
+// presenceHeartbeat is how often this instance refreshes its listeners'
+// presence and last_seen; it must be well under database.PresenceTimeout
+const presenceHeartbeat = time.Minute
+
+// RunPresence records who is tuned in to which station from the websocket
+// connections, and keeps it fresh until the process exits
+func RunPresence() {
+	websocket.OnPresence(presenceChanged)
+
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+	for range ticker.C {
+		for stationID, userIDs := range websocket.PresentUsers() {
+			if err := database.JoinPresence(stationID, userIDs, cluster.Instance); err != nil {
+				log.Printf("Error refreshing presence on station %d: %v", stationID, err)
+			}
+		}
+		if err := database.PrunePresence(); err != nil {
+			log.Printf("Error pruning stale presence: %v", err)
+		}
+	}
+}
+
+// presenceChanged stores a user tuning in or out, announcing it unless they
+// are still tuned in through another instance or hide their presence
+func presenceChanged(stationID, userID int, joined bool) {
+	var err error
+	if joined {
+		err = database.JoinPresence(stationID, []int{userID}, cluster.Instance)
+	} else {
+		err = database.LeavePresence(stationID, userID, cluster.Instance)
+	}
+	if err != nil {
+		log.Printf("Error recording presence of user %d on station %d: %v", userID, stationID, err)
+		return
+	}
+
+	elsewhere, visible, name, err := database.PresentElsewhere(stationID, userID, cluster.Instance)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error checking presence of user %d on station %d: %v", userID, stationID, err)
+		}
+		return
+	}
+	if elsewhere || !visible {
+		return
+	}
+
+	event := websocket.EventPresenceLeave
+	if joined {
+		event = websocket.EventPresenceJoin
+	}
+	websocket.NotifyTopic(websocket.StationTopic(stationID), event, websocket.Presence{
+		StationID: stationID,
+		UserID:    userID,
+		UserName:  name,
+	})
+}
+
+// GetStationListeners lists the signed-in users tuned in to a station. Users
+// who hide their presence are only counted.
+func GetStationListeners(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	presence, err := database.GetStationPresence(station.ID)
+	if err != nil {
+		log.Printf("Error listing listeners on station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch listeners", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, presence)
+}
+
+// SetPresenceVisibility lets the caller choose whether they appear in
+// station listener lists and presence events
+func SetPresenceVisibility(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Visible *bool `json:"visible"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Visible == nil {
+		http.Error(w, "visible (true or false) is required", http.StatusBadRequest)
+		return
+	}
+	if err := database.SetShowPresence(userID, *req.Visible); err != nil {
+		log.Printf("Error updating presence visibility for user %d: %v", userID, err)
+		http.Error(w, "Failed to update presence visibility", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, map[string]bool{"visible": *req.Visible})
+}
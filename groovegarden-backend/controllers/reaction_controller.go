@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"groovegarden/database"
+)
+
+// GetSongReactions returns how many of each reaction a song has received on air
+func GetSongReactions(w http.ResponseWriter, r *http.Request) {
+	songID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid song ID format", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM songs WHERE id = $1)", songID).Scan(&exists); err != nil {
+		http.Error(w, "Failed to fetch song", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+
+	totals, err := database.SongReactionTotals(songID)
+	if err != nil {
+		log.Printf("Error loading reactions to song %d: %v", songID, err)
+		http.Error(w, "Failed to fetch reactions", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, map[string]interface{}{
+		"song_id": songID,
+		"counts":  totals,
+		"emoji":   database.ReactionEmoji,
+	})
+}
@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+// allowedCoverExtensions lists the image formats accepted for release covers
+var allowedCoverExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// CreateRelease creates a release and all of its tracks from one multipart upload.
+// Files are sent as repeated "songs" fields in track order; optional repeated
+// "titles" fields name the tracks in the same order.
+func CreateRelease(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseMultipartForm(100 << 20); err != nil { // Limit to 100 MB for a whole release
+		http.Error(w, "Files too large or invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		http.Error(w, "Release title is required", http.StatusBadRequest)
+		return
+	}
+
+	files := r.MultipartForm.File["songs"]
+	if len(files) == 0 {
+		http.Error(w, "At least one song file is required", http.StatusBadRequest)
+		return
+	}
+	for _, fh := range files {
+		if !isAllowedAudioFile(fh.Filename) {
+			http.Error(w, fmt.Sprintf("Invalid file type for %s. Only MP3 and AAC files are allowed.", fh.Filename), http.StatusBadRequest)
+			return
+		}
+	}
+
+	releaseType := strings.ToLower(r.FormValue("type"))
+	if releaseType == "" {
+		releaseType = defaultReleaseType(len(files))
+	}
+	if releaseType != models.ReleaseTypeSingle && releaseType != models.ReleaseTypeEP && releaseType != models.ReleaseTypeAlbum {
+		http.Error(w, "Invalid release type. Use single, ep or album.", http.StatusBadRequest)
+		return
+	}
+
+	var releaseDate *time.Time
+	if dateStr := r.FormValue("release_date"); dateStr != "" {
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			http.Error(w, "Invalid release_date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		releaseDate = &parsed
+	}
+
+	artist := r.FormValue("artist")
+	if artist == "" {
+		artist = "Unknown Artist" // Same default as UploadSong
+	}
+	titles := r.MultipartForm.Value["titles"]
+
+	// Genre, moods and tags given for the release apply to every track
+	taxonomy := taxonomyFromForm(r)
+
+	EnsureUploadsDirectory()
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database connection error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var releaseID int
+	err = tx.QueryRow(
+		"INSERT INTO releases (artist_id, title, release_type, release_date) VALUES ($1, $2, $3, $4) RETURNING id",
+		userID, title, releaseType, releaseDate,
+	).Scan(&releaseID)
+	if err != nil {
+		log.Printf("Error creating release: %v", err)
+		http.Error(w, "Failed to create release", http.StatusInternalServerError)
+		return
+	}
+
+	// Anything written to disk is removed again if the release can't be saved
+	written := []string{}
+	cleanup := func() {
+		for _, path := range written {
+			os.Remove(path)
+		}
+	}
+
+	if coverFile, coverHeader, err := r.FormFile("cover"); err == nil {
+		defer coverFile.Close()
+		ext := strings.ToLower(filepath.Ext(coverHeader.Filename))
+		if !allowedCoverExtensions[ext] {
+			http.Error(w, "Invalid cover type. Only JPG, PNG and WebP images are allowed.", http.StatusBadRequest)
+			return
+		}
+		coverPath := filepath.Join("./uploads", fmt.Sprintf("cover_%d%s", releaseID, ext))
+		if err := writeFileAtomically(coverFile, coverPath); err != nil {
+			log.Printf("Error storing cover for release %d: %v", releaseID, err)
+			http.Error(w, "Failed to save cover", http.StatusInternalServerError)
+			return
+		}
+		written = append(written, coverPath)
+		if _, err := tx.Exec("UPDATE releases SET cover_path = $1 WHERE id = $2", coverPath, releaseID); err != nil {
+			cleanup()
+			http.Error(w, "Failed to save cover", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	songIDs := []int{}
+	for i, fh := range files {
+		trackNumber := i + 1
+		trackPath := SanitizeFilePath(fmt.Sprintf("r%d_%02d_%s", releaseID, trackNumber, filepath.Base(fh.Filename)))
+
+		src, err := fh.Open()
+		if err == nil {
+			err = writeFileAtomically(src, trackPath)
+			src.Close()
+		}
+		if err != nil {
+			log.Printf("Error storing track %d of release %d: %v", trackNumber, releaseID, err)
+			cleanup()
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+		written = append(written, trackPath)
+
+		trackTitle := strings.TrimSuffix(fh.Filename, filepath.Ext(fh.Filename))
+		if i < len(titles) && strings.TrimSpace(titles[i]) != "" {
+			trackTitle = strings.TrimSpace(titles[i])
+		}
+
+		duration, err := probeDuration(trackPath)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+
+		var songID int
+		err = tx.QueryRow(
+			`INSERT INTO songs (title, artist, storage_path, votes, duration, artist_id, release_id, track_number)
+			 VALUES ($1, $2, $3, 0, $4, $5, $6, $7) RETURNING id`,
+			trackTitle, artist, trackPath, duration, userID, releaseID, trackNumber,
+		).Scan(&songID)
+		if err != nil {
+			log.Printf("Error saving track %d of release %d: %v", trackNumber, releaseID, err)
+			cleanup()
+			http.Error(w, "Failed to save song metadata", http.StatusInternalServerError)
+			return
+		}
+		songIDs = append(songIDs, songID)
+
+		if err := setSongTaxonomy(tx, songID, taxonomy); err != nil {
+			cleanup()
+			if isTaxonomyInputError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error classifying track %d of release %d: %v", trackNumber, releaseID, err)
+			http.Error(w, "Failed to save song metadata", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing release %d: %v", releaseID, err)
+		cleanup()
+		http.Error(w, "Failed to create release", http.StatusInternalServerError)
+		return
+	}
+
+	release, err := fetchRelease(releaseID)
+	if err != nil {
+		http.Error(w, "Failed to fetch release", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Release %d created by user_id %d with %d tracks", releaseID, userID, len(songIDs))
+	websocket.NotifyClients(websocket.EventReleaseCreated, release)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, release)
+}
+
+// GetRelease returns a release with its ordered track listing
+func GetRelease(w http.ResponseWriter, r *http.Request) {
+	releaseID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid release ID format", http.StatusBadRequest)
+		return
+	}
+
+	release, err := fetchRelease(releaseID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching release %d: %v", releaseID, err)
+		http.Error(w, "Failed to fetch release", http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, release)
+}
+
+// GetReleaseCover serves a release's cover image
+func GetReleaseCover(w http.ResponseWriter, r *http.Request) {
+	releaseID := chi.URLParam(r, "id")
+
+	var coverPath sql.NullString
+	err := database.DB.QueryRow("SELECT cover_path FROM releases WHERE id = $1", releaseID).Scan(&coverPath)
+	if err != nil || !coverPath.Valid || coverPath.String == "" {
+		http.Error(w, "Cover not found", http.StatusNotFound)
+		return
+	}
+
+	http.ServeFile(w, r, coverPath.String)
+}
+
+// GetArtistReleases lists an artist's releases, newest first
+func GetArtistReleases(w http.ResponseWriter, r *http.Request) {
+	artistID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid artist ID format", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.artist_id, COALESCE(u.name, ''), r.title, r.release_type, r.release_date,
+		       COALESCE(r.cover_path, ''), r.created_at,
+		       (SELECT COUNT(*) FROM songs s WHERE s.release_id = r.id)
+		FROM releases r
+		LEFT JOIN users u ON r.artist_id = u.id
+		WHERE r.artist_id = $1
+		ORDER BY COALESCE(r.release_date, r.created_at::date) DESC, r.id DESC
+	`, artistID)
+	if err != nil {
+		log.Printf("Error listing releases for artist %d: %v", artistID, err)
+		http.Error(w, "Failed to fetch releases", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	releases := []models.Release{}
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
+			return
+		}
+		releases = append(releases, release)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("Error iterating over rows: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, releases)
+}
+
+// fetchRelease loads a release and its tracks in track order
+func fetchRelease(releaseID int) (models.Release, error) {
+	row := database.DB.QueryRow(`
+		SELECT r.id, r.artist_id, COALESCE(u.name, ''), r.title, r.release_type, r.release_date,
+		       COALESCE(r.cover_path, ''), r.created_at,
+		       (SELECT COUNT(*) FROM songs s WHERE s.release_id = r.id)
+		FROM releases r
+		LEFT JOIN users u ON r.artist_id = u.id
+		WHERE r.id = $1
+	`, releaseID)
+	release, err := scanRelease(row)
+	if err != nil {
+		return release, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT s.id, s.title, COALESCE(s.artist, u.name, 'Unknown'), s.artist_id, s.duration,
+		       s.upload_date, s.votes, s.explicit, s.track_number, `+database.SongTaxonomyColumns+`
+		FROM songs s
+		LEFT JOIN users u ON s.artist_id = u.id
+		WHERE s.release_id = $1
+		ORDER BY s.track_number NULLS LAST, s.id
+	`, releaseID)
+	if err != nil {
+		return release, err
+	}
+	defer rows.Close()
+
+	release.Tracks = []models.Song{}
+	for rows.Next() {
+		song := models.Song{Moods: []string{}, Tags: []string{}, ReleaseID: &release.ID}
+		var artistID, trackNumber sql.NullInt64
+		var genre sql.NullString
+		err := rows.Scan(&song.ID, &song.Title, &song.Artist, &artistID, &song.Duration,
+			&song.UploadDate, &song.Votes, &song.Explicit, &trackNumber,
+			&genre, pq.Array(&song.Moods), pq.Array(&song.Tags))
+		if err != nil {
+			return release, err
+		}
+		song.ArtistID = database.NullIntPtr(artistID)
+		song.TrackNumber = database.NullIntPtr(trackNumber)
+		song.Genre = genre.String
+		release.Tracks = append(release.Tracks, song)
+	}
+	return release, rows.Err()
+}
+
+// scanRelease reads the release columns shared by fetchRelease and GetArtistReleases
+func scanRelease(row interface{ Scan(...interface{}) error }) (models.Release, error) {
+	var release models.Release
+	var artistID sql.NullInt64
+	var releaseDate sql.NullTime
+	err := row.Scan(&release.ID, &artistID, &release.Artist, &release.Title, &release.Type, &releaseDate,
+		&release.CoverPath, &release.CreatedAt, &release.TrackCount)
+	if err != nil {
+		return release, err
+	}
+	release.ArtistID = database.NullIntPtr(artistID)
+	if releaseDate.Valid {
+		release.ReleaseDate = &releaseDate.Time
+	}
+	return release, nil
+}
+
+// defaultReleaseType picks a release type from the number of tracks
+func defaultReleaseType(tracks int) string {
+	switch {
+	case tracks <= 1:
+		return models.ReleaseTypeSingle
+	case tracks <= 6:
+		return models.ReleaseTypeEP
+	default:
+		return models.ReleaseTypeAlbum
+	}
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+const (
+	// maxDedicationLength caps dedication messages, in characters
+	maxDedicationLength = 280
+	// requestCooldown is how long before a listener may request the same song
+	// again, as a Postgres interval so the database clock decides
+	requestCooldown = "2 hours"
+)
+
+// errRequestNotPending is returned when moderating a request that was already decided
+var errRequestNotPending = errors.New("request is no longer pending")
+
+// requestColumns are the columns scanned by scanSongRequest
+const requestColumns = `r.id, r.station_id, r.song_id, s.title, COALESCE(s.artist, a.name, 'Unknown'),
+	r.user_id, COALESCE(u.name, ''), r.dedication, r.status, r.created_at, r.decided_at, r.played_at`
+
+// requestJoins are the joins requestColumns need
+const requestJoins = `
+	FROM song_requests r
+	JOIN songs s ON s.id = r.song_id
+	LEFT JOIN users a ON a.id = s.artist_id
+	LEFT JOIN users u ON u.id = r.user_id`
+
+// RequestSong asks a station to play a song, with an optional dedication.
+// Each listener may have one pending request and can't repeat a song within requestCooldown.
+func RequestSong(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		SongID     int    `json:"song_id"`
+		Dedication string `json:"dedication"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SongID == 0 {
+		http.Error(w, "A song_id is required", http.StatusBadRequest)
+		return
+	}
+	req.Dedication = strings.TrimSpace(req.Dedication)
+	if utf8.RuneCountInString(req.Dedication) > maxDedicationLength {
+		http.Error(w, fmt.Sprintf("Dedications are limited to %d characters", maxDedicationLength), http.StatusBadRequest)
+		return
+	}
+
+	var inPool, playedRecently bool
+	err := database.DB.QueryRow(`
+		SELECT `+database.StationPoolFilter+`, `+database.RecentlyPlayed+`
+		FROM songs s JOIN stations st ON st.id = $1
+		WHERE s.id = $2
+	`, station.ID, req.SongID).Scan(&inPool, &playedRecently)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking request for song %d on station %d: %v", req.SongID, station.ID, err)
+		http.Error(w, "Failed to submit request", http.StatusInternalServerError)
+		return
+	}
+	if !inPool {
+		http.Error(w, errNotInPool.Error(), http.StatusBadRequest)
+		return
+	}
+	// It would only wait in the queue until the repeat window has passed
+	if playedRecently {
+		http.Error(w, "This song played recently, request it again later", http.StatusConflict)
+		return
+	}
+
+	// The cooldown is checked by the insert itself, so two requests can't both pass it
+	var requestID int
+	err = database.DB.QueryRow(`
+		INSERT INTO song_requests (station_id, song_id, user_id, dedication)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM song_requests
+			WHERE user_id = $3 AND song_id = $2 AND status <> 'rejected'
+			  AND created_at >= NOW() - $5::interval
+		)
+		RETURNING id
+	`, station.ID, req.SongID, userID, req.Dedication, requestCooldown).Scan(&requestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "You already requested this song in the last "+requestCooldown, http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			http.Error(w, "You already have a pending request", http.StatusConflict)
+			return
+		}
+		log.Printf("Error saving request for song %d on station %d: %v", req.SongID, station.ID, err)
+		http.Error(w, "Failed to submit request", http.StatusInternalServerError)
+		return
+	}
+
+	// Dedications are always read by a moderator first
+	if station.AutoApproveRequests && req.Dedication == "" {
+		if err := approveRequest(requestID, 0); err != nil {
+			log.Printf("Warning: could not auto-approve request %d: %v", requestID, err)
+		} else {
+			notifyQueueUpdated(station.ID)
+		}
+	}
+
+	request, err := fetchSongRequest(requestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch request", http.StatusInternalServerError)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, request)
+}
+
+// GetStationRequests lists a station's requests, pending ones by default
+// (?status=approved|rejected|played for the others) (admin only)
+func GetStationRequests(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = database.RequestPending
+	case database.RequestPending, database.RequestApproved, database.RequestRejected, database.RequestPlayed:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.DB.Query(`SELECT `+requestColumns+requestJoins+`
+		WHERE r.station_id = $1 AND r.status = $2
+		ORDER BY r.created_at, r.id
+		LIMIT $3
+	`, station.ID, status, parseLimit(r, 100, 500))
+	if err != nil {
+		log.Printf("Error listing requests for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch requests", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	requests := []models.SongRequest{}
+	for rows.Next() {
+		request, err := scanSongRequest(rows)
+		if err != nil {
+			http.Error(w, "Failed to read requests", http.StatusInternalServerError)
+			return
+		}
+		requests = append(requests, request)
+	}
+	render.JSON(w, r, requests)
+}
+
+// ApproveRequest puts a pending request in the station queue (admin only)
+func ApproveRequest(w http.ResponseWriter, r *http.Request) {
+	moderateRequest(w, r, true)
+}
+
+// RejectRequest declines a pending request (admin only)
+func RejectRequest(w http.ResponseWriter, r *http.Request) {
+	moderateRequest(w, r, false)
+}
+
+func moderateRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	requestID, err := strconv.Atoi(chi.URLParam(r, "requestID"))
+	if err != nil {
+		http.Error(w, "Invalid request ID format", http.StatusBadRequest)
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	request, err := fetchSongRequest(requestID)
+	if err == sql.ErrNoRows || (err == nil && request.StationID != station.ID) {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch request", http.StatusInternalServerError)
+		return
+	}
+
+	if approve {
+		err = approveRequest(requestID, adminID)
+	} else {
+		err = rejectRequest(requestID, adminID)
+	}
+	if err == errRequestNotPending {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error moderating request %d: %v", requestID, err)
+		http.Error(w, "Failed to update request", http.StatusInternalServerError)
+		return
+	}
+	if approve {
+		notifyQueueUpdated(station.ID)
+	}
+
+	request, err = fetchSongRequest(requestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch request", http.StatusInternalServerError)
+		return
+	}
+	stationEvent, userEvent := websocket.EventRequestRejected, websocket.EventYourRequestRejected
+	if approve {
+		stationEvent, userEvent = websocket.EventRequestApproved, websocket.EventYourRequestApproved
+	}
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), stationEvent, websocket.RequestDecision{
+		StationID: station.ID,
+		RequestID: request.ID,
+		SongID:    request.SongID,
+		UserID:    request.UserID,
+	})
+	websocket.NotifyUser(request.UserID, userEvent, request)
+	render.JSON(w, r, request)
+}
+
+// approveRequest queues a pending request's song; adminID is 0 for auto-approval
+func approveRequest(requestID, adminID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stationID, songID, userID int
+	err = tx.QueryRow(
+		"SELECT station_id, song_id, user_id FROM song_requests WHERE id = $1 AND status = 'pending' FOR UPDATE", requestID,
+	).Scan(&stationID, &songID, &userID)
+	if err == sql.ErrNoRows {
+		return errRequestNotPending
+	} else if err != nil {
+		return err
+	}
+
+	var queueID int
+	err = tx.QueryRow(
+		"INSERT INTO station_queue (station_id, song_id, source, added_by) VALUES ($1, $2, 'request', $3) RETURNING id",
+		stationID, songID, userID,
+	).Scan(&queueID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE song_requests SET status = 'approved', queue_id = $1, decided_by = NULLIF($2, 0), decided_at = NOW()
+		WHERE id = $3
+	`, queueID, adminID, requestID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rejectRequest declines a pending request
+func rejectRequest(requestID, adminID int) error {
+	result, err := database.DB.Exec(`
+		UPDATE song_requests SET status = 'rejected', decided_by = $1, decided_at = NOW()
+		WHERE id = $2 AND status = 'pending'
+	`, adminID, requestID)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errRequestNotPending
+	}
+	return nil
+}
+
+// fetchSongRequest loads a request with its song and requester
+func fetchSongRequest(requestID int) (models.SongRequest, error) {
+	return scanSongRequest(database.DB.QueryRow(`SELECT `+requestColumns+requestJoins+` WHERE r.id = $1`, requestID))
+}
+
+// scanSongRequest scans a row selected with requestColumns
+func scanSongRequest(row interface{ Scan(...interface{}) error }) (models.SongRequest, error) {
+	var request models.SongRequest
+	var decidedAt, playedAt sql.NullTime
+	err := row.Scan(&request.ID, &request.StationID, &request.SongID, &request.Title, &request.Artist,
+		&request.UserID, &request.UserName, &request.Dedication, &request.Status, &request.CreatedAt,
+		&decidedAt, &playedAt)
+	if err != nil {
+		return request, err
+	}
+	if decidedAt.Valid {
+		request.DecidedAt = &decidedAt.Time
+	}
+	if playedAt.Valid {
+		request.PlayedAt = &playedAt.Time
+	}
+	return request, nil
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"groovegarden/database"
+)
+
+// requestSong asks the station for the song as the user and returns the status code
+func requestSong(t *testing.T, stationID, userID, songID int) int {
+	t.Helper()
+	body := strings.NewReader(`{"song_id": ` + strconv.Itoa(songID) + `}`)
+	r := httptest.NewRequest(http.MethodPost, "/stations/"+strconv.Itoa(stationID)+"/requests", body)
+	w := httptest.NewRecorder()
+	RequestSong(w, withRoute(r, userID, map[string]string{"id": strconv.Itoa(stationID)}))
+	return w.Code
+}
+
+func TestRequestCooldown(t *testing.T) {
+	openTestDB(t)
+	stationID := createTestStation(t)
+	userID := createTestUser(t)
+	songID := createTestSong(t)
+
+	setStatus := func(status string) {
+		t.Helper()
+		_, err := database.DB.Exec("UPDATE song_requests SET status = $1 WHERE user_id = $2", status, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name   string
+		before func()
+		want   int
+	}{
+		{"first request", func() {}, http.StatusCreated},
+		{"while it is pending", func() {}, http.StatusConflict},
+		{"after it played", func() { setStatus("played") }, http.StatusTooManyRequests},
+		{"after it was rejected", func() { setStatus("rejected") }, http.StatusCreated},
+		{"once the cooldown passed", func() {
+			setStatus("played")
+			_, err := database.DB.Exec(
+				"UPDATE song_requests SET created_at = NOW() - $1::interval - INTERVAL '1 minute' WHERE user_id = $2",
+				requestCooldown, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusCreated},
+	}
+	for _, step := range steps {
+		step.before()
+		if got := requestSong(t, stationID, userID, songID); got != step.want {
+			t.Fatalf("%s: got %d, want %d", step.name, got, step.want)
+		}
+	}
+}
+
+func TestRequestCooldownHoldsUnderConcurrentRequests(t *testing.T) {
+	openTestDB(t)
+	stationID := createTestStation(t)
+	userID := createTestUser(t)
+	songID := createTestSong(t)
+
+	const requests = 8
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- requestSong(t, stationID, userID, songID)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict, http.StatusTooManyRequests:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d requests created, want 1", created)
+	}
+}
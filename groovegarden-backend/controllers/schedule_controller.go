@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/playout"
+	"groovegarden/websocket"
+)
+
+// scheduleWindow is how far ahead GET /schedule looks
+const scheduleWindow = 7 * 24 * time.Hour
+
+// scheduleSlotRequest is the body of POST /stations/{id}/schedule
+type scheduleSlotRequest struct {
+	Name            string `json:"name"`
+	DaysOfWeek      []int  `json:"days_of_week"`
+	StartTime       string `json:"start_time"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Rule            string `json:"rule"`
+	PlaylistID      *int   `json:"playlist_id"`
+	Tag             string `json:"tag"`
+	ArtistID        *int   `json:"artist_id"`
+}
+
+// GetSchedule returns a station's programme for the next 7 days, computed in
+// its timezone. Defaults to the main station; pick another with ?station=ID.
+func GetSchedule(w http.ResponseWriter, r *http.Request) {
+	var station models.Station
+	var err error
+	if param := r.URL.Query().Get("station"); param != "" {
+		stationID, convErr := strconv.Atoi(param)
+		if convErr != nil {
+			http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+			return
+		}
+		station, err = database.GetStation(stationID)
+	} else {
+		station, err = database.GetStationBySlug(database.DefaultStationSlug)
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error loading station for schedule: %v", err)
+		http.Error(w, "Failed to fetch station", http.StatusInternalServerError)
+		return
+	}
+
+	slots, err := database.ListScheduleSlots(station.ID)
+	if err != nil {
+		log.Printf("Error loading schedule for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch schedule", http.StatusInternalServerError)
+		return
+	}
+
+	loc := playout.StationLocation(station)
+	now := time.Now().In(loc)
+	render.JSON(w, r, map[string]interface{}{
+		"station_id": station.ID,
+		"timezone":   loc.String(),
+		"from":       now,
+		"to":         now.Add(scheduleWindow),
+		"slots":      playout.Occurrences(slots, loc, now, now.Add(scheduleWindow)),
+	})
+}
+
+// GetStationSchedule lists a station's recurring slot definitions
+func GetStationSchedule(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	slots, err := database.ListScheduleSlots(station.ID)
+	if err != nil {
+		log.Printf("Error loading schedule for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch schedule", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, slots)
+}
+
+// CreateScheduleSlot adds a recurring slot to a station's weekly grid (admin only)
+func CreateScheduleSlot(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	var req scheduleSlotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateScheduleSlot(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var tag *string
+	if req.Tag != "" {
+		tag = &req.Tag
+	}
+
+	var slotID int
+	err := database.DB.QueryRow(`
+		INSERT INTO schedule_slots (station_id, name, days_of_week, start_time, duration_minutes, rule, playlist_id, tag, artist_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, station.ID, req.Name, pq.Array(req.DaysOfWeek), req.StartTime, req.DurationMinutes, req.Rule,
+		req.PlaylistID, tag, req.ArtistID).Scan(&slotID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			http.Error(w, "Playlist or artist not found", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error creating schedule slot on station %d: %v", station.ID, err)
+		http.Error(w, "Failed to create schedule slot", http.StatusInternalServerError)
+		return
+	}
+
+	slot := models.ScheduleSlot{
+		ID:              slotID,
+		StationID:       station.ID,
+		Name:            req.Name,
+		DaysOfWeek:      req.DaysOfWeek,
+		StartTime:       req.StartTime,
+		DurationMinutes: req.DurationMinutes,
+		Rule:            req.Rule,
+		PlaylistID:      req.PlaylistID,
+		Tag:             req.Tag,
+		ArtistID:        req.ArtistID,
+	}
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventScheduleUpdated, websocket.StationRef{StationID: station.ID})
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, slot)
+}
+
+// DeleteScheduleSlot removes a slot from a station's grid (admin only)
+func DeleteScheduleSlot(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	slotID, err := strconv.Atoi(chi.URLParam(r, "slotID"))
+	if err != nil {
+		http.Error(w, "Invalid slot ID format", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM schedule_slots WHERE id = $1 AND station_id = $2", slotID, station.ID)
+	if err != nil {
+		log.Printf("Error deleting schedule slot %d: %v", slotID, err)
+		http.Error(w, "Failed to delete schedule slot", http.StatusInternalServerError)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		http.Error(w, "Schedule slot not found", http.StatusNotFound)
+		return
+	}
+
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventScheduleUpdated, websocket.StationRef{StationID: station.ID})
+	render.JSON(w, r, map[string]string{"message": "Schedule slot deleted"})
+}
+
+// validateScheduleSlot checks a slot request and normalizes its fields
+func validateScheduleSlot(req *scheduleSlotRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("slot name is required")
+	}
+
+	if len(req.DaysOfWeek) == 0 {
+		return fmt.Errorf("days_of_week must list at least one day (0 = Sunday ... 6 = Saturday)")
+	}
+	seen := make(map[int]bool)
+	days := []int{}
+	for _, day := range req.DaysOfWeek {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("days_of_week values must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	req.DaysOfWeek = days
+
+	start, err := time.Parse("15:04", req.StartTime)
+	if err != nil {
+		return fmt.Errorf("start_time must be HH:MM")
+	}
+	req.StartTime = start.Format("15:04")
+
+	if req.DurationMinutes < 1 || req.DurationMinutes > 1440 {
+		return fmt.Errorf("duration_minutes must be between 1 and 1440")
+	}
+
+	// Only keep the field the rule uses
+	switch req.Rule {
+	case database.RuleVotes:
+		req.PlaylistID, req.Tag, req.ArtistID = nil, "", nil
+	case database.RulePlaylist:
+		if req.PlaylistID == nil {
+			return fmt.Errorf("playlist_id is required for playlist slots")
+		}
+		req.Tag, req.ArtistID = "", nil
+	case database.RuleGenre:
+		req.Tag = normalizeTagName(req.Tag)
+		if req.Tag == "" {
+			return fmt.Errorf("tag is required for genre slots")
+		}
+		req.PlaylistID, req.ArtistID = nil, nil
+	case database.RuleLive:
+		if req.ArtistID == nil {
+			return fmt.Errorf("artist_id is required for live slots")
+		}
+		req.PlaylistID, req.Tag = nil, ""
+	default:
+		return fmt.Errorf("rule must be one of votes, playlist, genre or live")
+	}
+	return nil
+}
+
+// CreatePlaylist creates an ordered playlist for schedule slots (admin only)
+func CreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(int)
+
+	var req struct {
+		Name    string `json:"name"`
+		SongIDs []int  `json:"song_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Playlist name is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create playlist", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var playlistID int
+	err = tx.QueryRow("INSERT INTO playlists (name, created_by) VALUES ($1, $2) RETURNING id", req.Name, userID).Scan(&playlistID)
+	if err != nil {
+		log.Printf("Error creating playlist: %v", err)
+		http.Error(w, "Failed to create playlist", http.StatusInternalServerError)
+		return
+	}
+	for i, songID := range req.SongIDs {
+		_, err := tx.Exec("INSERT INTO playlist_tracks (playlist_id, position, song_id) VALUES ($1, $2, $3)", playlistID, i+1, songID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+				http.Error(w, fmt.Sprintf("Song %d not found", songID), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error adding song %d to playlist %d: %v", songID, playlistID, err)
+			http.Error(w, "Failed to create playlist", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create playlist", http.StatusInternalServerError)
+		return
+	}
+
+	playlist, err := fetchPlaylist(playlistID)
+	if err != nil {
+		http.Error(w, "Failed to fetch playlist", http.StatusInternalServerError)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, playlist)
+}
+
+// ListPlaylists returns all playlists without their tracks (admin only)
+func ListPlaylists(w http.ResponseWriter, r *http.Request) {
+	rows, err := database.DB.Query("SELECT id, name, created_by, created_at FROM playlists ORDER BY name, id")
+	if err != nil {
+		log.Printf("Error listing playlists: %v", err)
+		http.Error(w, "Failed to fetch playlists", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	playlists := []models.Playlist{}
+	for rows.Next() {
+		var playlist models.Playlist
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&playlist.ID, &playlist.Name, &createdBy, &playlist.CreatedAt); err != nil {
+			http.Error(w, "Failed to read playlists", http.StatusInternalServerError)
+			return
+		}
+		playlist.CreatedBy = database.NullIntPtr(createdBy)
+		playlists = append(playlists, playlist)
+	}
+	render.JSON(w, r, playlists)
+}
+
+// GetPlaylist returns a playlist with its tracks in play order (admin only)
+func GetPlaylist(w http.ResponseWriter, r *http.Request) {
+	playlistID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid playlist ID format", http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := fetchPlaylist(playlistID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error loading playlist %d: %v", playlistID, err)
+		http.Error(w, "Failed to fetch playlist", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, playlist)
+}
+
+// fetchPlaylist loads a playlist and its tracks
+func fetchPlaylist(playlistID int) (models.Playlist, error) {
+	var playlist models.Playlist
+	var createdBy sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT id, name, created_by, created_at FROM playlists WHERE id = $1", playlistID,
+	).Scan(&playlist.ID, &playlist.Name, &createdBy, &playlist.CreatedAt)
+	if err != nil {
+		return playlist, err
+	}
+	playlist.CreatedBy = database.NullIntPtr(createdBy)
+
+	rows, err := database.DB.Query(
+		"SELECT song_id FROM playlist_tracks WHERE playlist_id = $1 ORDER BY position", playlistID,
+	)
+	if err != nil {
+		return playlist, err
+	}
+	var songIDs []int
+	for rows.Next() {
+		var songID int
+		if err := rows.Scan(&songID); err != nil {
+			rows.Close()
+			return playlist, err
+		}
+		songIDs = append(songIDs, songID)
+	}
+	rows.Close()
+
+	playlist.Tracks = []models.Song{}
+	for _, songID := range songIDs {
+		song, err := database.GetSong(songID)
+		if err != nil {
+			return playlist, err
+		}
+		playlist.Tracks = append(playlist.Tracks, song)
+	}
+	return playlist, nil
+}
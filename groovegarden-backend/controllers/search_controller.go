@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/render"
+
+	"groovegarden/database"
+)
+
+// highlightOptions wraps matched terms so the client can style them
+const highlightOptions = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+
+// SongSearchResult is a single song match returned by Search
+type SongSearchResult struct {
+	ID              int     `json:"id"`
+	Title           string  `json:"title"`
+	Artist          string  `json:"artist"`
+	ArtistID        *int    `json:"artist_id,omitempty"`
+	Duration        int     `json:"duration"`
+	Votes           int     `json:"votes"`
+	TitleHighlight  string  `json:"title_highlight"`
+	ArtistHighlight string  `json:"artist_highlight"`
+	Rank            float64 `json:"rank"`
+}
+
+// ArtistSearchResult is a single artist match returned by Search
+type ArtistSearchResult struct {
+	ArtistID  *int    `json:"artist_id,omitempty"`
+	Name      string  `json:"name"`
+	Highlight string  `json:"highlight"`
+	SongCount int     `json:"song_count"`
+	Rank      float64 `json:"rank"`
+}
+
+// Suggestion is a single autocomplete entry
+type Suggestion struct {
+	Kind string `json:"kind"` // 'song' or 'artist'
+	ID   *int   `json:"id,omitempty"`
+	Text string `json:"text"`
+}
+
+// Search runs a ranked full-text search over songs and artists
+func Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := parseLimit(r, 20, 50)
+
+	songs, err := searchSongs(query, limit)
+	if err != nil {
+		log.Printf("Song search failed for %q: %v", query, err)
+		http.Error(w, "Failed to search songs", http.StatusInternalServerError)
+		return
+	}
+
+	artists, err := searchArtists(query, limit)
+	if err != nil {
+		log.Printf("Artist search failed for %q: %v", query, err)
+		http.Error(w, "Failed to search artists", http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"query":   query,
+		"songs":   songs,
+		"artists": artists,
+	})
+}
+
+// Autocomplete returns prefix matches for the search box as the user types
+func Autocomplete(w http.ResponseWriter, r *http.Request) {
+	prefix := buildPrefixQuery(r.URL.Query().Get("q"))
+	if prefix == "" {
+		render.JSON(w, r, []Suggestion{})
+		return
+	}
+
+	raw := strings.TrimSpace(r.URL.Query().Get("q"))
+	limit := parseLimit(r, 8, 20)
+
+	rows, err := database.DB.Query(`
+		WITH q AS (SELECT to_tsquery('simple', $1) AS query)
+		SELECT kind, id, text FROM (
+			SELECT 'song' AS kind, s.id AS id, s.title AS text,
+			       ts_rank(to_tsvector('simple', s.title), q.query) + word_similarity($2, s.title) AS rank
+			FROM songs s, q
+			WHERE to_tsvector('simple', s.title) @@ q.query OR $2 <% s.title
+			UNION ALL
+			SELECT 'artist', u.id, u.name,
+			       ts_rank(to_tsvector('simple', u.name), q.query) + word_similarity($2, u.name)
+			FROM users u, q
+			WHERE u.account_type = 'artist'
+			  AND (to_tsvector('simple', u.name) @@ q.query OR $2 <% u.name)
+		) matches
+		ORDER BY rank DESC, text
+		LIMIT $3
+	`, prefix, raw, limit)
+	if err != nil {
+		log.Printf("Autocomplete failed for %q: %v", raw, err)
+		http.Error(w, "Failed to load suggestions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		var id sql.NullInt64
+		if err := rows.Scan(&s.Kind, &id, &s.Text); err != nil {
+			http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.ID = database.NullIntPtr(id)
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("Error iterating over rows: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, suggestions)
+}
+
+// searchSongs ranks songs by full-text relevance, falling back to trigram
+// similarity so misspelt titles and artist names still match
+func searchSongs(query string, limit int) ([]SongSearchResult, error) {
+	rows, err := database.DB.Query(`
+		WITH q AS (SELECT websearch_to_tsquery('simple', $1) AS query)
+		SELECT s.id, s.title, COALESCE(s.artist, u.name, 'Unknown') AS artist, s.artist_id,
+		       s.duration, s.votes,
+		       ts_headline('simple', s.title, q.query, $3),
+		       ts_headline('simple', COALESCE(s.artist, u.name, 'Unknown'), q.query, $3),
+		       ts_rank(s.search_vector, q.query)
+		         + GREATEST(word_similarity($1, s.title), word_similarity($1, COALESCE(s.artist, u.name, ''))) AS rank
+		FROM songs s
+		LEFT JOIN users u ON s.artist_id = u.id, q
+		WHERE s.search_vector @@ q.query
+		   OR $1 <% s.title
+		   OR $1 <% COALESCE(s.artist, u.name, '')
+		ORDER BY rank DESC, `+database.SongRankExpr+` DESC
+		LIMIT $2
+	`, query, limit, highlightOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SongSearchResult{}
+	for rows.Next() {
+		var song SongSearchResult
+		var artistID sql.NullInt64
+		err := rows.Scan(&song.ID, &song.Title, &song.Artist, &artistID, &song.Duration, &song.Votes,
+			&song.TitleHighlight, &song.ArtistHighlight, &song.Rank)
+		if err != nil {
+			return nil, err
+		}
+		song.ArtistID = database.NullIntPtr(artistID)
+		results = append(results, song)
+	}
+	return results, rows.Err()
+}
+
+// searchArtists matches both registered artist accounts and the free-text
+// artist credits on songs, grouped so each name appears once per account
+func searchArtists(query string, limit int) ([]ArtistSearchResult, error) {
+	rows, err := database.DB.Query(`
+		WITH q AS (SELECT websearch_to_tsquery('simple', $1) AS query),
+		artists AS (
+			SELECT u.id AS artist_id, u.name
+			FROM users u
+			WHERE u.account_type = 'artist'
+			UNION
+			SELECT s.artist_id, s.artist
+			FROM songs s
+			WHERE COALESCE(s.artist, '') NOT IN ('', 'Unknown Artist')
+		)
+		SELECT a.artist_id, a.name,
+		       ts_headline('simple', a.name, q.query, $3),
+		       (SELECT COUNT(*) FROM songs s
+		        WHERE s.artist = a.name OR (s.artist_id = a.artist_id AND s.artist IS NULL)) AS song_count,
+		       ts_rank(to_tsvector('simple', a.name), q.query) + word_similarity($1, a.name) AS rank
+		FROM artists a, q
+		WHERE to_tsvector('simple', a.name) @@ q.query OR $1 <% a.name
+		ORDER BY rank DESC, song_count DESC
+		LIMIT $2
+	`, query, limit, highlightOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []ArtistSearchResult{}
+	for rows.Next() {
+		var artist ArtistSearchResult
+		var artistID sql.NullInt64
+		if err := rows.Scan(&artistID, &artist.Name, &artist.Highlight, &artist.SongCount, &artist.Rank); err != nil {
+			return nil, err
+		}
+		artist.ArtistID = database.NullIntPtr(artistID)
+		results = append(results, artist)
+	}
+	return results, rows.Err()
+}
+
+// buildPrefixQuery turns free text into a tsquery where every word must match
+// and the last word is treated as a prefix, e.g. "summer vi" -> "summer & vi:*"
+func buildPrefixQuery(input string) string {
+	words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
+}
+
+// parseLimit reads the "limit" query parameter, clamped to max
+func parseLimit(r *http.Request, def, max int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return def
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import "testing"
+
+func TestBuildPrefixQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"only punctuation", "  !?&|  ", ""},
+		{"one word", "summer", "summer:*"},
+		{"last word is a prefix", "summer vi", "summer & vi:*"},
+		{"lowercased", "Summer VIBES", "summer & vibes:*"},
+		{"extra spaces", "  summer   vibes  ", "summer & vibes:*"},
+		{"tsquery operators stripped", "rock & !roll | (live)", "rock & roll & live:*"},
+		{"prefix syntax stripped", "vi:* a:b", "vi & a & b:*"},
+		{"quotes stripped", `it's "live"`, "it & s & live:*"},
+		{"digits kept", "track 2", "track & 2:*"},
+		{"non-latin letters kept", "Sigur Rós Ágætis", "sigur & rós & ágætis:*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildPrefixQuery(tt.input); got != tt.want {
+				t.Errorf("buildPrefixQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"groovegarden/database"
+	"groovegarden/listeners"
+	"groovegarden/models"
+	"groovegarden/playout"
+	"groovegarden/websocket"
+)
+
+var (
+	errNothingToSkip    = errors.New("Nothing to skip right now")
+	errAlreadySkipVoted = errors.New("You already voted to skip this song")
+)
+
+// skipResult is where a skip vote left the song on air
+type skipResult struct {
+	PlayID  int  `json:"play_id"`
+	Votes   int  `json:"votes"`
+	Needed  int  `json:"needed"`
+	Skipped bool `json:"skipped"`
+}
+
+// VoteToSkip casts the caller's skip vote against the song on air. Once
+// enough listeners agree, the playout fades it out and moves on.
+func VoteToSkip(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := castSkipVote(station, userID)
+	switch {
+	case err == errNothingToSkip || err == errAlreadySkipVoted:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error recording skip vote on station %d: %v", station.ID, err)
+		http.Error(w, "Failed to record skip vote", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, result)
+}
+
+// castSkipVote records a skip vote against the song on air and starts the
+// skip once the threshold is reached
+func castSkipVote(station models.Station, userID int) (skipResult, error) {
+	playID := playout.CurrentPlay(station.ID)
+	if playID == 0 {
+		return skipResult{}, errNothingToSkip
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO skip_votes (play_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", playID, userID,
+	)
+	if err != nil {
+		return skipResult{}, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return skipResult{}, errAlreadySkipVoted
+	}
+
+	var songID, votes int
+	err = database.DB.QueryRow(
+		"SELECT COALESCE(p.song_id, 0), (SELECT COUNT(*) FROM skip_votes v WHERE v.play_id = p.id) FROM plays p WHERE p.id = $1", playID,
+	).Scan(&songID, &votes)
+	if err != nil {
+		return skipResult{}, err
+	}
+	needed := skipVotesNeeded(station, listeners.Current(station.ID).Listeners)
+
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventSkipVote, websocket.SkipVote{
+		StationID: station.ID,
+		PlayID:    playID,
+		SongID:    songID,
+		Votes:     votes,
+		Needed:    needed,
+	})
+
+	skipped := votes >= needed && playout.Skip(station.ID, playID)
+	if skipped {
+		// Skips count against the song wherever it is ranked
+		if _, err := database.DB.Exec("UPDATE songs SET skips = skips + 1 WHERE id = $1", songID); err != nil {
+			log.Printf("Warning: failed to update skip count for song %d: %v", songID, err)
+		}
+		log.Printf("Station %d: song %d skipped by %d vote(s)", station.ID, songID, votes)
+		websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventTrackSkipped, websocket.TrackSkipped{
+			StationID: station.ID,
+			PlayID:    playID,
+			SongID:    songID,
+			Votes:     votes,
+		})
+	}
+
+	return skipResult{PlayID: playID, Votes: votes, Needed: needed, Skipped: skipped}, nil
+}
+
+// skipVotesNeeded is the skip threshold for a station's current audience:
+// skip_ratio of the listeners, but never fewer than skip_min_votes
+func skipVotesNeeded(station models.Station, listenerCount int) int {
+	needed := int(math.Ceil(station.SkipRatio * float64(listenerCount)))
+	if needed < station.SkipMinVotes {
+		needed = station.SkipMinVotes
+	}
+	return needed
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"testing"
+
+	"groovegarden/models"
+)
+
+func TestSkipVotesNeeded(t *testing.T) {
+	tests := []struct {
+		name      string
+		ratio     float64
+		minVotes  int
+		listeners int
+		want      int
+	}{
+		{"nobody listening", 0.5, 3, 0, 3},
+		{"minimum above the ratio", 0.5, 3, 4, 3},
+		{"ratio of the audience", 0.5, 3, 10, 5},
+		{"rounds up", 0.5, 3, 11, 6},
+		{"small ratio rounds up to one", 0.1, 0, 3, 1},
+		{"whole audience", 1, 1, 7, 7},
+		{"no minimum", 0.5, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			station := models.Station{SkipRatio: tt.ratio, SkipMinVotes: tt.minVotes}
+			if got := skipVotesNeeded(station, tt.listeners); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/reactions"
+	"groovegarden/websocket"
+)
+
+// RegisterWebSocketCommands lets websocket clients vote, skip-vote, chat,
+// react and control listening parties without a separate HTTP request, and
+// opens party topics to their members
+func RegisterWebSocketCommands() {
+	websocket.HandleCommand("vote", voteCommand)
+	websocket.HandleCommand("skip_vote", skipVoteCommand)
+	websocket.HandleCommand("chat", chatCommand)
+	websocket.HandleCommand("party_control", partyControlCommand)
+	websocket.HandleCommand("react", reactCommand)
+
+	websocket.AuthorizeTopics("party", func(user websocket.Identity, partyID int) (bool, error) {
+		return database.IsPartyMember(partyID, user.UserID)
+	})
+}
+
+// voteCommand: {"station_id", "song_id", "boost"} -> {"round", "votes"}
+func voteCommand(user websocket.Identity, data json.RawMessage) (interface{}, error) {
+	var req struct {
+		StationID int `json:"station_id"`
+		SongID    int `json:"song_id"`
+		Boost     int `json:"boost"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.StationID == 0 || req.SongID == 0 {
+		return nil, websocket.NewCommandError(websocket.ErrCodeBadRequest, "station_id and song_id are required")
+	}
+	if req.Boost < 0 || req.Boost > maxVoteBoost {
+		return nil, websocket.NewCommandError(websocket.ErrCodeBadRequest, "boost is out of range")
+	}
+
+	round, tally, err := castStationVote(req.StationID, req.SongID, user.UserID, req.Boost)
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return map[string]int{"round": round, "votes": tally}, nil
+}
+
+// skipVoteCommand: {"station_id"} -> {"play_id", "votes", "needed", "skipped"}
+func skipVoteCommand(user websocket.Identity, data json.RawMessage) (interface{}, error) {
+	station, err := commandStation(data)
+	if err != nil {
+		return nil, err
+	}
+	result, err := castSkipVote(station, user.UserID)
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return result, nil
+}
+
+// chatCommand: {"station_id", "text"} -> the chat message as sent
+func chatCommand(user websocket.Identity, data json.RawMessage) (interface{}, error) {
+	var req struct {
+		StationID int    `json:"station_id"`
+		Text      string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.StationID == 0 {
+		return nil, websocket.NewCommandError(websocket.ErrCodeBadRequest, "station_id is required")
+	}
+	if _, err := database.GetStation(req.StationID); err != nil {
+		return nil, commandError(err)
+	}
+
+	msg, err := postChatMessage(req.StationID, user.UserID, req.Text)
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return msg, nil
+}
+
+// partyControlCommand: {"party_id", "action", "song_id", "position_ms"} -> the new models.PartyState
+func partyControlCommand(user websocket.Identity, data json.RawMessage) (interface{}, error) {
+	var req struct {
+		PartyID int `json:"party_id"`
+		partyControl
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.PartyID == 0 {
+		return nil, websocket.NewCommandError(websocket.ErrCodeBadRequest, "party_id is required")
+	}
+
+	state, err := controlParty(req.PartyID, user.UserID, req.partyControl)
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return state, nil
+}
+
+// reactCommand: {"station_id", "reaction"} -> {"counted"}, false when the
+// listener already sent that reaction to the song on air
+func reactCommand(user websocket.Identity, data json.RawMessage) (interface{}, error) {
+	var req struct {
+		StationID int    `json:"station_id"`
+		Reaction  string `json:"reaction"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.StationID == 0 {
+		return nil, websocket.NewCommandError(websocket.ErrCodeBadRequest, "station_id is required")
+	}
+
+	counted, err := reactions.React(req.StationID, user.UserID, req.Reaction)
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return map[string]bool{"counted": counted}, nil
+}
+
+// commandStation loads the station named by a command's station_id
+func commandStation(data json.RawMessage) (models.Station, error) {
+	var req struct {
+		StationID int `json:"station_id"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.StationID == 0 {
+		return models.Station{}, websocket.NewCommandError(websocket.ErrCodeBadRequest, "station_id is required")
+	}
+	station, err := database.GetStation(req.StationID)
+	if err != nil {
+		return station, commandError(err)
+	}
+	return station, nil
+}
+
+// commandError turns the errors shared with the HTTP handlers into error replies;
+// anything else is reported as an internal error
+func commandError(err error) error {
+	var rejection ChatRejection
+	var restricted chatRestrictedError
+	switch {
+	case errors.As(err, &rejection):
+		return websocket.NewCommandError(websocket.ErrCodeBadRequest, err.Error())
+	case errors.As(err, &restricted):
+		return websocket.NewCommandError(websocket.ErrCodeForbidden, err.Error())
+	}
+
+	switch err {
+	case sql.ErrNoRows:
+		return websocket.NewCommandError(websocket.ErrCodeNotFound, "Station not found")
+	case errAlreadyVoted, errAlreadySkipVoted, errNothingToSkip, database.ErrInsufficientCredits, reactions.ErrNothingPlaying:
+		return websocket.NewCommandError(websocket.ErrCodeConflict, err.Error())
+	case errNotInPool, errEmptyChat, errChatTooLong:
+		return websocket.NewCommandError(websocket.ErrCodeBadRequest, err.Error())
+	case errPartyNotFound:
+		return websocket.NewCommandError(websocket.ErrCodeNotFound, err.Error())
+	case errNotPartyHost:
+		return websocket.NewCommandError(websocket.ErrCodeForbidden, err.Error())
+	case errNoPartySong:
+		return websocket.NewCommandError(websocket.ErrCodeConflict, err.Error())
+	case errUnknownAction, errSongNotPlayable, reactions.ErrUnknownReaction:
+		return websocket.NewCommandError(websocket.ErrCodeBadRequest, err.Error())
+	case errChatRateLimited:
+		return websocket.NewCommandError(websocket.ErrCodeRateLimited, err.Error())
+	}
+	return err
+}
@@ -8,11 +8,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/lib/pq"
 
 	"groovegarden/database"
 	"groovegarden/models"
@@ -28,14 +30,22 @@ func GetSongs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optional ?tag= filters (repeatable, all must match) against genres, moods and free tags
+	tagFilter := normalizeTags(r.URL.Query()["tag"])
+
 	// Simple query that should work with our initialized schema
 	rows, err := db.Query(`
 		SELECT s.id, s.title, COALESCE(s.artist, u.name, 'Unknown') as artist, 
-		       s.duration, s.upload_date, s.votes, s.storage_path, s.artist_id
+		       s.duration, s.upload_date, s.votes, s.skips, s.storage_path, s.artist_id,
+		       s.explicit, `+database.SongTaxonomyColumns+`
 		FROM songs s
 		LEFT JOIN users u ON s.artist_id = u.id
-		ORDER BY s.votes DESC
-	`)
+		WHERE cardinality($1::text[]) = 0 OR (
+			SELECT COUNT(DISTINCT t.name) FROM song_tags st JOIN tags t ON t.id = st.tag_id
+			WHERE st.song_id = s.id AND t.name = ANY($1)
+		) = cardinality($1::text[])
+		ORDER BY `+database.SongRankExpr+` DESC, s.skips
+	`, pq.Array(tagFilter))
 	
 	if (err != nil) {
 		http.Error(w, fmt.Sprintf("Error querying database: %v", err), http.StatusInternalServerError)
@@ -51,11 +61,16 @@ func GetSongs(w http.ResponseWriter, r *http.Request) {
 		var artist sql.NullString
 		var storagePath sql.NullString
 		var artistID sql.NullInt64
-		var duration, votes int
+		var duration, votes, skips int
 		var uploadDate sql.NullString
+		var genre sql.NullString
+		moods := []string{}
+		tags := []string{}
+		var explicit bool
 
 		// Scan the row into our variables
-		err := rows.Scan(&id, &title, &artist, &duration, &uploadDate, &votes, &storagePath, &artistID)
+		err := rows.Scan(&id, &title, &artist, &duration, &uploadDate, &votes, &skips, &storagePath, &artistID,
+			&explicit, &genre, pq.Array(&moods), pq.Array(&tags))
 		if (err != nil) {
 			http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
 			return
@@ -66,6 +81,11 @@ func GetSongs(w http.ResponseWriter, r *http.Request) {
 			"id":       id,
 			"duration": duration,
 			"votes":    votes,
+			"skips":    skips,
+			"genre":    genre.String,
+			"moods":    moods,
+			"tags":     tags,
+			"explicit": explicit,
 		}
 		
 		// Handle potentially NULL values
@@ -127,7 +147,8 @@ func AddSong(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Decoded Song: %+v\n", song)
 
 	// Changed from song.FilePath to song.StoragePath
-	_, err = database.DB.Exec("INSERT INTO songs (title, storage_path, votes) VALUES ($1, $2, 0)", song.Title, song.StoragePath)
+	var songID int
+	err = database.DB.QueryRow("INSERT INTO songs (title, storage_path, votes) VALUES ($1, $2, 0) RETURNING id", song.Title, song.StoragePath).Scan(&songID)
 	if (err != nil) {
 		fmt.Printf("Error inserting into DB: %v\n", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -142,8 +163,38 @@ func AddSong(w http.ResponseWriter, r *http.Request) {
 func VoteForSong(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	// Update the song's vote count
-	_, err := database.DB.Exec("UPDATE songs SET votes = votes + 1 WHERE id = $1", id)
+	boost, err := parseBoost(r)
+	if (err != nil) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Legacy votes also count toward the default station's current round. A boost
+	// only weighs there, so a vote whose boost can't be applied is turned down.
+	if songID, err := strconv.Atoi(id); err == nil {
+		userID, _ := r.Context().Value("user_id").(int)
+		station, err := database.GetStationBySlug(database.DefaultStationSlug)
+		if (err == nil) {
+			_, _, err = recordStationVote(station.ID, songID, userID, boost)
+		}
+		if (err == database.ErrInsufficientCredits) {
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+			return
+		} else if (err != nil && boost > 0) {
+			if (err == errAlreadyVoted || err == errNotInPool) {
+				http.Error(w, "Boost not applied: "+err.Error(), http.StatusConflict)
+			} else {
+				log.Printf("Error applying vote boost for song %d: %v", songID, err)
+				http.Error(w, "Failed to apply the vote boost", http.StatusInternalServerError)
+			}
+			return
+		} else if (err != nil && err != errAlreadyVoted && err != errNotInPool) {
+			log.Printf("Warning: failed to record station vote for song %d: %v", songID, err)
+		}
+	}
+
+	// Update the song's vote count, which counts each vote once whatever its boost
+	_, err = database.DB.Exec("UPDATE songs SET votes = votes + 1 WHERE id = $1", id)
 	if (err != nil) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -158,7 +209,7 @@ func VoteForSong(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Notify clients about the vote
-	websocket.NotifyClients("vote_cast", song)
+	websocket.NotifyTopic(websocket.SongTopic(song.ID), websocket.EventVoteCast, song)
 	render.JSON(w, r, map[string]string{"message": "Vote counted"})
 }
 
@@ -203,16 +254,7 @@ func UploadSong(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// Validate file type based on filename extension
-	allowedExtensions := []string{".mp3", ".aac"}
-	isValidFile := false
-	for _, ext := range allowedExtensions {
-		if (len(handler.Filename) > len(ext) && handler.Filename[len(handler.Filename)-len(ext):] == ext) {
-			isValidFile = true
-			break
-		}
-	}
-
-	if (!isValidFile) {
+	if (!isAllowedAudioFile(handler.Filename)) {
 		http.Error(w, "Invalid file type. Only MP3 and AAC files are allowed.", http.StatusBadRequest)
 		return
 	}
@@ -262,15 +304,21 @@ func UploadSong(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save song metadata to the database
-	_, err = database.DB.Exec(
-		"INSERT INTO songs (title, artist, storage_path, votes, duration, artist_id) VALUES ($1, $2, $3, 0, $4, $5)",
+	var songID int
+	err = database.DB.QueryRow(
+		"INSERT INTO songs (title, artist, storage_path, votes, duration, artist_id) VALUES ($1, $2, $3, 0, $4, $5) RETURNING id",
 		title, artist, filePath, duration, userID,
-	)
+	).Scan(&songID)
 	if (err != nil) {
 		http.Error(w, "Failed to save song metadata", http.StatusInternalServerError)
 		return
 	}
 
+	// Classification is optional at upload time; a bad genre or mood doesn't fail the upload
+	if err := setSongTaxonomy(database.DB, songID, taxonomyFromForm(r)); err != nil {
+		log.Printf("Warning: could not classify song %d: %v", songID, err)
+	}
+
 	// Log successful upload
 	log.Printf("Song uploaded successfully by user_id %d: %s (stored at %s), duration: %d seconds", userID, title, filePath, duration)
 	render.JSON(w, r, map[string]string{"message": "Song uploaded successfully", "file_path": filePath})
@@ -396,3 +444,331 @@ func DebugFileAccess(w http.ResponseWriter, r *http.Request) {
 		"header":     fmt.Sprintf("%x", header[:n]),
 	})
 }
+
+// songUpdateRequest holds the editable fields of a song; nil fields are left unchanged
+type songUpdateRequest struct {
+	songTaxonomy
+	Title    *string `json:"title"`
+	Artist   *string `json:"artist"`
+	Explicit *bool   `json:"explicit"`
+}
+
+// UpdateSong edits a song's metadata (owning artist or admin only)
+func UpdateSong(w http.ResponseWriter, r *http.Request) {
+	songID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if (err != nil) {
+		http.Error(w, "Invalid song ID format", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeSongOwner(w, r, songID); !ok {
+		return
+	}
+
+	var req songUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Build the SET clause from the fields that were provided
+	setClauses := []string{}
+	args := []interface{}{}
+	addSet := func(column string, value interface{}) {
+		args = append(args, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if (req.Title != nil) {
+		title := strings.TrimSpace(*req.Title)
+		if (title == "") {
+			http.Error(w, "Title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		addSet("title", title)
+	}
+	if (req.Artist != nil) {
+		// An empty credit clears it (NULL), so the uploader's name is shown instead
+		artist := sql.NullString{String: strings.TrimSpace(*req.Artist)}
+		artist.Valid = artist.String != ""
+		addSet("artist", artist)
+	}
+	if (req.Explicit != nil) {
+		addSet("explicit", *req.Explicit)
+	}
+
+	if (len(setClauses) == 0 && req.songTaxonomy.empty()) {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if (err != nil) {
+		http.Error(w, "Database connection error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	args = append(args, songID)
+	setClauses = append(setClauses, "updated_at = NOW()")
+	query := fmt.Sprintf("UPDATE songs SET %s WHERE id = $%d", strings.Join(setClauses, ", "), len(args))
+	if _, err := tx.Exec(query, args...); err != nil {
+		log.Printf("Error updating song %d: %v", songID, err)
+		http.Error(w, "Failed to update song", http.StatusInternalServerError)
+		return
+	}
+
+	if err := setSongTaxonomy(tx, songID, req.songTaxonomy); err != nil {
+		if isTaxonomyInputError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error classifying song %d: %v", songID, err)
+		http.Error(w, "Failed to update song", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing update for song %d: %v", songID, err)
+		http.Error(w, "Failed to update song", http.StatusInternalServerError)
+		return
+	}
+
+	song, err := database.GetSong(songID)
+	if (err != nil) {
+		http.Error(w, "Failed to fetch updated song", http.StatusInternalServerError)
+		return
+	}
+
+	websocket.NotifyTopic(websocket.SongTopic(song.ID), websocket.EventSongUpdated, song)
+	render.JSON(w, r, song)
+}
+
+// DeleteSong removes a song and its stored file (owning artist or admin only)
+func DeleteSong(w http.ResponseWriter, r *http.Request) {
+	songID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if (err != nil) {
+		http.Error(w, "Invalid song ID format", http.StatusBadRequest)
+		return
+	}
+
+	storagePath, ok := authorizeSongOwner(w, r, songID)
+	if (!ok) {
+		return
+	}
+
+	// Previous masters are deleted along with the current one
+	paths := []string{storagePath}
+	rows, err := database.DB.Query("SELECT storage_path FROM song_revisions WHERE song_id = $1", songID)
+	if (err != nil) {
+		log.Printf("Error loading revisions for song %d: %v", songID, err)
+		http.Error(w, "Failed to delete song", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	rows.Close()
+
+	stationIDs, err := stationIDsQueueing(songID)
+	if (err != nil) {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Deleting the row cascades to every station queue and vote round
+	if _, err := database.DB.Exec("DELETE FROM songs WHERE id = $1", songID); err != nil {
+		log.Printf("Error deleting song %d: %v", songID, err)
+		http.Error(w, "Failed to delete song", http.StatusInternalServerError)
+		return
+	}
+
+	for _, path := range paths {
+		removeStoredFile(path)
+	}
+	for _, stationID := range stationIDs {
+		notifyQueueUpdated(stationID)
+	}
+
+	log.Printf("Song %d deleted", songID)
+	websocket.NotifyTopic(websocket.SongTopic(songID), websocket.EventSongDeleted, websocket.Deleted{ID: songID})
+	render.JSON(w, r, map[string]string{"message": "Song deleted"})
+}
+
+// authorizeSongOwner checks that the caller is the song's artist or an admin.
+// It writes the error response itself and returns the song's storage path on success.
+func authorizeSongOwner(w http.ResponseWriter, r *http.Request, songID int) (string, bool) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if (!ok) {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return "", false
+	}
+	role, _ := r.Context().Value("role").(string)
+
+	var artistID sql.NullInt64
+	var storagePath sql.NullString
+	err := database.DB.QueryRow("SELECT artist_id, storage_path FROM songs WHERE id = $1", songID).Scan(&artistID, &storagePath)
+	if (err == sql.ErrNoRows) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return "", false
+	} else if (err != nil) {
+		log.Printf("Database error loading song %d: %v", songID, err)
+		http.Error(w, "Failed to fetch song", http.StatusInternalServerError)
+		return "", false
+	}
+
+	if (role != "admin" && (!artistID.Valid || int(artistID.Int64) != userID)) {
+		http.Error(w, "Access denied: you can only modify your own songs", http.StatusForbidden)
+		return "", false
+	}
+
+	return storagePath.String, true
+}
+
+// removeStoredFile deletes an uploaded file unless another song still points at it
+func removeStoredFile(path string) {
+	if (path == "") {
+		return
+	}
+
+	var refs int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM songs WHERE storage_path = $1", path).Scan(&refs); err != nil {
+		log.Printf("Warning: could not check references to %s: %v", path, err)
+		return
+	}
+	if (refs > 0) {
+		log.Printf("Keeping %s: still referenced by %d song(s)", path, refs)
+		return
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove %s: %v", path, err)
+	}
+}
+
+// ReplaceSongAudio swaps the audio master behind an existing song (owning artist or admin only).
+// The song keeps its ID, votes and history; the previous file is kept as a revision.
+func ReplaceSongAudio(w http.ResponseWriter, r *http.Request) {
+	songID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if (err != nil) {
+		http.Error(w, "Invalid song ID format", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeSongOwner(w, r, songID); !ok {
+		return
+	}
+	userID := r.Context().Value("user_id").(int)
+
+	err = r.ParseMultipartForm(10 << 20) // Same limit as UploadSong
+	if (err != nil) {
+		http.Error(w, "File too large or invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	file, handler, err := r.FormFile("song")
+	if (err != nil) {
+		http.Error(w, "Invalid file upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if (!isAllowedAudioFile(handler.Filename)) {
+		http.Error(w, "Invalid file type. Only MP3 and AAC files are allowed.", http.StatusBadRequest)
+		return
+	}
+
+	EnsureUploadsDirectory()
+
+	// Write and probe the new master before locking the song, under a temporary
+	// name; it is renamed into place once its revision number is known, so the
+	// playout never opens a half-written master
+	stagedPath, err := stageFile(file, SanitizeFilePath(filepath.Base(handler.Filename)))
+	if (err != nil) {
+		log.Printf("Error storing new master for song %d: %v", songID, err)
+		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(stagedPath) // Nothing left to remove once it is renamed
+
+	// Re-run metadata extraction on the new master, falling back to the form
+	// value and then to the current duration
+	duration, err := probeDuration(stagedPath)
+	durationKnown := err == nil
+	if (!durationKnown) {
+		log.Printf("Warning: %v", err)
+		if durationStr := r.FormValue("duration"); durationStr != "" {
+			if parsed, err := strconv.Atoi(durationStr); err == nil {
+				duration, durationKnown = parsed, true
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if (err != nil) {
+		http.Error(w, "Database connection error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the row so concurrent replacements get distinct revision numbers
+	var oldPath sql.NullString
+	var oldDuration, revision int
+	err = tx.QueryRow("SELECT storage_path, duration, revision FROM songs WHERE id = $1 FOR UPDATE", songID).
+		Scan(&oldPath, &oldDuration, &revision)
+	if (err != nil) {
+		log.Printf("Error locking song %d for replacement: %v", songID, err)
+		http.Error(w, "Failed to fetch song", http.StatusInternalServerError)
+		return
+	}
+	if (!durationKnown) {
+		duration = oldDuration
+	}
+
+	// Each revision gets its own file
+	newRevision := revision + 1
+	newPath := SanitizeFilePath(fmt.Sprintf("%d_r%d_%s", songID, newRevision, filepath.Base(handler.Filename)))
+	if err := os.Rename(stagedPath, newPath); err != nil {
+		log.Printf("Error moving new master for song %d into place: %v", songID, err)
+		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO song_revisions (song_id, revision, storage_path, duration, replaced_by) VALUES ($1, $2, $3, $4, $5)",
+		songID, revision, oldPath.String, oldDuration, userID,
+	)
+	if (err == nil) {
+		_, err = tx.Exec(
+			"UPDATE songs SET storage_path = $1, duration = $2, revision = $3, updated_at = NOW() WHERE id = $4",
+			newPath, duration, newRevision, songID,
+		)
+	}
+	if (err == nil) {
+		err = tx.Commit()
+	}
+	if (err != nil) {
+		log.Printf("Error recording new master for song %d: %v", songID, err)
+		os.Remove(newPath)
+		http.Error(w, "Failed to save song metadata", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Song %d audio replaced by user_id %d: revision %d stored at %s, duration: %d seconds",
+		songID, userID, newRevision, newPath, duration)
+
+	song, err := database.GetSong(songID)
+	if (err != nil) {
+		http.Error(w, "Failed to fetch updated song", http.StatusInternalServerError)
+		return
+	}
+
+	websocket.NotifyTopic(websocket.SongTopic(song.ID), websocket.EventSongAudioReplaced, song)
+	render.JSON(w, r, map[string]interface{}{
+		"message":  "Song audio replaced successfully",
+		"revision": newRevision,
+		"song":     song,
+	})
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"groovegarden/database"
+)
+
+func TestVoteForSongRefusesUnappliedBoost(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t)
+	songID := createTestSong(t)
+
+	vote := func(query string) int {
+		r := httptest.NewRequest(http.MethodPost, "/songs/"+strconv.Itoa(songID)+"/vote"+query, nil)
+		w := httptest.NewRecorder()
+		VoteForSong(w, withRoute(r, userID, map[string]string{"id": strconv.Itoa(songID)}))
+		return w.Code
+	}
+
+	if code := vote(""); code != http.StatusOK {
+		t.Fatalf("first vote: got %d, want %d", code, http.StatusOK)
+	}
+	// The user already voted in this round, so the boost has nowhere to go
+	if code := vote("?boost=1"); code != http.StatusConflict {
+		t.Errorf("boosted second vote: got %d, want %d", code, http.StatusConflict)
+	}
+
+	var votes int
+	if err := database.DB.QueryRow("SELECT votes FROM songs WHERE id = $1", songID).Scan(&votes); err != nil {
+		t.Fatal(err)
+	}
+	if votes != 1 {
+		t.Errorf("song has %d votes, want 1", votes)
+	}
+}
@@ -0,0 +1,728 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/listeners"
+	"groovegarden/models"
+	"groovegarden/playout"
+	"groovegarden/websocket"
+)
+
+// slugPattern restricts station slugs (and default mounts) to URL-safe names
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+var (
+	errAlreadyVoted = errors.New("already voted for this song in the current round")
+	errNotInPool    = errors.New("song is not part of this station's pool")
+)
+
+// stationView is a station together with what it is playing and who is listening
+type stationView struct {
+	models.Station
+	Running    bool               `json:"running"`
+	NowPlaying *models.NowPlaying `json:"now_playing,omitempty"`
+	Listeners  int                `json:"listeners"`
+}
+
+// stationRequest holds the fields an admin can set on a station; nil fields are left unchanged
+type stationRequest struct {
+	Name           *string   `json:"name"`
+	Slug           *string   `json:"slug"`
+	Mount          *string   `json:"mount"`
+	PoolTags       *[]string `json:"pool_tags"`
+	PoolMaxAgeDays *int      `json:"pool_max_age_days"`
+	Timezone       *string   `json:"timezone"`
+	RepeatWindow   *int      `json:"repeat_window_minutes"`
+	SkipRatio      *float64  `json:"skip_ratio"`
+	SkipMinVotes   *int      `json:"skip_min_votes"`
+	AutoApprove    *bool     `json:"auto_approve_requests"`
+}
+
+// validateSkipSettings checks the skip thresholds of a station request
+func validateSkipSettings(req stationRequest) error {
+	if req.SkipRatio != nil && (*req.SkipRatio <= 0 || *req.SkipRatio > 1) {
+		return fmt.Errorf("skip_ratio must be greater than 0 and at most 1")
+	}
+	if req.SkipMinVotes != nil && *req.SkipMinVotes < 1 {
+		return fmt.Errorf("skip_min_votes must be at least 1")
+	}
+	return nil
+}
+
+// ListStations returns every station with its now-playing track
+func ListStations(w http.ResponseWriter, r *http.Request) {
+	stations, err := database.ListStations("")
+	if err != nil {
+		log.Printf("Error listing stations: %v", err)
+		http.Error(w, "Failed to fetch stations", http.StatusInternalServerError)
+		return
+	}
+
+	views := []stationView{}
+	for _, station := range stations {
+		views = append(views, newStationView(station))
+	}
+	render.JSON(w, r, views)
+}
+
+// GetStation returns a single station with its now-playing track
+func GetStation(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, newStationView(station))
+}
+
+// CreateStation creates a new station (admin only). New stations start paused.
+func CreateStation(w http.ResponseWriter, r *http.Request) {
+	var req stationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "Station name is required", http.StatusBadRequest)
+		return
+	}
+	if req.Slug == nil || !slugPattern.MatchString(*req.Slug) {
+		http.Error(w, "A slug of lowercase letters, digits and dashes is required", http.StatusBadRequest)
+		return
+	}
+
+	mount := "/" + *req.Slug
+	if req.Mount != nil {
+		mount = normalizeMount(*req.Mount)
+	}
+	poolTags := []string{}
+	if req.PoolTags != nil {
+		poolTags = normalizeTags(*req.PoolTags)
+	}
+	timezone := "UTC"
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			http.Error(w, "Unknown timezone", http.StatusBadRequest)
+			return
+		}
+		timezone = *req.Timezone
+	}
+	repeatWindow := 60
+	if req.RepeatWindow != nil {
+		if *req.RepeatWindow < 0 {
+			http.Error(w, "repeat_window_minutes cannot be negative", http.StatusBadRequest)
+			return
+		}
+		repeatWindow = *req.RepeatWindow
+	}
+	if err := validateSkipSettings(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skipRatio, skipMinVotes := 0.5, 2
+	if req.SkipRatio != nil {
+		skipRatio = *req.SkipRatio
+	}
+	if req.SkipMinVotes != nil {
+		skipMinVotes = *req.SkipMinVotes
+	}
+
+	autoApprove := req.AutoApprove != nil && *req.AutoApprove
+
+	var stationID int
+	err := database.DB.QueryRow(`
+		INSERT INTO stations (name, slug, mount, pool_tags, pool_max_age_days, timezone, repeat_window_minutes,
+		                      skip_ratio, skip_min_votes, auto_approve_requests)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, strings.TrimSpace(*req.Name), *req.Slug, mount, pq.Array(poolTags), req.PoolMaxAgeDays, timezone,
+		repeatWindow, skipRatio, skipMinVotes, autoApprove).Scan(&stationID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			http.Error(w, "A station with this slug or mount already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating station: %v", err)
+		http.Error(w, "Failed to create station", http.StatusInternalServerError)
+		return
+	}
+
+	station, err := database.GetStation(stationID)
+	if err != nil {
+		http.Error(w, "Failed to fetch station", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Station %d (%s) created on mount %s", station.ID, station.Name, station.Mount)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, newStationView(station))
+}
+
+// UpdateStation edits a station's name, mount, pool rules or timezone (admin only)
+func UpdateStation(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	var req stationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	before := station
+
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			http.Error(w, "Station name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		station.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Slug != nil {
+		if !slugPattern.MatchString(*req.Slug) {
+			http.Error(w, "Slug must be lowercase letters, digits and dashes", http.StatusBadRequest)
+			return
+		}
+		station.Slug = *req.Slug
+	}
+	if req.Mount != nil {
+		station.Mount = normalizeMount(*req.Mount)
+	}
+	if req.PoolTags != nil {
+		station.PoolTags = normalizeTags(*req.PoolTags)
+	}
+	if req.PoolMaxAgeDays != nil {
+		station.PoolMaxAgeDays = req.PoolMaxAgeDays
+		if *req.PoolMaxAgeDays <= 0 {
+			station.PoolMaxAgeDays = nil // 0 clears the age limit
+		}
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			http.Error(w, "Unknown timezone", http.StatusBadRequest)
+			return
+		}
+		station.Timezone = *req.Timezone
+	}
+	if req.RepeatWindow != nil {
+		if *req.RepeatWindow < 0 {
+			http.Error(w, "repeat_window_minutes cannot be negative", http.StatusBadRequest)
+			return
+		}
+		station.RepeatWindowMinutes = *req.RepeatWindow
+	}
+	if err := validateSkipSettings(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.SkipRatio != nil {
+		station.SkipRatio = *req.SkipRatio
+	}
+	if req.SkipMinVotes != nil {
+		station.SkipMinVotes = *req.SkipMinVotes
+	}
+	if req.AutoApprove != nil {
+		station.AutoApproveRequests = *req.AutoApprove
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE stations SET name = $1, slug = $2, mount = $3, pool_tags = $4, pool_max_age_days = $5, timezone = $6,
+		       repeat_window_minutes = $7, skip_ratio = $8, skip_min_votes = $9, auto_approve_requests = $10
+		WHERE id = $11
+	`, station.Name, station.Slug, station.Mount, pq.Array(station.PoolTags), station.PoolMaxAgeDays,
+		station.Timezone, station.RepeatWindowMinutes, station.SkipRatio, station.SkipMinVotes,
+		station.AutoApproveRequests, station.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			http.Error(w, "A station with this slug or mount already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error updating station %d: %v", station.ID, err)
+		http.Error(w, "Failed to update station", http.StatusInternalServerError)
+		return
+	}
+
+	// Restarting the encoder drops the stream for listeners and ends a live
+	// session, so only a new mount, pool or timezone restarts the worker
+	if playout.IsRunning(station.ID) {
+		if needsPlayoutRestart(before, station) {
+			playout.Start(station)
+		} else {
+			playout.Update(station)
+		}
+	}
+
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventStationUpdated, station)
+	render.JSON(w, r, newStationView(station))
+}
+
+// needsPlayoutRestart reports whether an edit changed what the worker was started with
+func needsPlayoutRestart(before, after models.Station) bool {
+	if before.Mount != after.Mount || before.Timezone != after.Timezone {
+		return true
+	}
+	if !slices.Equal(before.PoolTags, after.PoolTags) {
+		return true
+	}
+	if (before.PoolMaxAgeDays == nil) != (after.PoolMaxAgeDays == nil) {
+		return true
+	}
+	return before.PoolMaxAgeDays != nil && *before.PoolMaxAgeDays != *after.PoolMaxAgeDays
+}
+
+// PauseStation takes a station off air (admin only)
+func PauseStation(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := setStationStatus(&station, models.StationPaused); err != nil {
+		log.Printf("Error pausing station %d: %v", station.ID, err)
+		http.Error(w, "Failed to pause station", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, newStationView(station))
+}
+
+// ResumeStation puts a station on air (admin only)
+func ResumeStation(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := setStationStatus(&station, models.StationActive); err != nil {
+		log.Printf("Error resuming station %d: %v", station.ID, err)
+		http.Error(w, "Failed to resume station", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, newStationView(station))
+}
+
+// DeleteStation stops and removes a station with its queue and votes (admin only)
+func DeleteStation(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	if station.Slug == database.DefaultStationSlug {
+		http.Error(w, "The default station cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	playout.Stop(station.ID)
+	if _, err := database.DB.Exec("DELETE FROM stations WHERE id = $1", station.ID); err != nil {
+		log.Printf("Error deleting station %d: %v", station.ID, err)
+		http.Error(w, "Failed to delete station", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Station %d (%s) deleted", station.ID, station.Name)
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventStationDeleted, websocket.Deleted{ID: station.ID})
+	render.JSON(w, r, map[string]string{"message": "Station deleted"})
+}
+
+// GetStationQueue returns a station's queued songs and the current round's vote standings
+func GetStationQueue(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+
+	queue, err := fetchStationQueue(station.ID)
+	if err != nil {
+		log.Printf("Error loading queue for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch queue", http.StatusInternalServerError)
+		return
+	}
+
+	standings, err := fetchVoteStandings(station)
+	if err != nil {
+		log.Printf("Error loading vote standings for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch vote standings", http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"station_id": station.ID,
+		"round":      station.VoteRound,
+		"queue":      queue,
+		"standings":  standings,
+	})
+}
+
+// GetListenerStats returns a station's hourly listener peaks and averages (admin only).
+// Defaults to the last 24 hours; pass ?since=<RFC 3339 time> for a longer range.
+func GetListenerStats(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+	if since.IsZero() {
+		since = time.Now().Add(-24 * time.Hour)
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT hour, peak, total::float8 / GREATEST(samples, 1)
+		FROM listener_stats
+		WHERE station_id = $1 AND hour >= date_trunc('hour', $2::timestamp)
+		ORDER BY hour
+	`, station.ID, since)
+	if err != nil {
+		log.Printf("Error loading listener stats for station %d: %v", station.ID, err)
+		http.Error(w, "Failed to fetch listener stats", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	hours := []models.ListenerHour{}
+	for rows.Next() {
+		var hour models.ListenerHour
+		if err := rows.Scan(&hour.Hour, &hour.Peak, &hour.Average); err != nil {
+			http.Error(w, "Failed to read listener stats", http.StatusInternalServerError)
+			return
+		}
+		hours = append(hours, hour)
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"station_id": station.ID,
+		"current":    listeners.Current(station.ID),
+		"hours":      hours,
+	})
+}
+
+// EnqueueSong adds a song to the end of a station's queue (admin only)
+func EnqueueSong(w http.ResponseWriter, r *http.Request) {
+	station, ok := loadStation(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := r.Context().Value("user_id").(int)
+
+	var req struct {
+		SongID int `json:"song_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SongID == 0 {
+		http.Error(w, "A song_id is required", http.StatusBadRequest)
+		return
+	}
+
+	_, err := database.DB.Exec(
+		"INSERT INTO station_queue (station_id, song_id, source, added_by) VALUES ($1, $2, 'admin', $3)",
+		station.ID, req.SongID, userID,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			http.Error(w, "Song not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error queueing song %d on station %d: %v", req.SongID, station.ID, err)
+		http.Error(w, "Failed to queue song", http.StatusInternalServerError)
+		return
+	}
+
+	notifyQueueUpdated(station.ID)
+	render.JSON(w, r, map[string]string{"message": "Song queued"})
+}
+
+// VoteInStation casts the caller's vote for a song in a station's current round
+func VoteInStation(w http.ResponseWriter, r *http.Request) {
+	stationID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+		return
+	}
+	songID, err := strconv.Atoi(chi.URLParam(r, "songID"))
+	if err != nil {
+		http.Error(w, "Invalid song ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	boost, err := parseBoost(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	round, tally, err := castStationVote(stationID, songID, userID, boost)
+	switch {
+	case err == errAlreadyVoted:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err == database.ErrInsufficientCredits:
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	case err == errNotInPool:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error recording vote for song %d on station %d: %v", songID, stationID, err)
+		http.Error(w, "Failed to record vote", http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"message": "Vote counted",
+		"round":   round,
+		"votes":   tally,
+	})
+}
+
+// castStationVote records a station vote and counts it toward the song's lifetime
+// total. The total counts votes, not weight: a boost only weighs in the round.
+func castStationVote(stationID, songID, userID, boost int) (int, int, error) {
+	round, tally, err := recordStationVote(stationID, songID, userID, boost)
+	if err != nil {
+		return round, tally, err
+	}
+	if _, err := database.DB.Exec("UPDATE songs SET votes = votes + 1 WHERE id = $1", songID); err != nil {
+		log.Printf("Warning: failed to update vote total for song %d: %v", songID, err)
+	}
+	return round, tally, nil
+}
+
+// recordStationVote stores a vote in the station's current round and broadcasts the
+// new tally to the station. A boost adds that much weight to the vote, paid for in
+// credits. It returns errNotInPool, errAlreadyVoted or database.ErrInsufficientCredits
+// for rejected votes.
+func recordStationVote(stationID, songID, userID, boost int) (int, int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var round int
+	err = tx.QueryRow(`
+		SELECT st.vote_round
+		FROM stations st
+		JOIN songs s ON s.id = $2
+		WHERE st.id = $1 AND `+database.StationPoolFilter,
+		stationID, songID,
+	).Scan(&round)
+	if err == sql.ErrNoRows {
+		return 0, 0, errNotInPool
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO votes (user_id, song_id, station_id, round, weight) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+	`, userID, songID, stationID, round, 1+boost)
+	if err != nil {
+		return 0, 0, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return round, 0, errAlreadyVoted
+	}
+
+	if boost > 0 {
+		_, err = database.SpendCredits(tx, models.CreditTransaction{
+			UserID:    userID,
+			Amount:    boost * voteBoostCost,
+			Kind:      database.CreditVoteBoost,
+			StationID: &stationID,
+			SongID:    &songID,
+			Note:      fmt.Sprintf("+%d vote weight in round %d", boost, round),
+		})
+		if err != nil {
+			return round, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return round, 0, err
+	}
+
+	var tally int
+	err = database.DB.QueryRow(
+		"SELECT COALESCE(SUM(weight), 0) FROM votes WHERE station_id = $1 AND round = $2 AND song_id = $3",
+		stationID, round, songID,
+	).Scan(&tally)
+	if err != nil {
+		return round, 0, err
+	}
+
+	websocket.NotifyTopic(websocket.StationTopic(stationID), websocket.EventVoteCast, websocket.VoteCast{
+		StationID: stationID,
+		SongID:    songID,
+		Round:     round,
+		Votes:     tally,
+	})
+	return round, tally, nil
+}
+
+// setStationStatus persists a station's status and starts or stops its playout to match
+func setStationStatus(station *models.Station, status string) error {
+	if _, err := database.DB.Exec("UPDATE stations SET status = $1 WHERE id = $2", status, station.ID); err != nil {
+		return err
+	}
+	station.Status = status
+
+	if status == models.StationActive {
+		playout.Start(*station)
+	} else {
+		playout.Stop(station.ID)
+	}
+
+	websocket.NotifyTopic(websocket.StationTopic(station.ID), websocket.EventStationStatus, websocket.StationStatus{
+		StationID: station.ID,
+		Status:    status,
+	})
+	return nil
+}
+
+// fetchStationQueue lists a station's queued songs in play order
+func fetchStationQueue(stationID int) ([]models.QueueEntry, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, song_id, source, added_at FROM station_queue
+		WHERE station_id = $1
+		ORDER BY priority DESC, added_at, id
+	`, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := []models.QueueEntry{}
+	for rows.Next() {
+		entry := models.QueueEntry{StationID: stationID}
+		if err := rows.Scan(&entry.ID, &entry.Song.ID, &entry.Source, &entry.AddedAt); err != nil {
+			return nil, err
+		}
+		queue = append(queue, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range queue {
+		song, err := database.GetSong(queue[i].Song.ID)
+		if err != nil {
+			return nil, err
+		}
+		queue[i].Song = song
+	}
+	return queue, nil
+}
+
+// fetchVoteStandings tallies the current round's votes for a station
+func fetchVoteStandings(station models.Station) ([]models.VoteStanding, error) {
+	rows, err := database.DB.Query(`
+		SELECT s.id, s.title, COALESCE(s.artist, u.name, 'Unknown'), SUM(v.weight) AS total
+		FROM votes v
+		JOIN songs s ON s.id = v.song_id
+		LEFT JOIN users u ON s.artist_id = u.id
+		WHERE v.station_id = $1 AND v.round = $2
+		GROUP BY s.id, s.title, s.artist, u.name
+		ORDER BY total DESC, s.id
+	`, station.ID, station.VoteRound)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standings := []models.VoteStanding{}
+	for rows.Next() {
+		var standing models.VoteStanding
+		if err := rows.Scan(&standing.SongID, &standing.Title, &standing.Artist, &standing.Votes); err != nil {
+			return nil, err
+		}
+		standings = append(standings, standing)
+	}
+	return standings, rows.Err()
+}
+
+// notifyQueueUpdated tells a station's listeners to refresh its queue
+func notifyQueueUpdated(stationID int) {
+	websocket.NotifyTopic(websocket.StationTopic(stationID), websocket.EventQueueUpdated, websocket.StationRef{StationID: stationID})
+}
+
+// loadStation reads the {id} URL parameter and loads the station, writing
+// the error response itself when it can't
+func loadStation(w http.ResponseWriter, r *http.Request) (models.Station, bool) {
+	stationID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+		return models.Station{}, false
+	}
+
+	station, err := database.GetStation(stationID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return station, false
+	} else if err != nil {
+		log.Printf("Error loading station %d: %v", stationID, err)
+		http.Error(w, "Failed to fetch station", http.StatusInternalServerError)
+		return station, false
+	}
+	return station, true
+}
+
+func newStationView(station models.Station) stationView {
+	return stationView{
+		Station:    station,
+		Running:    playout.IsRunning(station.ID),
+		NowPlaying: playout.NowPlaying(station.ID),
+		Listeners:  listeners.Current(station.ID).Listeners,
+	}
+}
+
+// normalizeMount makes sure a mount point starts with a slash
+func normalizeMount(mount string) string {
+	return "/" + strings.TrimLeft(strings.TrimSpace(mount), "/")
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint error
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// stationIDsQueueing returns the stations that have a song queued
+func stationIDsQueueing(songID int) ([]int, error) {
+	rows, err := database.DB.Query("SELECT DISTINCT station_id FROM station_queue WHERE song_id = $1", songID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find queues holding song %d: %w", songID, err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"sync"
+	"testing"
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+func TestBoostedVotesDontOverspend(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t)
+	stationID := createTestStation(t)
+	grant := models.CreditTransaction{UserID: userID, Amount: 2 * voteBoostCost, Kind: database.CreditGrant}
+	if _, err := database.AddCredits(database.DB, grant, ""); err != nil {
+		t.Fatalf("granting credits: %v", err)
+	}
+
+	// Each vote is for another song, so only the balance can turn them down
+	const votes = 8
+	errs := make(chan error, votes)
+	var wg sync.WaitGroup
+	for i := 0; i < votes; i++ {
+		songID := createTestSong(t)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := recordStationVote(stationID, songID, userID, 1)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	counted := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			counted++
+		case database.ErrInsufficientCredits:
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if counted != 2 {
+		t.Errorf("%d boosted votes counted, want 2", counted)
+	}
+
+	balance, err := database.CreditBalance(database.DB, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 0 {
+		t.Errorf("balance %d, want 0", balance)
+	}
+	// A vote turned down for its boost isn't recorded either
+	var recorded int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM votes WHERE user_id = $1", userID).Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != 2 {
+		t.Errorf("%d votes recorded, want 2", recorded)
+	}
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+// GetMyArtistStats returns the calling artist's plays, audience and votes
+// over the last ?days= days (default 30, max 365), read from the rollup tables
+func GetMyArtistStats(w http.ResponseWriter, r *http.Request) {
+	artistID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized: Missing or invalid user_id", http.StatusUnauthorized)
+		return
+	}
+
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			http.Error(w, "days must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := to.AddDate(0, 0, -(days - 1))
+
+	result, err := fetchArtistStats(artistID, from, to)
+	if err != nil {
+		log.Printf("Error loading stats for artist %d: %v", artistID, err)
+		http.Error(w, "Failed to fetch stats", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, result)
+}
+
+// fetchArtistStats reads an artist's rollups for the days from..to inclusive
+func fetchArtistStats(artistID int, from, to time.Time) (models.ArtistStats, error) {
+	result := models.ArtistStats{
+		ArtistID:     artistID,
+		From:         from,
+		To:           to,
+		Daily:        []models.ArtistDay{},
+		TopHours:     []models.ArtistHour{},
+		TopLocations: []models.ArtistLocation{},
+	}
+
+	var listenSeconds, trackSeconds float64
+	err := database.DB.QueryRow(`
+		SELECT COALESCE(SUM(plays), 0), COALESCE(SUM(full_plays), 0), COALESCE(SUM(skips), 0), COALESCE(SUM(votes), 0),
+		       COALESCE(SUM(reactions), 0), COALESCE(SUM(listen_seconds), 0), COALESCE(SUM(track_seconds), 0)
+		FROM artist_daily_stats
+		WHERE artist_id = $1 AND day BETWEEN $2 AND $3
+	`, artistID, from, to).Scan(&result.Totals.Plays, &result.Totals.FullPlays, &result.Totals.Skips, &result.Totals.Votes,
+		&result.Totals.Reactions, &listenSeconds, &trackSeconds)
+	if err != nil {
+		return result, err
+	}
+	if result.Totals.Plays > 0 {
+		result.Totals.Conversion = float64(result.Totals.Votes) / float64(result.Totals.Plays)
+	}
+	if trackSeconds > 0 {
+		result.Totals.ListenThroughRate = listenSeconds / trackSeconds
+	}
+
+	err = database.DB.QueryRow(`
+		SELECT COUNT(DISTINCT listener_key) FROM artist_daily_listeners
+		WHERE artist_id = $1 AND day BETWEEN $2 AND $3
+	`, artistID, from, to).Scan(&result.Totals.UniqueListeners)
+	if err != nil {
+		return result, err
+	}
+
+	result.Totals.ReactionCounts = make(map[string]int, len(database.ReactionEmoji))
+	for reaction := range database.ReactionEmoji {
+		result.Totals.ReactionCounts[reaction] = 0
+	}
+	rows, err := database.DB.Query(`
+		SELECT reaction, SUM(count)
+		FROM artist_daily_reactions
+		WHERE artist_id = $1 AND day BETWEEN $2 AND $3
+		GROUP BY reaction
+	`, artistID, from, to)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var reaction string
+		var count int
+		if err := rows.Scan(&reaction, &count); err != nil {
+			rows.Close()
+			return result, err
+		}
+		result.Totals.ReactionCounts[reaction] = count
+	}
+	rows.Close()
+
+	rows, err = database.DB.Query(`
+		SELECT to_char(d.day, 'YYYY-MM-DD'), d.plays, d.skips, d.votes, d.reactions,
+		       (SELECT COUNT(*) FROM artist_daily_listeners l WHERE l.artist_id = d.artist_id AND l.day = d.day)
+		FROM artist_daily_stats d
+		WHERE d.artist_id = $1 AND d.day BETWEEN $2 AND $3
+		ORDER BY d.day
+	`, artistID, from, to)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var day models.ArtistDay
+		if err := rows.Scan(&day.Day, &day.Plays, &day.Skips, &day.Votes, &day.Reactions, &day.Listeners); err != nil {
+			rows.Close()
+			return result, err
+		}
+		result.Daily = append(result.Daily, day)
+	}
+	rows.Close()
+
+	rows, err = database.DB.Query(`
+		SELECT hour, SUM(plays), SUM(audience)
+		FROM artist_hourly_stats
+		WHERE artist_id = $1 AND day BETWEEN $2 AND $3
+		GROUP BY hour
+		ORDER BY SUM(audience) DESC, SUM(plays) DESC, hour
+		LIMIT 5
+	`, artistID, from, to)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var hour models.ArtistHour
+		if err := rows.Scan(&hour.Hour, &hour.Plays, &hour.Audience); err != nil {
+			rows.Close()
+			return result, err
+		}
+		result.TopHours = append(result.TopHours, hour)
+	}
+	rows.Close()
+
+	rows, err = database.DB.Query(`
+		SELECT country, SUM(listeners)
+		FROM artist_country_stats
+		WHERE artist_id = $1 AND day BETWEEN $2 AND $3
+		GROUP BY country
+		ORDER BY SUM(listeners) DESC, country
+		LIMIT 10
+	`, artistID, from, to)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var location models.ArtistLocation
+		if err := rows.Scan(&location.Country, &location.Listeners); err != nil {
+			rows.Close()
+			return result, err
+		}
+		result.TopLocations = append(result.TopLocations, location)
+	}
+	rows.Close()
+
+	var updatedAt time.Time
+	err = database.DB.QueryRow("SELECT updated_at FROM stats_rollups WHERE name = 'artist'").Scan(&updatedAt)
+	if err == nil {
+		result.UpdatedAt = &updatedAt
+	} else if err != sql.ErrNoRows {
+		return result, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+// maxTagLength keeps free tags short enough to display as chips
+const maxTagLength = 40
+
+// dbExecutor is satisfied by both *sql.DB and *sql.Tx
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// songTaxonomy is the classification an artist sets on a song; nil fields are left unchanged
+type songTaxonomy struct {
+	Genre *string   `json:"genre"`
+	Moods *[]string `json:"moods"`
+	Tags  *[]string `json:"tags"`
+}
+
+// empty reports whether no classification field was provided
+func (t songTaxonomy) empty() bool {
+	return t.Genre == nil && t.Moods == nil && t.Tags == nil
+}
+
+// GetTags lists the vocabulary, optionally filtered by ?kind=genre|mood|tag
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+
+	rows, err := database.DB.Query(`
+		SELECT t.id, t.name, t.kind, t.curated, COUNT(st.song_id)
+		FROM tags t
+		LEFT JOIN song_tags st ON st.tag_id = t.id
+		WHERE $1 = '' OR t.kind = $1
+		GROUP BY t.id
+		ORDER BY t.kind, t.curated DESC, COUNT(st.song_id) DESC, t.name
+	`, kind)
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Kind, &tag.Curated, &tag.SongCount); err != nil {
+			http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("Error iterating over rows: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, tags)
+}
+
+// CreateTag adds a curated genre or mood, or promotes an existing free tag (admin only)
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := normalizeTagName(req.Name)
+	if name == "" {
+		http.Error(w, "Tag name is required", http.StatusBadRequest)
+		return
+	}
+	if req.Kind != database.TagKindGenre && req.Kind != database.TagKindMood && req.Kind != database.TagKindTag {
+		http.Error(w, "Invalid kind. Use genre, mood or tag.", http.StatusBadRequest)
+		return
+	}
+
+	// A free tag of the same name becomes the genre or mood, keeping its songs
+	tag := models.Tag{Name: name, Kind: req.Kind, Curated: true}
+	err := database.DB.QueryRow(`
+		WITH promoted AS (
+			UPDATE tags SET kind = $2, curated = TRUE
+			WHERE name = $1 AND kind = 'tag' AND $2 <> 'tag'
+			  AND NOT EXISTS (SELECT 1 FROM tags WHERE name = $1 AND kind = $2)
+			RETURNING id
+		), created AS (
+			INSERT INTO tags (name, kind, curated)
+			SELECT $1, $2, TRUE WHERE NOT EXISTS (SELECT 1 FROM promoted)
+			ON CONFLICT (name, kind) DO UPDATE SET curated = TRUE
+			RETURNING id
+		)
+		SELECT id FROM promoted UNION ALL SELECT id FROM created
+	`, name, req.Kind).Scan(&tag.ID)
+	if err != nil {
+		log.Printf("Error creating tag %q: %v", name, err)
+		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, tag)
+}
+
+// setSongTaxonomy replaces the parts of a song's classification that were provided.
+// Genres and moods must come from the curated vocabulary; free tags are created on demand.
+func setSongTaxonomy(db dbExecutor, songID int, taxonomy songTaxonomy) error {
+	if taxonomy.Genre != nil {
+		genre := normalizeTagName(*taxonomy.Genre)
+		var genres []string
+		if genre != "" {
+			genres = []string{genre}
+		}
+		if err := replaceSongTags(db, songID, database.TagKindGenre, genres); err != nil {
+			return err
+		}
+	}
+
+	if taxonomy.Moods != nil {
+		if err := replaceSongTags(db, songID, database.TagKindMood, normalizeTags(*taxonomy.Moods)); err != nil {
+			return err
+		}
+	}
+
+	if taxonomy.Tags != nil {
+		tags := normalizeTags(*taxonomy.Tags)
+		for _, name := range tags {
+			_, err := db.Exec("INSERT INTO tags (name, kind) VALUES ($1, 'tag') ON CONFLICT (name, kind) DO NOTHING", name)
+			if err != nil {
+				return fmt.Errorf("failed to create tag %q: %w", name, err)
+			}
+		}
+		if err := replaceSongTags(db, songID, database.TagKindTag, tags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceSongTags swaps a song's links of one kind for the given names
+func replaceSongTags(db dbExecutor, songID int, kind string, names []string) error {
+	if kind != database.TagKindTag {
+		if unknown, err := unknownTags(db, kind, names); err != nil {
+			return err
+		} else if len(unknown) > 0 {
+			return &taxonomyError{kind: kind, unknown: unknown}
+		}
+	}
+
+	_, err := db.Exec(`
+		DELETE FROM song_tags st USING tags t
+		WHERE st.tag_id = t.id AND st.song_id = $1 AND t.kind = $2
+	`, songID, kind)
+	if err != nil {
+		return fmt.Errorf("failed to clear %s links for song %d: %w", kind, songID, err)
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	// Links only ever go to entries of their own kind, so free tags named
+	// like a genre stay free tags and can be cleared as such
+	_, err = db.Exec(`
+		INSERT INTO song_tags (song_id, tag_id)
+		SELECT $1, t.id FROM tags t
+		WHERE t.name = ANY($2) AND t.kind = $3
+		ON CONFLICT DO NOTHING
+	`, songID, pq.Array(names), kind)
+	if err != nil {
+		return fmt.Errorf("failed to link %s for song %d: %w", kind, songID, err)
+	}
+	return nil
+}
+
+// unknownTags returns the names that aren't in the vocabulary for kind
+// (any kind when kind is empty)
+func unknownTags(db dbExecutor, kind string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT n FROM unnest($1::text[]) AS n
+		WHERE NOT EXISTS (SELECT 1 FROM tags t WHERE t.name = n AND ($2 = '' OR t.kind = $2))
+	`, pq.Array(names), kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s vocabulary: %w", kind, err)
+	}
+	defer rows.Close()
+
+	unknown := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, name)
+	}
+	return unknown, rows.Err()
+}
+
+// taxonomyError reports names outside the curated vocabulary; it maps to a 400
+type taxonomyError struct {
+	kind    string
+	unknown []string
+}
+
+func (e *taxonomyError) Error() string {
+	return fmt.Sprintf("unknown %s: %s", e.kind, strings.Join(e.unknown, ", "))
+}
+
+// errInvalidPreferences marks music_preferences that don't have the expected shape
+var errInvalidPreferences = errors.New("invalid music_preferences: expected genres, moods and tags lists")
+
+// validateMusicPreferences checks a listener's preferences against the tag vocabulary
+// and returns them normalised as a JSON string (or nil), ready to store in users.music_preferences
+func validateMusicPreferences(raw interface{}) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPreferences, err)
+	}
+
+	var prefs models.MusicPreferences
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&prefs); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPreferences, err)
+	}
+
+	prefs.Genres = normalizeTags(prefs.Genres)
+	prefs.Moods = normalizeTags(prefs.Moods)
+	prefs.Tags = normalizeTags(prefs.Tags)
+
+	checks := []struct {
+		kind  string
+		names []string
+	}{
+		{database.TagKindGenre, prefs.Genres},
+		{database.TagKindMood, prefs.Moods},
+		{"", prefs.Tags},
+	}
+	for _, check := range checks {
+		unknown, err := unknownTags(database.DB, check.kind, check.names)
+		if err != nil {
+			return nil, err
+		}
+		if len(unknown) > 0 {
+			kind := check.kind
+			if kind == "" {
+				kind = database.TagKindTag
+			}
+			return nil, &taxonomyError{kind: kind, unknown: unknown}
+		}
+	}
+
+	normalized, err := json.Marshal(prefs)
+	if err != nil {
+		return nil, err
+	}
+	return string(normalized), nil
+}
+
+// isTaxonomyInputError reports whether err was caused by the caller's input
+func isTaxonomyInputError(err error) bool {
+	var taxErr *taxonomyError
+	return errors.As(err, &taxErr) || errors.Is(err, errInvalidPreferences)
+}
+
+// normalizeTagName lower-cases a tag, collapses whitespace and caps its length
+func normalizeTagName(name string) string {
+	name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if len(name) > maxTagLength {
+		name = strings.TrimSpace(name[:maxTagLength])
+	}
+	return name
+}
+
+// normalizeTags normalises and de-duplicates a list of tag names
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, tag := range tags {
+		tag = normalizeTagName(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// splitFormList reads a comma-separated form value into a list, or nil when absent
+func splitFormList(r *http.Request, key string) *[]string {
+	if _, ok := r.Form[key]; !ok {
+		return nil
+	}
+	values := strings.Split(r.FormValue(key), ",")
+	return &values
+}
+
+// taxonomyFromForm reads genre, moods and tags from an upload form
+func taxonomyFromForm(r *http.Request) songTaxonomy {
+	var taxonomy songTaxonomy
+	if _, ok := r.Form["genre"]; ok {
+		genre := r.FormValue("genre")
+		taxonomy.Genre = &genre
+	}
+	taxonomy.Moods = splitFormList(r, "moods")
+	taxonomy.Tags = splitFormList(r, "tags")
+	return taxonomy
+}
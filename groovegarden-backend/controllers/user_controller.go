@@ -106,6 +106,18 @@ func UpsertUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Preferences must use the same genre/mood/tag vocabulary as songs so they can drive recommendations
+	preferences, err := validateMusicPreferences(user.MusicPreferences)
+	if err != nil {
+		if isTaxonomyInputError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error validating music preferences: %v", err)
+		http.Error(w, "Failed to validate music preferences", http.StatusInternalServerError)
+		return
+	}
+
 	query := `
 		INSERT INTO users (name, email, account_type, profile_picture, bio, links, music_preferences, location, date_of_birth, last_seen)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP)
@@ -124,7 +136,7 @@ func UpsertUser(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var userID int
-	err = database.DB.QueryRow(query, user.Name, user.Email, user.AccountType, user.ProfilePicture, user.Bio, user.Links, user.MusicPreferences, user.Location, user.DateOfBirth).Scan(&userID)
+	err = database.DB.QueryRow(query, user.Name, user.Email, user.AccountType, user.ProfilePicture, user.Bio, user.Links, preferences, user.Location, user.DateOfBirth).Scan(&userID)
 	if err != nil {
 		fmt.Printf("Error upserting user: %v\n", err) // Log the exact error
 		http.Error(w, "Failed to upsert user: "+err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"groovegarden/models"
+)
+
+// ChatHistorySize is how many messages each station's chat keeps for scrollback
+const ChatHistorySize = 500
+
+// chatRateLock is the advisory lock class that serialises each user's chat rate checks
+const chatRateLock = 0x63686174 // "chat"
+
+// Chat restriction kinds
+const (
+	ChatMute = "mute" // Can read but not post
+	ChatBan  = "ban"  // Can't post, and their messages are removed
+)
+
+// ensureChatTables creates station chat scrollback and moderation
+func ensureChatTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS chat_messages (
+			id BIGSERIAL PRIMARY KEY,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			text TEXT NOT NULL,
+			deleted_at TIMESTAMP,
+			deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS chat_messages_station_idx ON chat_messages (station_id, id);
+		CREATE INDEX IF NOT EXISTS chat_messages_user_idx ON chat_messages (user_id, station_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating chat_messages table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS chat_restrictions (
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL CHECK (kind IN ('mute', 'ban')),
+			reason TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (station_id, user_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating chat_restrictions table: %w", err)
+	}
+
+	// Each user's recent messages, for the chat rate limit every instance shares
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS chat_sends (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			sent_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS chat_sends_user_idx ON chat_sends (user_id, sent_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating chat_sends table: %w", err)
+	}
+	return nil
+}
+
+// RecordChatSend counts a message from a user toward the chat rate limit,
+// unless they already sent limit messages within window, and reports whether
+// it was counted. Every instance shares the count, timed by the database clock.
+func RecordChatSend(userID, limit int, window time.Duration) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Concurrent messages from the user would otherwise all see room left
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, $2)", chatRateLock, userID); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("DELETE FROM chat_sends WHERE user_id = $1 AND sent_at <= NOW() - make_interval(secs => $2)",
+		userID, window.Seconds())
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO chat_sends (user_id)
+		SELECT $1 WHERE (SELECT COUNT(*) FROM chat_sends WHERE user_id = $1) < $2
+	`, userID, limit)
+	if err != nil {
+		return false, err
+	}
+	if counted, _ := result.RowsAffected(); counted == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// chatMessageColumns are the columns scanned by scanChatMessage
+const chatMessageColumns = `m.id, m.station_id, m.user_id, COALESCE(u.name, ''), m.text, m.created_at
+	FROM chat_messages m
+	LEFT JOIN users u ON u.id = m.user_id`
+
+// InsertChatMessage stores a message, filling in its ID, time and sender's
+// name, and drops the station's messages beyond ChatHistorySize
+func InsertChatMessage(m *models.ChatMessage) error {
+	err := DB.QueryRow(`
+		WITH m AS (
+			INSERT INTO chat_messages (station_id, user_id, text) VALUES ($1, $2, $3)
+			RETURNING id, user_id, created_at
+		)
+		SELECT m.id, m.created_at, COALESCE(u.name, '') FROM m LEFT JOIN users u ON u.id = m.user_id
+	`, m.StationID, m.UserID, m.Text).Scan(&m.ID, &m.SentAt, &m.UserName)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec(`
+		DELETE FROM chat_messages
+		WHERE station_id = $1 AND id <= (
+			SELECT id FROM chat_messages WHERE station_id = $1 ORDER BY id DESC OFFSET $2 LIMIT 1
+		)
+	`, m.StationID, ChatHistorySize)
+	return err
+}
+
+// ListChatMessages returns up to limit of a station's messages, oldest
+// first, ending before the given message ID (0 for the latest)
+func ListChatMessages(stationID int, before int64, limit int) ([]models.ChatMessage, error) {
+	rows, err := DB.Query(`
+		SELECT `+chatMessageColumns+`
+		WHERE m.station_id = $1 AND m.deleted_at IS NULL AND ($2 = 0 OR m.id < $2)
+		ORDER BY m.id DESC
+		LIMIT $3
+	`, stationID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.ChatMessage{}
+	for rows.Next() {
+		m, err := scanChatMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// DeleteChatMessage hides a message from a station's scrollback. It returns
+// sql.ErrNoRows when there is no such message or it was already deleted.
+func DeleteChatMessage(stationID int, messageID int64, deletedBy int) error {
+	result, err := DB.Exec(`
+		UPDATE chat_messages SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+		WHERE station_id = $1 AND id = $2 AND deleted_at IS NULL
+	`, stationID, messageID, deletedBy)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserChatMessages hides all of a user's messages on a station and returns their IDs
+func DeleteUserChatMessages(stationID, userID, deletedBy int) ([]int64, error) {
+	var ids []int64
+	err := DB.QueryRow(`
+		WITH deleted AS (
+			UPDATE chat_messages SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+			WHERE station_id = $1 AND user_id = $2 AND deleted_at IS NULL
+			RETURNING id
+		)
+		SELECT COALESCE(array_agg(id ORDER BY id), '{}') FROM deleted
+	`, stationID, userID, deletedBy).Scan(pq.Array(&ids))
+	return ids, err
+}
+
+// chatRestrictionColumns are the columns scanned by scanChatRestriction
+const chatRestrictionColumns = `r.station_id, r.user_id, COALESCE(u.name, ''), r.kind, r.reason, r.expires_at, r.created_by, r.created_at
+	FROM chat_restrictions r
+	LEFT JOIN users u ON u.id = r.user_id`
+
+// ActiveChatRestriction returns the restriction a user is under on a station,
+// or sql.ErrNoRows when they may chat
+func ActiveChatRestriction(stationID, userID int) (models.ChatRestriction, error) {
+	return scanChatRestriction(DB.QueryRow(`
+		SELECT `+chatRestrictionColumns+`
+		WHERE r.station_id = $1 AND r.user_id = $2 AND (r.expires_at IS NULL OR r.expires_at > NOW())
+	`, stationID, userID))
+}
+
+// ListChatRestrictions returns a station's restrictions that haven't expired
+func ListChatRestrictions(stationID int) ([]models.ChatRestriction, error) {
+	rows, err := DB.Query(`
+		SELECT `+chatRestrictionColumns+`
+		WHERE r.station_id = $1 AND (r.expires_at IS NULL OR r.expires_at > NOW())
+		ORDER BY r.created_at DESC
+	`, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	restrictions := []models.ChatRestriction{}
+	for rows.Next() {
+		r, err := scanChatRestriction(rows)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+	return restrictions, rows.Err()
+}
+
+// SetChatRestriction mutes or bans a user on a station, replacing any
+// restriction they were already under. A zero duration never expires.
+func SetChatRestriction(stationID, userID int, kind, reason string, duration time.Duration, createdBy int) (models.ChatRestriction, error) {
+	var expiresAt *time.Time
+	if duration > 0 {
+		expires := time.Now().Add(duration)
+		expiresAt = &expires
+	}
+
+	_, err := DB.Exec(`
+		INSERT INTO chat_restrictions (station_id, user_id, kind, reason, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0))
+		ON CONFLICT (station_id, user_id) DO UPDATE
+		SET kind = EXCLUDED.kind, reason = EXCLUDED.reason, expires_at = EXCLUDED.expires_at,
+			created_by = EXCLUDED.created_by, created_at = NOW()
+	`, stationID, userID, kind, reason, expiresAt, createdBy)
+	if err != nil {
+		return models.ChatRestriction{}, err
+	}
+	return ActiveChatRestriction(stationID, userID)
+}
+
+// LiftChatRestriction lets a user chat on a station again. It returns
+// sql.ErrNoRows when they weren't restricted.
+func LiftChatRestriction(stationID, userID int) error {
+	result, err := DB.Exec("DELETE FROM chat_restrictions WHERE station_id = $1 AND user_id = $2", stationID, userID)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanChatMessage(row interface{ Scan(...interface{}) error }) (models.ChatMessage, error) {
+	var m models.ChatMessage
+	err := row.Scan(&m.ID, &m.StationID, &m.UserID, &m.UserName, &m.Text, &m.SentAt)
+	return m, err
+}
+
+func scanChatRestriction(row interface{ Scan(...interface{}) error }) (models.ChatRestriction, error) {
+	var r models.ChatRestriction
+	var expiresAt sql.NullTime
+	var createdBy sql.NullInt64
+	err := row.Scan(&r.StationID, &r.UserID, &r.UserName, &r.Kind, &r.Reason, &expiresAt, &createdBy, &r.CreatedAt)
+	if err != nil {
+		return r, err
+	}
+	if expiresAt.Valid {
+		r.ExpiresAt = &expiresAt.Time
+	}
+	r.CreatedBy = NullIntPtr(createdBy)
+	return r, nil
+}
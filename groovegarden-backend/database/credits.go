@@ -0,0 +1,181 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"groovegarden/models"
+)
+
+// Credit transaction kinds
+const (
+	CreditListening  = "listening"   // Earned for time tuned in to a station
+	CreditDailyLogin = "daily_login" // Earned once per day
+	CreditRequest    = "request"     // Earned when a listener's request airs
+	CreditVoteBoost  = "vote_boost"  // Spent to add weight to a vote
+	CreditQueueJump  = "queue_jump"  // Spent to put a song at the front of a queue
+	CreditGrant      = "grant"       // Added by an admin
+	CreditRefund     = "refund"      // Reverses a spend
+)
+
+// ErrInsufficientCredits is returned when a spend exceeds the user's balance
+var ErrInsufficientCredits = errors.New("not enough credits")
+
+// ensureCreditTables creates the credit ledger. Transactions are never
+// updated or deleted; balances are the sum of a user's rows.
+func ensureCreditTables() error {
+	// dedupe_key makes one-off awards (a day's login, a played request, a refund) idempotent
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS credit_transactions (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			amount INTEGER NOT NULL CHECK (amount <> 0),
+			kind TEXT NOT NULL,
+			station_id INTEGER REFERENCES stations(id) ON DELETE SET NULL,
+			song_id INTEGER REFERENCES songs(id) ON DELETE SET NULL,
+			ref_id BIGINT REFERENCES credit_transactions(id),
+			note TEXT NOT NULL DEFAULT '',
+			created_by INTEGER REFERENCES users(id),
+			dedupe_key TEXT UNIQUE,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS credit_transactions_user_idx ON credit_transactions (user_id, created_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating credit_transactions table: %w", err)
+	}
+
+	// Station and song deletions still null their references, nothing else may change a row
+	_, err = DB.Exec(`
+		CREATE OR REPLACE FUNCTION credit_transactions_append_only() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'UPDATE'
+			   AND NEW.id = OLD.id AND NEW.user_id = OLD.user_id AND NEW.amount = OLD.amount
+			   AND NEW.kind = OLD.kind AND NEW.note = OLD.note AND NEW.created_at = OLD.created_at
+			   AND NEW.created_by IS NOT DISTINCT FROM OLD.created_by
+			   AND NEW.ref_id IS NOT DISTINCT FROM OLD.ref_id
+			   AND NEW.dedupe_key IS NOT DISTINCT FROM OLD.dedupe_key THEN
+				RETURN NEW;
+			END IF;
+			RAISE EXCEPTION 'credit_transactions is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS credit_transactions_append_only ON credit_transactions;
+		CREATE TRIGGER credit_transactions_append_only
+			BEFORE UPDATE OR DELETE ON credit_transactions
+			FOR EACH ROW EXECUTE FUNCTION credit_transactions_append_only();
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating credit ledger trigger: %w", err)
+	}
+
+	// Paid queue jumps play ahead of the rest of the queue
+	_, err = DB.Exec(`ALTER TABLE station_queue ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		return fmt.Errorf("error adding priority to station_queue table: %w", err)
+	}
+
+	// Listening time not yet turned into credits
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS credit_listening (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			station_id INTEGER NOT NULL,
+			seconds INTEGER NOT NULL DEFAULT 0,
+			last_heartbeat TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating credit_listening table: %w", err)
+	}
+	return nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// CreditBalance sums a user's ledger
+func CreditBalance(q queryRower, userID int) (int, error) {
+	var balance int
+	err := q.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM credit_transactions WHERE user_id = $1", userID).Scan(&balance)
+	return balance, err
+}
+
+// AddCredits appends a transaction to the ledger and returns its ID. With a
+// dedupeKey, a transaction already recorded under the same key is not
+// repeated and the returned ID is 0.
+func AddCredits(q queryRower, t models.CreditTransaction, dedupeKey string) (int64, error) {
+	var id int64
+	err := q.QueryRow(`
+		INSERT INTO credit_transactions (user_id, amount, kind, station_id, song_id, ref_id, note, created_by, dedupe_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		ON CONFLICT (dedupe_key) DO NOTHING
+		RETURNING id
+	`, t.UserID, t.Amount, t.Kind, t.StationID, t.SongID, t.RefID, t.Note, t.CreatedBy, dedupeKey).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// SpendCredits debits t.Amount credits within tx, returning
+// ErrInsufficientCredits rather than letting the balance go negative
+func SpendCredits(tx *sql.Tx, t models.CreditTransaction) (int64, error) {
+	// Locking the user serialises concurrent spends of the same balance
+	if _, err := tx.Exec("SELECT 1 FROM users WHERE id = $1 FOR UPDATE", t.UserID); err != nil {
+		return 0, err
+	}
+	balance, err := CreditBalance(tx, t.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if balance < t.Amount {
+		return 0, ErrInsufficientCredits
+	}
+	t.Amount = -t.Amount
+	return AddCredits(tx, t, "")
+}
+
+// ListCreditTransactions returns a user's most recent transactions, newest first
+func ListCreditTransactions(userID, limit int) ([]models.CreditTransaction, error) {
+	rows, err := DB.Query(`
+		SELECT id, user_id, amount, kind, station_id, song_id, ref_id, note, created_by, created_at
+		FROM credit_transactions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.CreditTransaction{}
+	for rows.Next() {
+		t, err := ScanCreditTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// ScanCreditTransaction scans a row selected with the columns ListCreditTransactions uses
+func ScanCreditTransaction(row interface{ Scan(...interface{}) error }) (models.CreditTransaction, error) {
+	var t models.CreditTransaction
+	var stationID, songID, refID, createdBy sql.NullInt64
+	err := row.Scan(&t.ID, &t.UserID, &t.Amount, &t.Kind, &stationID, &songID, &refID, &t.Note, &createdBy, &t.CreatedAt)
+	if err != nil {
+		return t, err
+	}
+	t.StationID = NullIntPtr(stationID)
+	t.SongID = NullIntPtr(songID)
+	t.CreatedBy = NullIntPtr(createdBy)
+	if refID.Valid {
+		t.RefID = &refID.Int64
+	}
+	return t, nil
+}
@@ -15,6 +15,10 @@ import (
 // This is the consolidated database connection handling - db.go has been removed
 var DB *sql.DB
 
+// ConnInfo is the connection string DB was opened with, for the dedicated
+// connections LISTEN needs outside the pool
+var ConnInfo string
+
 // GetDB returns the database connection
 func GetDB() (*sql.DB, error) {
 	if DB == nil {
@@ -172,6 +176,8 @@ func Connect() error {
 		}
 	}
 
+	ConnInfo = connStr
+
 	// Set connection pool parameters
 	DB.SetMaxOpenConns(25)
 	DB.SetMaxIdleConns(5)
@@ -238,6 +244,168 @@ func InitializeDatabase() error {
 		return fmt.Errorf("error creating songs table: %w", err)
 	}
 
+	// Full-text search: pg_trgm gives typo tolerance on top of the tsvector
+	_, err = DB.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`)
+	if err != nil {
+		return fmt.Errorf("error enabling pg_trgm extension: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		ALTER TABLE songs
+		ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding search columns to songs table: %w", err)
+	}
+
+	// Editable song metadata
+	_, err = DB.Exec(`
+		ALTER TABLE songs
+		ADD COLUMN IF NOT EXISTS explicit BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW()
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding metadata columns to songs table: %w", err)
+	}
+
+	// Replaced audio masters are kept as revisions so a song keeps its ID, votes and history
+	_, err = DB.Exec(`ALTER TABLE songs ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1`)
+	if err != nil {
+		return fmt.Errorf("error adding revision column to songs table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS song_revisions (
+			id SERIAL PRIMARY KEY,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			revision INTEGER NOT NULL,
+			storage_path TEXT NOT NULL,
+			duration INTEGER DEFAULT 0,
+			replaced_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			replaced_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE (song_id, revision)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating song_revisions table: %w", err)
+	}
+
+	// Releases group songs into singles, EPs and albums
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS releases (
+			id SERIAL PRIMARY KEY,
+			artist_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			title TEXT NOT NULL,
+			release_type TEXT NOT NULL DEFAULT 'single' CHECK (release_type IN ('single', 'ep', 'album')),
+			release_date DATE,
+			cover_path TEXT,
+			created_at TIMESTAMP DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating releases table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		ALTER TABLE songs
+		ADD COLUMN IF NOT EXISTS release_id INTEGER REFERENCES releases(id) ON DELETE SET NULL,
+		ADD COLUMN IF NOT EXISTS track_number INTEGER
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding release columns to songs table: %w", err)
+	}
+
+	// Genres, moods and free tags linked to songs
+	if err := ensureTaxonomyTables(); err != nil {
+		return err
+	}
+
+	// Stations with their own queues and vote rounds
+	if err := ensureStationTables(); err != nil {
+		return err
+	}
+
+	// Playlists and the programming schedule
+	if err := ensureScheduleTables(); err != nil {
+		return err
+	}
+
+	// Jingles and the rules inserting them between songs
+	if err := ensureJingleTables(); err != nil {
+		return err
+	}
+
+	// Play history, also used to keep songs from repeating
+	if err := ensurePlayTables(); err != nil {
+		return err
+	}
+
+	// Hourly listener peaks and averages
+	if err := ensureListenerTables(); err != nil {
+		return err
+	}
+
+	// Listener song requests and dedications
+	if err := ensureRequestTables(); err != nil {
+		return err
+	}
+
+	// Listener credits for boosting votes and jumping queues
+	if err := ensureCreditTables(); err != nil {
+		return err
+	}
+
+	// Station chat scrollback, mutes and bans
+	if err := ensureChatTables(); err != nil {
+		return err
+	}
+
+	// Private listening parties playing songs in sync
+	if err := ensurePartyTables(); err != nil {
+		return err
+	}
+
+	// Who is tuned in to which station
+	if err := ensurePresenceTables(); err != nil {
+		return err
+	}
+
+	// Oversized realtime events passed between backend instances
+	if err := ensureEventTables(); err != nil {
+		return err
+	}
+
+	// Per-artist analytics rollups
+	if err := ensureStatsTables(); err != nil {
+		return err
+	}
+
+	// Emoji reactions to songs on air
+	if err := ensureReactionTables(); err != nil {
+		return err
+	}
+
+	_, err = DB.Exec(`
+		CREATE INDEX IF NOT EXISTS songs_search_vector_idx ON songs USING GIN (search_vector);
+		CREATE INDEX IF NOT EXISTS songs_title_trgm_idx ON songs USING GIN (title gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS songs_artist_trgm_idx ON songs USING GIN (artist gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating search indexes: %w", err)
+	}
+
+	// Song search vectors are kept current by triggers
+	if err := ensureSearchTriggers(); err != nil {
+		return err
+	}
+
+	// Backfill search vectors for songs created before search existed
+	_, err = DB.Exec(`UPDATE songs s SET search_vector = ` + songSearchVectorExpr + ` WHERE s.search_vector IS NULL`)
+	if err != nil {
+		return fmt.Errorf("error backfilling song search vectors: %w", err)
+	}
+
 	// Insert default users if not exist
 	_, err = DB.Exec(`
 		INSERT INTO users (id, name, email, account_type)
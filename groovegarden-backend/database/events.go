@@ -0,0 +1,25 @@
+package database
+
+import (
+	"fmt"
+)
+
+// EventChannel is the LISTEN/NOTIFY channel carrying realtime events between backend instances
+const EventChannel = "groovegarden_events"
+
+// ensureEventTables creates the table for realtime events too large for a
+// NOTIFY payload; instances notify the row ID instead and prune old rows
+func ensureEventTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS bus_events (
+			id BIGSERIAL PRIMARY KEY,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS bus_events_created_idx ON bus_events (created_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating bus_events table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"groovegarden/models"
+)
+
+// Jingle kinds
+const (
+	JingleStationID = "station_id" // "You're listening to..." idents
+	JingleSponsor   = "sponsor"    // Paid spots
+	JinglePromo     = "promo"      // Artist and show promos
+)
+
+// ensureJingleTables creates jingles, the rules inserting them and their own play log,
+// kept apart from music plays so spots never count toward votes or royalties
+func ensureJingleTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS jingles (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL,
+			kind TEXT NOT NULL CHECK (kind IN ('station_id', 'sponsor', 'promo')),
+			storage_path TEXT NOT NULL,
+			duration INTEGER NOT NULL DEFAULT 0,
+			station_id INTEGER REFERENCES stations(id) ON DELETE CASCADE,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating jingles table: %w", err)
+	}
+
+	// A rule fires either after every_tracks music tracks, or at the listed
+	// minutes past each hour in the station's timezone
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS insertion_rules (
+			id SERIAL PRIMARY KEY,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL CHECK (kind IN ('station_id', 'sponsor', 'promo')),
+			every_tracks INTEGER CHECK (every_tracks > 0),
+			at_minutes INTEGER[],
+			created_at TIMESTAMP DEFAULT NOW(),
+			CHECK ((every_tracks IS NULL) <> (at_minutes IS NULL))
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating insertion_rules table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS jingle_plays (
+			id SERIAL PRIMARY KEY,
+			jingle_id INTEGER NOT NULL REFERENCES jingles(id) ON DELETE CASCADE,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			rule_id INTEGER REFERENCES insertion_rules(id) ON DELETE SET NULL,
+			started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			ended_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS jingle_plays_station_idx ON jingle_plays (station_id, started_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating jingle_plays table: %w", err)
+	}
+
+	return nil
+}
+
+// ListInsertionRules returns a station's jingle insertion rules
+func ListInsertionRules(stationID int) ([]models.InsertionRule, error) {
+	rows, err := DB.Query(`
+		SELECT id, station_id, kind, every_tracks, at_minutes
+		FROM insertion_rules
+		WHERE station_id = $1
+		ORDER BY id
+	`, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.InsertionRule{}
+	for rows.Next() {
+		var rule models.InsertionRule
+		var everyTracks sql.NullInt64
+		var minutes pq.Int64Array
+		if err := rows.Scan(&rule.ID, &rule.StationID, &rule.Kind, &everyTracks, &minutes); err != nil {
+			return nil, err
+		}
+		rule.EveryTracks = NullIntPtr(everyTracks)
+		for _, minute := range minutes {
+			rule.AtMinutes = append(rule.AtMinutes, int(minute))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ListenerSample is one instance's view of a station's audience: its
+// websocket sessions and the listener keys (with countries) behind them
+type ListenerSample struct {
+	StationID int
+	Sessions  int
+	Keys      []string
+	Countries []string
+}
+
+// ensureListenerTables creates the hourly audience statistics. Each sample
+// raises the peak and adds to the running total; average = total / samples.
+func ensureListenerTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS listener_stats (
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			hour TIMESTAMP NOT NULL,
+			peak INTEGER NOT NULL DEFAULT 0,
+			samples INTEGER NOT NULL DEFAULT 0,
+			total BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (station_id, hour)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating listener_stats table: %w", err)
+	}
+
+	// Every instance's latest sample of its own connections, merged by the leader
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS listener_samples (
+			instance TEXT NOT NULL,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			sessions INTEGER NOT NULL DEFAULT 0,
+			listener_keys TEXT[] NOT NULL DEFAULT '{}',
+			countries TEXT[] NOT NULL DEFAULT '{}',
+			sampled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (instance, station_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating listener_samples table: %w", err)
+	}
+	return nil
+}
+
+// SaveListenerSamples replaces an instance's samples with its latest ones
+func SaveListenerSamples(instance string, samples []ListenerSample) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM listener_samples WHERE instance = $1", instance); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		_, err := tx.Exec(`
+			INSERT INTO listener_samples (instance, station_id, sessions, listener_keys, countries)
+			VALUES ($1, $2, $3, $4, $5)
+		`, instance, sample.StationID, sample.Sessions, pq.Array(sample.Keys), pq.Array(sample.Countries))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListenerSamples returns every instance's samples taken within maxAge,
+// dropping older ones left by instances that went away
+func ListenerSamples(maxAge time.Duration) ([]ListenerSample, error) {
+	since := time.Now().Add(-maxAge)
+	if _, err := DB.Exec("DELETE FROM listener_samples WHERE sampled_at < $1", since); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT station_id, sessions, listener_keys, countries
+		FROM listener_samples
+		WHERE sampled_at >= $1
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []ListenerSample{}
+	for rows.Next() {
+		var sample ListenerSample
+		if err := rows.Scan(&sample.StationID, &sample.Sessions, pq.Array(&sample.Keys), pq.Array(&sample.Countries)); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
@@ -0,0 +1,260 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"groovegarden/models"
+)
+
+// ensurePartyTables creates listening parties and their members
+func ensurePartyTables() error {
+	// The playback state is the position at state_at, moving on while playing
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS listening_parties (
+			id SERIAL PRIMARY KEY,
+			code TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL DEFAULT '',
+			host_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			song_id INTEGER REFERENCES songs(id) ON DELETE SET NULL,
+			playing BOOLEAN NOT NULL DEFAULT FALSE,
+			position_ms BIGINT NOT NULL DEFAULT 0,
+			state_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			ended_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS listening_parties_host_idx ON listening_parties (host_id) WHERE ended_at IS NULL;
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating listening_parties table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS listening_party_members (
+			party_id INTEGER NOT NULL REFERENCES listening_parties(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (party_id, user_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating listening_party_members table: %w", err)
+	}
+	return nil
+}
+
+// partyColumns are the columns scanned by scanParty
+const partyColumns = `p.id, p.code, p.name, p.host_id, COALESCE(u.name, ''), p.song_id, COALESCE(s.duration, 0),
+	p.playing, p.position_ms, p.state_at, p.created_at, p.ended_at
+	FROM listening_parties p
+	LEFT JOIN users u ON u.id = p.host_id
+	LEFT JOIN songs s ON s.id = p.song_id`
+
+// CreateParty opens a listening party with its host as the first member
+func CreateParty(hostID int, name, code string, songID *int) (models.ListeningParty, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return models.ListeningParty{}, err
+	}
+	defer tx.Rollback()
+
+	var partyID int
+	err = tx.QueryRow(
+		"INSERT INTO listening_parties (code, name, host_id, song_id) VALUES ($1, $2, $3, $4) RETURNING id",
+		code, name, hostID, songID,
+	).Scan(&partyID)
+	if err != nil {
+		return models.ListeningParty{}, err
+	}
+	if _, err := tx.Exec("INSERT INTO listening_party_members (party_id, user_id) VALUES ($1, $2)", partyID, hostID); err != nil {
+		return models.ListeningParty{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ListeningParty{}, err
+	}
+	return GetParty(partyID)
+}
+
+// GetParty loads a listening party with its members
+func GetParty(partyID int) (models.ListeningParty, error) {
+	party, err := scanParty(DB.QueryRow("SELECT "+partyColumns+" WHERE p.id = $1", partyID))
+	if err != nil {
+		return party, err
+	}
+	party.Members, err = ListPartyMembers(partyID)
+	return party, err
+}
+
+// GetPartyByCode finds a party that hasn't ended by its invite code
+func GetPartyByCode(code string) (models.ListeningParty, error) {
+	party, err := scanParty(DB.QueryRow("SELECT "+partyColumns+" WHERE p.code = $1 AND p.ended_at IS NULL", code))
+	if err != nil {
+		return party, err
+	}
+	party.Members, err = ListPartyMembers(party.ID)
+	return party, err
+}
+
+// ListPartyMembers returns a party's members in the order they joined
+func ListPartyMembers(partyID int) ([]models.PartyMember, error) {
+	rows, err := DB.Query(`
+		SELECT m.party_id, m.user_id, COALESCE(u.name, ''), m.joined_at
+		FROM listening_party_members m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.party_id = $1
+		ORDER BY m.joined_at, m.user_id
+	`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.PartyMember{}
+	for rows.Next() {
+		var m models.PartyMember
+		if err := rows.Scan(&m.PartyID, &m.UserID, &m.UserName, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// IsPartyMember reports whether a user is in a party that hasn't ended
+func IsPartyMember(partyID, userID int) (bool, error) {
+	var member bool
+	err := DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM listening_party_members m JOIN listening_parties p ON p.id = m.party_id
+			WHERE m.party_id = $1 AND m.user_id = $2 AND p.ended_at IS NULL
+		)
+	`, partyID, userID).Scan(&member)
+	return member, err
+}
+
+// JoinParty adds a user to a party unless it already has maxMembers, and
+// reports whether they weren't a member before. The party row is locked so
+// concurrent joins can't count the same members and go past the limit.
+func JoinParty(partyID, userID, maxMembers int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT 1 FROM listening_parties WHERE id = $1 FOR UPDATE", partyID); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO listening_party_members (party_id, user_id)
+		SELECT $1, $2
+		WHERE (SELECT COUNT(*) FROM listening_party_members WHERE party_id = $1) < $3
+		ON CONFLICT DO NOTHING
+	`, partyID, userID, maxMembers)
+	if err != nil {
+		return false, err
+	}
+	joined, _ := result.RowsAffected()
+	return joined > 0, tx.Commit()
+}
+
+// LeaveParty removes a user from a party and reports whether they were in it
+func LeaveParty(partyID, userID int) (bool, error) {
+	result, err := DB.Exec("DELETE FROM listening_party_members WHERE party_id = $1 AND user_id = $2", partyID, userID)
+	if err != nil {
+		return false, err
+	}
+	left, _ := result.RowsAffected()
+	return left > 0, nil
+}
+
+// EndParty closes a party; it returns sql.ErrNoRows if it had already ended
+func EndParty(partyID int) error {
+	result, err := DB.Exec("UPDATE listening_parties SET ended_at = NOW(), playing = FALSE WHERE id = $1 AND ended_at IS NULL", partyID)
+	if err != nil {
+		return err
+	}
+	if ended, _ := result.RowsAffected(); ended == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdatePartyState changes a live party's playback. update gets the state
+// as of now and the current time, and its changes are saved as of that time.
+// Returns sql.ErrNoRows if the party has ended.
+func UpdatePartyState(partyID int, update func(state *models.PartyState, now time.Time) error) (models.PartyState, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return models.PartyState{}, err
+	}
+	defer tx.Rollback()
+
+	party, err := scanParty(tx.QueryRow("SELECT "+partyColumns+" WHERE p.id = $1 AND p.ended_at IS NULL FOR UPDATE OF p", partyID))
+	if err != nil {
+		return models.PartyState{}, err
+	}
+
+	now := time.Now()
+	state := party.State
+	state.PositionMS = PartyPosition(state, now)
+	state.ServerTime = now.UnixMilli()
+	if err := update(&state, now); err != nil {
+		return state, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE listening_parties SET song_id = $2, playing = $3, position_ms = $4, state_at = $5 WHERE id = $1",
+		partyID, state.SongID, state.Playing, state.PositionMS, now,
+	)
+	if err != nil {
+		return state, err
+	}
+	if err := tx.Commit(); err != nil {
+		return state, err
+	}
+
+	// The song may have changed, so refresh what's derived from it
+	party, err = scanParty(DB.QueryRow("SELECT "+partyColumns+" WHERE p.id = $1", partyID))
+	return party.State, err
+}
+
+// PartyPosition is where a party's song is at a given time, stopping at its end
+func PartyPosition(state models.PartyState, at time.Time) int64 {
+	position := state.PositionMS
+	if state.Playing {
+		position += at.UnixMilli() - state.ServerTime
+	}
+	if state.DurationMS > 0 && position > state.DurationMS {
+		position = state.DurationMS
+	}
+	if position < 0 {
+		position = 0
+	}
+	return position
+}
+
+func scanParty(row interface{ Scan(...interface{}) error }) (models.ListeningParty, error) {
+	var p models.ListeningParty
+	var songID sql.NullInt64
+	var duration int64
+	var stateAt time.Time
+	var endedAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Code, &p.Name, &p.HostID, &p.HostName, &songID, &duration,
+		&p.State.Playing, &p.State.PositionMS, &stateAt, &p.CreatedAt, &endedAt)
+	if err != nil {
+		return p, err
+	}
+	p.State.PartyID = p.ID
+	p.State.SongID = NullIntPtr(songID)
+	if p.State.SongID != nil {
+		p.State.StreamURL = fmt.Sprintf("/stream/%d", *p.State.SongID)
+	}
+	p.State.DurationMS = duration * 1000
+	p.State.ServerTime = stateAt.UnixMilli()
+	if endedAt.Valid {
+		p.EndedAt = &endedAt.Time
+	}
+	return p, nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"groovegarden/models"
+)
+
+func TestPartyPosition(t *testing.T) {
+	stateAt := time.Date(2024, 6, 8, 20, 0, 0, 0, time.UTC)
+	state := func(playing bool, positionMS, durationMS int64) models.PartyState {
+		return models.PartyState{Playing: playing, PositionMS: positionMS, DurationMS: durationMS, ServerTime: stateAt.UnixMilli()}
+	}
+
+	tests := []struct {
+		name  string
+		state models.PartyState
+		at    time.Time
+		want  int64
+	}{
+		{"paused stays put", state(false, 30_000, 180_000), stateAt.Add(time.Minute), 30_000},
+		{"playing moves on", state(true, 30_000, 180_000), stateAt.Add(1500 * time.Millisecond), 31_500},
+		{"playing at the state time", state(true, 30_000, 180_000), stateAt, 30_000},
+		{"stops at the end of the song", state(true, 170_000, 180_000), stateAt.Add(time.Minute), 180_000},
+		{"paused past the end is clamped", state(false, 200_000, 180_000), stateAt, 180_000},
+		{"unknown duration isn't clamped", state(true, 170_000, 0), stateAt.Add(time.Minute), 230_000},
+		{"clock behind the state time", state(true, 500, 180_000), stateAt.Add(-time.Second), 0},
+		{"no song", state(false, 0, 0), stateAt.Add(time.Hour), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PartyPosition(tt.state, tt.at); got != tt.want {
+				t.Errorf("got %dms, want %dms", got, tt.want)
+			}
+		})
+	}
+}
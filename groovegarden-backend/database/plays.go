@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"groovegarden/models"
+)
+
+// RecentlyPlayed is true when a song (aliased "s") aired on a station
+// (aliased "st") within the station's repeat window
+const RecentlyPlayed = `EXISTS (
+	SELECT 1 FROM plays rp
+	WHERE rp.station_id = st.id AND rp.song_id = s.id
+	  AND rp.started_at >= NOW() - make_interval(mins => st.repeat_window_minutes))`
+
+// PlayoutState is what a running station is doing, as published by the
+// instance running its playout
+type PlayoutState struct {
+	StationID  int
+	PlayID     int                // Plays row of the song on air, 0 for none
+	NowPlaying *models.NowPlaying // Nil while idle
+}
+
+// ensurePlayTables creates the log of what actually went out on each station
+// and the listener signals about it. The log is an audit trail: a play keeps
+// the song's title, artist and length as they were when it aired, and stays
+// (with song_id or station_id cleared) when the song or station is deleted.
+func ensurePlayTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS plays (
+			id SERIAL PRIMARY KEY,
+			song_id INTEGER REFERENCES songs(id) ON DELETE SET NULL,
+			station_id INTEGER REFERENCES stations(id) ON DELETE SET NULL,
+			title TEXT NOT NULL DEFAULT '',
+			artist TEXT NOT NULL DEFAULT '',
+			artist_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			duration INTEGER NOT NULL DEFAULT 0,
+			source TEXT NOT NULL,
+			started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			ended_at TIMESTAMP,
+			listener_count INTEGER NOT NULL DEFAULT 0,
+			skipped BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS plays_station_idx ON plays (station_id, started_at);
+		CREATE INDEX IF NOT EXISTS plays_song_idx ON plays (song_id, started_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating plays table: %w", err)
+	}
+
+	// Who heard each play, by anonymous listener key, for per-artist audience stats
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS play_listeners (
+			play_id INTEGER NOT NULL REFERENCES plays(id) ON DELETE CASCADE,
+			listener_key TEXT NOT NULL,
+			country TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (play_id, listener_key)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating play_listeners table: %w", err)
+	}
+
+	// A song played on a station stays out of its rotation for this long
+	_, err = DB.Exec(`ALTER TABLE stations ADD COLUMN IF NOT EXISTS repeat_window_minutes INTEGER NOT NULL DEFAULT 60`)
+	if err != nil {
+		return fmt.Errorf("error adding repeat_window_minutes column to stations table: %w", err)
+	}
+
+	// Listeners vote to skip the play on air; it is cut once skip_min_votes and
+	// skip_ratio of the current listeners have voted
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS skip_votes (
+			play_id INTEGER NOT NULL REFERENCES plays(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (play_id, user_id)
+		);
+		ALTER TABLE stations
+		ADD COLUMN IF NOT EXISTS skip_ratio REAL NOT NULL DEFAULT 0.5,
+		ADD COLUMN IF NOT EXISTS skip_min_votes INTEGER NOT NULL DEFAULT 2;
+		ALTER TABLE songs ADD COLUMN IF NOT EXISTS skips INTEGER NOT NULL DEFAULT 0;
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating skip votes: %w", err)
+	}
+
+	// The leader instance's running stations, so every instance can answer
+	// what is on air; a row exists while the station's playout runs
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS playout_state (
+			station_id INTEGER PRIMARY KEY REFERENCES stations(id) ON DELETE CASCADE,
+			play_id INTEGER,
+			now_playing JSONB,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating playout_state table: %w", err)
+	}
+
+	return nil
+}
+
+// SetPlayoutState records what a running station is doing
+func SetPlayoutState(state PlayoutState) error {
+	var nowPlaying []byte
+	if state.NowPlaying != nil {
+		var err error
+		if nowPlaying, err = json.Marshal(state.NowPlaying); err != nil {
+			return err
+		}
+	}
+	_, err := DB.Exec(`
+		INSERT INTO playout_state (station_id, play_id, now_playing, updated_at)
+		VALUES ($1, NULLIF($2, 0), $3, NOW())
+		ON CONFLICT (station_id) DO UPDATE SET
+			play_id = EXCLUDED.play_id, now_playing = EXCLUDED.now_playing, updated_at = NOW()
+	`, state.StationID, state.PlayID, nowPlaying)
+	return err
+}
+
+// GetPlayoutState returns what a station is doing, or nil when its playout isn't running
+func GetPlayoutState(stationID int) (*PlayoutState, error) {
+	var playID sql.NullInt64
+	var nowPlaying []byte
+	err := DB.QueryRow("SELECT play_id, now_playing FROM playout_state WHERE station_id = $1", stationID).Scan(&playID, &nowPlaying)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &PlayoutState{StationID: stationID, PlayID: int(playID.Int64)}
+	if nowPlaying != nil {
+		if err := json.Unmarshal(nowPlaying, &state.NowPlaying); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// DeletePlayoutState marks a station's playout as stopped
+func DeletePlayoutState(stationID int) error {
+	_, err := DB.Exec("DELETE FROM playout_state WHERE station_id = $1", stationID)
+	return err
+}
+
+// ClearPlayoutState forgets every station's playout, left over from a
+// previous leader, before a new leader starts its own
+func ClearPlayoutState() error {
+	_, err := DB.Exec("DELETE FROM playout_state")
+	return err
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"groovegarden/models"
+)
+
+// PresenceTimeout is how long a presence row lasts without a heartbeat from
+// its instance, so listeners on an instance that died drop out
+const PresenceTimeout = 3 * time.Minute
+
+// ensurePresenceTables creates station presence and the users' privacy setting for it
+func ensurePresenceTables() error {
+	// One row per instance a user is connected through
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS station_presence (
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			instance TEXT NOT NULL,
+			joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (station_id, user_id, instance)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating station_presence table: %w", err)
+	}
+
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS show_presence BOOLEAN NOT NULL DEFAULT TRUE`)
+	if err != nil {
+		return fmt.Errorf("error adding show_presence column to users table: %w", err)
+	}
+	return nil
+}
+
+// presenceFresh matches presence rows still kept alive by their instance
+var presenceFresh = fmt.Sprintf("p.seen_at > NOW() - make_interval(secs => %d)", int(PresenceTimeout.Seconds()))
+
+// JoinPresence records users tuned in to a station through an instance, or
+// keeps them alive if they already are, and updates their last_seen
+func JoinPresence(stationID int, userIDs []int, instance string) error {
+	_, err := DB.Exec(`
+		INSERT INTO station_presence (station_id, user_id, instance)
+		SELECT $1, unnest($2::INTEGER[]), $3
+		ON CONFLICT (station_id, user_id, instance) DO UPDATE SET seen_at = NOW()
+	`, stationID, pq.Array(userIDs), instance)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE users SET last_seen = NOW() WHERE id = ANY($1)", pq.Array(userIDs))
+	return err
+}
+
+// LeavePresence removes a user's presence on a station through an instance and updates their last_seen
+func LeavePresence(stationID, userID int, instance string) error {
+	_, err := DB.Exec("DELETE FROM station_presence WHERE station_id = $1 AND user_id = $2 AND instance = $3",
+		stationID, userID, instance)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE users SET last_seen = NOW() WHERE id = $1", userID)
+	return err
+}
+
+// IsPresent reports whether a user is tuned in to a station through an open
+// connection on any instance
+func IsPresent(stationID, userID int) (bool, error) {
+	var present bool
+	err := DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM station_presence p
+			WHERE p.station_id = $1 AND p.user_id = $2 AND `+presenceFresh+`
+		)
+	`, stationID, userID).Scan(&present)
+	return present, err
+}
+
+// PresentElsewhere reports whether a user is tuned in to a station through
+// another instance, and whether they let others see it
+func PresentElsewhere(stationID, userID int, instance string) (elsewhere bool, visible bool, name string, err error) {
+	err = DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM station_presence p
+			WHERE p.station_id = $1 AND p.user_id = $2 AND p.instance <> $3 AND `+presenceFresh+`
+		), u.show_presence, u.name
+		FROM users u WHERE u.id = $2
+	`, stationID, userID, instance).Scan(&elsewhere, &visible, &name)
+	return elsewhere, visible, name, err
+}
+
+// PrunePresence deletes presence rows whose instance stopped sending heartbeats
+func PrunePresence() error {
+	_, err := DB.Exec("DELETE FROM station_presence p WHERE NOT (" + presenceFresh + ")")
+	return err
+}
+
+// GetStationPresence lists the signed-in users tuned in to a station, longest listening first
+func GetStationPresence(stationID int) (models.StationPresence, error) {
+	presence := models.StationPresence{StationID: stationID, Listeners: []models.PresentListener{}}
+	rows, err := DB.Query(`
+		SELECT u.id, u.name, u.show_presence, MIN(p.joined_at)
+		FROM station_presence p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.station_id = $1 AND `+presenceFresh+`
+		GROUP BY u.id
+		ORDER BY MIN(p.joined_at), u.id
+	`, stationID)
+	if err != nil {
+		return presence, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.PresentListener
+		var visible bool
+		if err := rows.Scan(&l.UserID, &l.UserName, &visible, &l.Since); err != nil {
+			return presence, err
+		}
+		if visible {
+			presence.Listeners = append(presence.Listeners, l)
+		} else {
+			presence.Hidden++
+		}
+	}
+	return presence, rows.Err()
+}
+
+// SetShowPresence sets whether a user appears in station listener lists
+func SetShowPresence(userID int, visible bool) error {
+	_, err := DB.Exec("UPDATE users SET show_presence = $2 WHERE id = $1", userID, visible)
+	return err
+}
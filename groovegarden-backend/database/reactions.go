@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+)
+
+// Reactions listeners can send to the song on air, with the emoji clients show
+var ReactionEmoji = map[string]string{
+	"fire":   "🔥",
+	"heart":  "❤️",
+	"sleepy": "😴",
+}
+
+// ReactionWeight is how much each reaction counts toward a song's rank. 🔥
+// and ❤️ are praise; 😴 means the song is boring, so it counts against it.
+var ReactionWeight = map[string]int{
+	"fire":   1,
+	"heart":  1,
+	"sleepy": -1,
+}
+
+// SongRankExpr scores songs for ranking: votes, plus the weighted reaction
+// score at a tenth of a vote per reaction, so 😴 lowers a song's rank
+const SongRankExpr = `(s.votes + s.reaction_score / 10.0)`
+
+// ensureReactionTables creates per-song reaction totals and their artist rollup
+func ensureReactionTables() error {
+	// Counted per day, so artist stats can cover any range
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS song_reactions (
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			reaction TEXT NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (song_id, day, reaction)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating song_reactions table: %w", err)
+	}
+
+	// All-time sum of reactions times their ReactionWeight, used in ranking
+	// next to votes
+	_, err = DB.Exec(`ALTER TABLE songs ADD COLUMN IF NOT EXISTS reaction_score INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		return fmt.Errorf("error adding reaction_score column to songs table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		ALTER TABLE artist_daily_stats ADD COLUMN IF NOT EXISTS reactions INTEGER NOT NULL DEFAULT 0;
+		CREATE TABLE IF NOT EXISTS artist_daily_reactions (
+			artist_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			reaction TEXT NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (artist_id, day, reaction)
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating artist reaction stats: %w", err)
+	}
+	return nil
+}
+
+// AddSongReactions adds reaction counts to a song's totals for today and
+// their weighted sum to its reaction score
+func AddSongReactions(songID int, counts map[string]int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	score := 0
+	for reaction, count := range counts {
+		_, err := tx.Exec(`
+			INSERT INTO song_reactions (song_id, day, reaction, count) VALUES ($1, CURRENT_DATE, $2, $3)
+			ON CONFLICT (song_id, day, reaction) DO UPDATE SET count = song_reactions.count + EXCLUDED.count
+		`, songID, reaction, count)
+		if err != nil {
+			return err
+		}
+		score += ReactionWeight[reaction] * count
+	}
+	if _, err := tx.Exec("UPDATE songs SET reaction_score = reaction_score + $2 WHERE id = $1", songID, score); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SongReactionTotals returns a song's all-time count of each reaction
+func SongReactionTotals(songID int) (map[string]int, error) {
+	rows, err := DB.Query("SELECT reaction, SUM(count) FROM song_reactions WHERE song_id = $1 GROUP BY reaction", songID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]int, len(ReactionEmoji))
+	for reaction := range ReactionEmoji {
+		totals[reaction] = 0
+	}
+	for rows.Next() {
+		var reaction string
+		var count int
+		if err := rows.Scan(&reaction, &count); err != nil {
+			return nil, err
+		}
+		totals[reaction] = count
+	}
+	return totals, rows.Err()
+}
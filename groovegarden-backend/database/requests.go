@@ -0,0 +1,46 @@
+package database
+
+import (
+	"fmt"
+)
+
+// Song request statuses
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved" // In the station queue
+	RequestRejected = "rejected"
+	RequestPlayed   = "played"
+)
+
+// ensureRequestTables creates listener song requests and their moderation state
+func ensureRequestTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS song_requests (
+			id SERIAL PRIMARY KEY,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			dedication TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'played')),
+			queue_id INTEGER REFERENCES station_queue(id) ON DELETE SET NULL,
+			decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			decided_at TIMESTAMP,
+			played_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS song_requests_one_pending_idx ON song_requests (user_id) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS song_requests_station_idx ON song_requests (station_id, status, created_at);
+		CREATE INDEX IF NOT EXISTS song_requests_user_song_idx ON song_requests (user_id, song_id, created_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating song_requests table: %w", err)
+	}
+
+	// Stations can approve requests without a dedication automatically
+	_, err = DB.Exec(`ALTER TABLE stations ADD COLUMN IF NOT EXISTS auto_approve_requests BOOLEAN NOT NULL DEFAULT FALSE`)
+	if err != nil {
+		return fmt.Errorf("error adding auto_approve_requests column to stations table: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"groovegarden/models"
+)
+
+// Schedule rules: what the playout does during a slot
+const (
+	RuleVotes    = "votes"    // Listeners' votes decide, as outside any slot
+	RulePlaylist = "playlist" // Play a playlist in order
+	RuleGenre    = "genre"    // Votes decide, but only among songs with a genre/tag
+	RuleLive     = "live"     // A show by one artist: their songs, or their live feed
+)
+
+// ensureScheduleTables creates playlists and the weekly programming grid
+func ensureScheduleTables() error {
+	_, err := DB.Exec(`ALTER TABLE stations ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC'`)
+	if err != nil {
+		return fmt.Errorf("error adding timezone column to stations table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS playlists (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE TABLE IF NOT EXISTS playlist_tracks (
+			playlist_id INTEGER NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			PRIMARY KEY (playlist_id, position)
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating playlist tables: %w", err)
+	}
+
+	// A slot repeats on each listed weekday (0 = Sunday) at start_time in the
+	// station's timezone, for duration_minutes
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schedule_slots (
+			id SERIAL PRIMARY KEY,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			days_of_week INTEGER[] NOT NULL,
+			start_time TIME NOT NULL,
+			duration_minutes INTEGER NOT NULL CHECK (duration_minutes BETWEEN 1 AND 1440),
+			rule TEXT NOT NULL CHECK (rule IN ('votes', 'playlist', 'genre', 'live')),
+			playlist_id INTEGER REFERENCES playlists(id) ON DELETE SET NULL,
+			tag TEXT,
+			artist_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS schedule_slots_station_idx ON schedule_slots (station_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating schedule_slots table: %w", err)
+	}
+
+	return nil
+}
+
+// ListScheduleSlots returns a station's slot definitions
+func ListScheduleSlots(stationID int) ([]models.ScheduleSlot, error) {
+	rows, err := DB.Query(`
+		SELECT id, station_id, name, days_of_week, to_char(start_time, 'HH24:MI'), duration_minutes,
+		       rule, playlist_id, COALESCE(tag, ''), artist_id
+		FROM schedule_slots
+		WHERE station_id = $1
+		ORDER BY start_time, id
+	`, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slots := []models.ScheduleSlot{}
+	for rows.Next() {
+		var slot models.ScheduleSlot
+		var days pq.Int64Array
+		var playlistID, artistID sql.NullInt64
+		err := rows.Scan(&slot.ID, &slot.StationID, &slot.Name, &days, &slot.StartTime, &slot.DurationMinutes,
+			&slot.Rule, &playlistID, &slot.Tag, &artistID)
+		if err != nil {
+			return nil, err
+		}
+		slot.DaysOfWeek = make([]int, len(days))
+		for i, day := range days {
+			slot.DaysOfWeek[i] = int(day)
+		}
+		slot.PlaylistID = NullIntPtr(playlistID)
+		slot.ArtistID = NullIntPtr(artistID)
+		slots = append(slots, slot)
+	}
+	return slots, rows.Err()
+}
@@ -0,0 +1,69 @@
+package database
+
+import "fmt"
+
+// songSearchVectorExpr builds the weighted search document for a song row
+// aliased as "s" (see song_search_vector): title first, then the artist credit
+// and uploader name, then its genre, mood and free tags.
+const songSearchVectorExpr = `song_search_vector(s)`
+
+// ensureSearchTriggers keeps songs.search_vector current from the database
+// itself, so no write path has to remember to refresh it: a song's vector is
+// rebuilt when its title, artist or uploader changes, when its tags change and
+// when its uploader is renamed.
+func ensureSearchTriggers() error {
+	_, err := DB.Exec(`
+		CREATE OR REPLACE FUNCTION song_search_vector(s songs) RETURNS tsvector AS $$
+			SELECT
+				setweight(to_tsvector('simple', COALESCE(s.title, '')), 'A') ||
+				setweight(to_tsvector('simple', COALESCE(s.artist, '') || ' ' ||
+					COALESCE((SELECT u.name FROM users u WHERE u.id = s.artist_id), '')), 'B') ||
+				setweight(to_tsvector('simple', COALESCE((
+					SELECT string_agg(t.name, ' ') FROM song_tags st JOIN tags t ON t.id = st.tag_id
+					WHERE st.song_id = s.id), '')), 'C')
+		$$ LANGUAGE sql STABLE;
+
+		CREATE OR REPLACE FUNCTION songs_search_vector_refresh() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector := song_search_vector(NEW);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS songs_search_vector_refresh ON songs;
+		CREATE TRIGGER songs_search_vector_refresh
+			BEFORE INSERT OR UPDATE OF title, artist, artist_id ON songs
+			FOR EACH ROW EXECUTE FUNCTION songs_search_vector_refresh();
+
+		CREATE OR REPLACE FUNCTION song_tags_search_vector_refresh() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				UPDATE songs s SET search_vector = song_search_vector(s) WHERE s.id = OLD.song_id;
+			END IF;
+			IF TG_OP <> 'DELETE' THEN
+				UPDATE songs s SET search_vector = song_search_vector(s) WHERE s.id = NEW.song_id;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS song_tags_search_vector_refresh ON song_tags;
+		CREATE TRIGGER song_tags_search_vector_refresh
+			AFTER INSERT OR UPDATE OR DELETE ON song_tags
+			FOR EACH ROW EXECUTE FUNCTION song_tags_search_vector_refresh();
+
+		CREATE OR REPLACE FUNCTION users_search_vector_refresh() RETURNS trigger AS $$
+		BEGIN
+			UPDATE songs s SET search_vector = song_search_vector(s) WHERE s.artist_id = NEW.id;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS users_search_vector_refresh ON users;
+		CREATE TRIGGER users_search_vector_refresh
+			AFTER UPDATE OF name ON users
+			FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name)
+			EXECUTE FUNCTION users_search_vector_refresh();
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating search vector triggers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"groovegarden/models"
+)
+
+// GetSong loads a single song with its artist credit, release position and classification
+func GetSong(songID int) (models.Song, error) {
+	song := models.Song{Moods: []string{}, Tags: []string{}}
+	var artistID, releaseID, trackNumber sql.NullInt64
+	var genre, storagePath sql.NullString
+	err := DB.QueryRow(`
+		SELECT s.id, s.title, COALESCE(s.artist, u.name, 'Unknown'), s.artist_id, s.duration,
+		       s.upload_date, s.votes, s.skips, s.storage_path, s.explicit, s.release_id, s.track_number,
+		       `+SongTaxonomyColumns+`
+		FROM songs s
+		LEFT JOIN users u ON s.artist_id = u.id
+		WHERE s.id = $1
+	`, songID).Scan(&song.ID, &song.Title, &song.Artist, &artistID, &song.Duration,
+		&song.UploadDate, &song.Votes, &song.Skips, &storagePath, &song.Explicit, &releaseID, &trackNumber,
+		&genre, pq.Array(&song.Moods), pq.Array(&song.Tags))
+	if err != nil {
+		return song, err
+	}
+	song.ArtistID = NullIntPtr(artistID)
+	song.ReleaseID = NullIntPtr(releaseID)
+	song.TrackNumber = NullIntPtr(trackNumber)
+	song.Genre = genre.String
+	song.StoragePath = storagePath.String
+	return song, nil
+}
+
+// GetNowPlaying builds now-playing metadata for a song, including the album/EP it is from
+func GetNowPlaying(songID int) (*models.NowPlaying, error) {
+	song, err := GetSong(songID)
+	if err != nil {
+		return nil, err
+	}
+
+	nowPlaying := &models.NowPlaying{Song: &song, StartedAt: time.Now()}
+	if song.ReleaseID != nil {
+		release := &models.ReleaseSummary{ID: *song.ReleaseID, TrackNumber: song.TrackNumber}
+		err := DB.QueryRow("SELECT title, release_type FROM releases WHERE id = $1", release.ID).
+			Scan(&release.Title, &release.Type)
+		if err == nil {
+			nowPlaying.Release = release
+		}
+	}
+	return nowPlaying, nil
+}
+
+// NullIntPtr converts a nullable integer column into an optional JSON field
+func NullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	id := int(v.Int64)
+	return &id
+}
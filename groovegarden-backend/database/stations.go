@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"groovegarden/models"
+)
+
+// DefaultStationSlug is the station behind the legacy /stream/start and /stream/stop routes
+const DefaultStationSlug = "main"
+
+// StationPoolFilter restricts songs (aliased "s") to the pool of a station (aliased "st")
+const StationPoolFilter = `
+	s.storage_path IS NOT NULL
+	AND (cardinality(st.pool_tags) = 0 OR EXISTS (
+		SELECT 1 FROM song_tags x JOIN tags t ON t.id = x.tag_id
+		WHERE x.song_id = s.id AND t.name = ANY(st.pool_tags)))
+	AND (st.pool_max_age_days IS NULL
+		OR s.upload_date >= NOW() - make_interval(days => st.pool_max_age_days))`
+
+// stationColumns lists the columns scanned by ScanStation
+const stationColumns = `st.id, st.name, st.slug, st.mount, st.status, st.pool_tags, st.pool_max_age_days,
+	st.vote_round, st.timezone, st.repeat_window_minutes, st.skip_ratio, st.skip_min_votes,
+	st.auto_approve_requests, st.created_at`
+
+// ensureStationTables creates stations, their queues and the vote log
+func ensureStationTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS stations (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			slug TEXT UNIQUE NOT NULL,
+			mount TEXT UNIQUE NOT NULL,
+			status TEXT NOT NULL DEFAULT 'paused' CHECK (status IN ('active', 'paused')),
+			pool_tags TEXT[] NOT NULL DEFAULT '{}',
+			pool_max_age_days INTEGER,
+			vote_round INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating stations table: %w", err)
+	}
+
+	// Deleting a song or station also removes it from every queue
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS station_queue (
+			id SERIAL PRIMARY KEY,
+			station_id INTEGER NOT NULL REFERENCES stations(id) ON DELETE CASCADE,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			source TEXT NOT NULL DEFAULT 'admin',
+			added_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			added_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS station_queue_station_idx ON station_queue (station_id, added_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating station_queue table: %w", err)
+	}
+
+	// Every vote is recorded; station votes count once per user, song and round
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS votes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			station_id INTEGER REFERENCES stations(id) ON DELETE CASCADE,
+			round INTEGER NOT NULL DEFAULT 1,
+			weight INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS votes_one_per_round_idx
+			ON votes (station_id, round, song_id, user_id) WHERE station_id IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS votes_song_idx ON votes (song_id, created_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating votes table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		INSERT INTO stations (name, slug, mount, status)
+		VALUES ('GrooveGarden', $1, '/stream', 'paused')
+		ON CONFLICT (slug) DO NOTHING
+	`, DefaultStationSlug)
+	if err != nil {
+		return fmt.Errorf("error creating default station: %w", err)
+	}
+
+	return nil
+}
+
+// GetStation loads a station by ID
+func GetStation(stationID int) (models.Station, error) {
+	return ScanStation(DB.QueryRow(`SELECT `+stationColumns+` FROM stations st WHERE st.id = $1`, stationID))
+}
+
+// GetStationBySlug loads a station by its slug
+func GetStationBySlug(slug string) (models.Station, error) {
+	return ScanStation(DB.QueryRow(`SELECT `+stationColumns+` FROM stations st WHERE st.slug = $1`, slug))
+}
+
+// ListStations returns all stations, optionally only those with the given status
+func ListStations(status string) ([]models.Station, error) {
+	rows, err := DB.Query(`
+		SELECT `+stationColumns+` FROM stations st
+		WHERE $1 = '' OR st.status = $1
+		ORDER BY st.id
+	`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stations := []models.Station{}
+	for rows.Next() {
+		station, err := ScanStation(rows)
+		if err != nil {
+			return nil, err
+		}
+		stations = append(stations, station)
+	}
+	return stations, rows.Err()
+}
+
+// ScanStation reads a row selected with stationColumns
+func ScanStation(row interface{ Scan(...interface{}) error }) (models.Station, error) {
+	station := models.Station{PoolTags: []string{}}
+	var maxAge sql.NullInt64
+	err := row.Scan(&station.ID, &station.Name, &station.Slug, &station.Mount, &station.Status,
+		pq.Array(&station.PoolTags), &maxAge, &station.VoteRound, &station.Timezone,
+		&station.RepeatWindowMinutes, &station.SkipRatio, &station.SkipMinVotes,
+		&station.AutoApproveRequests, &station.CreatedAt)
+	if err != nil {
+		return station, err
+	}
+	station.PoolMaxAgeDays = NullIntPtr(maxAge)
+	return station, nil
+}
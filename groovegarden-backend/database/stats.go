@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+)
+
+// ensureStatsTables creates the per-artist rollups built from plays and votes.
+// Rows are per calendar day so any date range can be summed cheaply.
+func ensureStatsTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS artist_daily_stats (
+			artist_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			plays INTEGER NOT NULL DEFAULT 0,
+			full_plays INTEGER NOT NULL DEFAULT 0,
+			skips INTEGER NOT NULL DEFAULT 0,
+			listen_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+			track_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+			audience INTEGER NOT NULL DEFAULT 0,
+			votes INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (artist_id, day)
+		);
+		CREATE TABLE IF NOT EXISTS artist_daily_listeners (
+			artist_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			listener_key TEXT NOT NULL,
+			PRIMARY KEY (artist_id, day, listener_key)
+		);
+		CREATE TABLE IF NOT EXISTS artist_hourly_stats (
+			artist_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			hour SMALLINT NOT NULL,
+			plays INTEGER NOT NULL DEFAULT 0,
+			audience INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (artist_id, day, hour)
+		);
+		CREATE TABLE IF NOT EXISTS artist_country_stats (
+			artist_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			country TEXT NOT NULL,
+			listeners INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (artist_id, day, country)
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating artist stats tables: %w", err)
+	}
+
+	// Remembers up to which day each rollup is complete
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS stats_rollups (
+			name TEXT PRIMARY KEY,
+			rolled_from DATE NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating stats_rollups table: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import "fmt"
+
+// Tag kinds: genres and moods are curated, free tags are created by artists.
+// A name is unique within its kind, so a free tag may share a genre's name.
+const (
+	TagKindGenre = "genre"
+	TagKindMood  = "mood"
+	TagKindTag   = "tag"
+)
+
+// SongTaxonomyColumns selects a song's genre, moods and free tags for a row aliased as "s"
+const SongTaxonomyColumns = `
+	(SELECT t.name FROM song_tags st JOIN tags t ON t.id = st.tag_id
+	 WHERE st.song_id = s.id AND t.kind = 'genre' ORDER BY t.name LIMIT 1),
+	ARRAY(SELECT t.name FROM song_tags st JOIN tags t ON t.id = st.tag_id
+	      WHERE st.song_id = s.id AND t.kind = 'mood' ORDER BY t.name),
+	ARRAY(SELECT t.name FROM song_tags st JOIN tags t ON t.id = st.tag_id
+	      WHERE st.song_id = s.id AND t.kind = 'tag' ORDER BY t.name)`
+
+// curatedGenres and curatedMoods seed the controlled vocabulary
+var curatedGenres = []string{
+	"ambient", "blues", "classical", "country", "electronic", "folk", "funk", "hip-hop",
+	"house", "jazz", "latin", "lo-fi", "metal", "pop", "punk", "r&b", "reggae", "rock",
+	"soul", "techno", "world",
+}
+
+var curatedMoods = []string{
+	"calm", "chill", "dark", "energetic", "happy", "melancholic", "romantic", "uplifting",
+}
+
+// ensureTaxonomyTables creates the tag vocabulary and song links and seeds
+// the curated entries
+func ensureTaxonomyTables() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS tags (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			kind TEXT NOT NULL DEFAULT 'tag' CHECK (kind IN ('genre', 'mood', 'tag')),
+			curated BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE (name, kind)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating tags table: %w", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS song_tags (
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (song_id, tag_id)
+		);
+		CREATE INDEX IF NOT EXISTS song_tags_tag_id_idx ON song_tags (tag_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating song_tags table: %w", err)
+	}
+
+	seed := map[string][]string{TagKindGenre: curatedGenres, TagKindMood: curatedMoods}
+	for kind, names := range seed {
+		for _, name := range names {
+			_, err = DB.Exec(`
+				INSERT INTO tags (name, kind, curated) VALUES ($1, $2, TRUE)
+				ON CONFLICT (name, kind) DO UPDATE SET curated = TRUE
+			`, name, kind)
+			if err != nil {
+				return fmt.Errorf("error seeding %s %q: %w", kind, name, err)
+			}
+		}
+	}
+
+	return nil
+}
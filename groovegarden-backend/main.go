@@ -9,10 +9,15 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
 
+	"groovegarden/cluster"
 	"groovegarden/controllers"
 	"groovegarden/database"
+	"groovegarden/listeners"
 	"groovegarden/oauth"
+	"groovegarden/playout"
+	"groovegarden/reactions"
 	"groovegarden/routes"
+	"groovegarden/stats"
 	"groovegarden/websocket"
 )
 
@@ -43,10 +48,36 @@ func main() {
 	}
 	fmt.Println("Database initialized successfully")
 
+	// With WS_BUS=postgres, websocket events reach the clients of every
+	// backend instance through LISTEN/NOTIFY
+	if os.Getenv("WS_BUS") == "postgres" {
+		bus, err := websocket.NewPostgresBus(database.DB, database.ConnInfo, database.EventChannel)
+		if err != nil {
+			log.Fatalf("Failed to start websocket bus: %v", err)
+		}
+		websocket.UseBus(bus)
+	}
+
 	// Ensure uploads directory exists and fix song paths
 	controllers.EnsureUploadsDirectory()
 	controllers.FixSongPaths()
 
+	// One instance at a time leads and runs playout for the stations that
+	// are on air; the others forward skips, reactions and station changes
+	playout.HandleInstanceCommands()
+	reactions.HandleInstanceCommands()
+	cluster.OnLeadership(playout.Lead)
+	cluster.Start()
+
+	// Count listeners per station in the background
+	go listeners.Run()
+
+	// Keep artist analytics rollups up to date
+	go stats.Run()
+
+	// Batch listeners' reactions to the songs on air
+	go reactions.Run()
+
 	// Set up the router
 	router := chi.NewRouter()
 	router.Use(corsMiddleware)
@@ -59,12 +90,11 @@ func main() {
 	routes.RegisterRoutes(router)
 
 	// WebSocket routes
+	controllers.RegisterWebSocketCommands()
 	go websocket.HandleMessages()
+	go controllers.RunPresence() // Who is tuned in to which station
 	router.HandleFunc("/ws", websocket.HandleConnections)
-
-	// Streaming routes
-	router.Get("/stream/start", controllers.StartStream)
-	router.Get("/stream/stop", controllers.StopStream)
+	router.Get("/events", websocket.HandleEvents) // Same events as Server-Sent Events
 
 	// Debug routes
 	router.Get("/debug/file/{id}", controllers.DebugFileAccess)
@@ -103,7 +133,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 		}
 
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
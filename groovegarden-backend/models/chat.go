@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// ChatMessage is a message posted to a station's chat
+type ChatMessage struct {
+	ID        int64     `json:"id"`
+	StationID int       `json:"station_id"`
+	UserID    int       `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Text      string    `json:"text"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// ChatRestriction keeps a user from chatting on a station, until it expires or is lifted
+type ChatRestriction struct {
+	StationID int        `json:"station_id"`
+	UserID    int        `json:"user_id"`
+	UserName  string     `json:"user_name"`
+	Kind      string     `json:"kind"` // 'mute', or 'ban' which also removes their messages
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Unset for indefinite restrictions
+	CreatedBy *int       `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
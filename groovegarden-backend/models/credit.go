@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// CreditTransaction is one entry in a user's credit ledger; spends have a negative amount
+type CreditTransaction struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"user_id"`
+	Amount    int       `json:"amount"`
+	Kind      string    `json:"kind"`
+	StationID *int      `json:"station_id,omitempty"`
+	SongID    *int      `json:"song_id,omitempty"`
+	RefID     *int64    `json:"ref_id,omitempty"` // The transaction a refund reverses
+	Note      string    `json:"note,omitempty"`
+	CreatedBy *int      `json:"created_by,omitempty"` // Admin behind a grant or refund
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreditAccount is a user's balance with their latest transactions
+type CreditAccount struct {
+	UserID       int                 `json:"user_id"`
+	Balance      int                 `json:"balance"`
+	Transactions []CreditTransaction `json:"transactions"`
+}
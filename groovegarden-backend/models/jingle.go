@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Jingle is a non-music asset (station ID, sponsor spot, promo) inserted between songs
+type Jingle struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Kind      string    `json:"kind"` // 'station_id', 'sponsor' or 'promo'
+	Duration  int       `json:"duration"`
+	StationID *int      `json:"station_id,omitempty"` // Nil plays on every station
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertionRule tells a station's playout when to insert a jingle of a kind.
+// Exactly one of EveryTracks and AtMinutes is set.
+type InsertionRule struct {
+	ID          int    `json:"id"`
+	StationID   int    `json:"station_id"`
+	Kind        string `json:"kind"`
+	EveryTracks *int   `json:"every_tracks,omitempty"` // After every N music tracks
+	AtMinutes   []int  `json:"at_minutes,omitempty"`   // At these minutes past each hour, e.g. [0, 30]
+}
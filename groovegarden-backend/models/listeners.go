@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// ListenerCount is how many people are tuned in to a station. App users
+// usually hold a websocket session and a stream connection at the same time,
+// so Listeners counts distinct listeners across both rather than their sum.
+type ListenerCount struct {
+	StationID int       `json:"station_id"`
+	Listeners int       `json:"listeners"`
+	WebSocket int       `json:"websocket"`        // Connected app sessions
+	Stream    *int      `json:"stream,omitempty"` // Icecast connections, nil when the stats are unavailable
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// ListenerHour is a station's audience over one hour
+type ListenerHour struct {
+	Hour    time.Time `json:"hour"`
+	Peak    int       `json:"peak"`
+	Average float64   `json:"average"`
+}
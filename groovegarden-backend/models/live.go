@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// LiveSession is an artist broadcasting live on a station, replacing the automated rotation
+type LiveSession struct {
+	ArtistID   int       `json:"artist_id"`
+	ArtistName string    `json:"artist_name"`
+	Title      string    `json:"title,omitempty"` // Show name sent by the source client, or the schedule slot's name
+	Via        string    `json:"via"`             // 'source' (Icecast-style SOURCE/PUT) or 'websocket'
+	StartedAt  time.Time `json:"started_at"`
+}
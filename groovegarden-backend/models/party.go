@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// ListeningParty is a private room whose members play songs in sync, under a host's control
+type ListeningParty struct {
+	ID        int           `json:"id"`
+	Code      string        `json:"code"` // Invite code members join with
+	Name      string        `json:"name"`
+	HostID    int           `json:"host_id"`
+	HostName  string        `json:"host_name"`
+	State     PartyState    `json:"state"`
+	Members   []PartyMember `json:"members"`
+	CreatedAt time.Time     `json:"created_at"`
+	EndedAt   *time.Time    `json:"ended_at,omitempty"`
+}
+
+// PartyState is the authoritative playback of a party: the song was at
+// PositionMS at ServerTime, and has moved on since if Playing
+type PartyState struct {
+	PartyID    int    `json:"party_id"`
+	SongID     *int   `json:"song_id"`
+	StreamURL  string `json:"stream_url,omitempty"` // Where members fetch the song
+	DurationMS int64  `json:"duration_ms"`
+	Playing    bool   `json:"playing"`
+	PositionMS int64  `json:"position_ms"`
+	ServerTime int64  `json:"server_time"` // Unix milliseconds
+}
+
+// PartyMember is a user in a listening party
+type PartyMember struct {
+	PartyID  int       `json:"party_id"`
+	UserID   int       `json:"user_id"`
+	UserName string    `json:"user_name"`
+	JoinedAt time.Time `json:"joined_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Play is one airing of a song on a station, with the song as it was then
+type Play struct {
+	ID            int        `json:"id"`
+	SongID        *int       `json:"song_id"`    // Nil once the song is deleted
+	StationID     *int       `json:"station_id"` // Nil once the station is deleted
+	Title         string     `json:"title"`
+	Artist        string     `json:"artist"`
+	Source        string     `json:"source"` // How it was picked: 'vote', 'schedule', or the queue entry's source
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"` // Nil while on air
+	ListenerCount int        `json:"listener_count"`     // Listeners when it started
+	Skipped       bool       `json:"skipped"`            // Cut short instead of played to the end
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// PresentListener is a signed-in user tuned in to a station
+type PresentListener struct {
+	UserID   int       `json:"user_id"`
+	UserName string    `json:"user_name"`
+	Since    time.Time `json:"since"`
+}
+
+// StationPresence is who is tuned in to a station. Users who hide their
+// presence are only counted in Hidden.
+type StationPresence struct {
+	StationID int               `json:"station_id"`
+	Listeners []PresentListener `json:"listeners"`
+	Hidden    int               `json:"hidden"`
+}
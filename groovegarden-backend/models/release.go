@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// Release types an artist can publish
+const (
+	ReleaseTypeSingle = "single"
+	ReleaseTypeEP     = "ep"
+	ReleaseTypeAlbum  = "album"
+)
+
+// Release groups an artist's songs into a single, EP or album
+type Release struct {
+	ID          int        `json:"id"`
+	ArtistID    *int       `json:"artist_id,omitempty"`
+	Artist      string     `json:"artist,omitempty"`
+	Title       string     `json:"title"`
+	Type        string     `json:"type"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
+	CoverPath   string     `json:"cover_path,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	TrackCount  int        `json:"track_count"`
+	Tracks      []Song     `json:"tracks,omitempty"`
+}
+
+// ReleaseSummary is the release information attached to a playing song
+type ReleaseSummary struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+	TrackNumber *int   `json:"track_number,omitempty"`
+}
+
+// NowPlaying describes what is currently going out on the stream
+type NowPlaying struct {
+	StationID int             `json:"station_id,omitempty"`
+	Song      *Song           `json:"song,omitempty"` // Nil while a live session is on air
+	Release   *ReleaseSummary `json:"release,omitempty"`
+	Live      *LiveSession    `json:"live,omitempty"`
+	StartedAt time.Time       `json:"started_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// SongRequest is a listener asking a station to play a song, optionally with a dedication
+type SongRequest struct {
+	ID         int        `json:"id"`
+	StationID  int        `json:"station_id"`
+	SongID     int        `json:"song_id"`
+	Title      string     `json:"title"`
+	Artist     string     `json:"artist"`
+	UserID     int        `json:"user_id"`
+	UserName   string     `json:"user_name"`
+	Dedication string     `json:"dedication,omitempty"`
+	Status     string     `json:"status"` // 'pending', 'approved', 'rejected' or 'played'
+	CreatedAt  time.Time  `json:"created_at"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	PlayedAt   *time.Time `json:"played_at,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// ScheduleSlot is a recurring block in a station's weekly programming grid
+type ScheduleSlot struct {
+	ID              int    `json:"id"`
+	StationID       int    `json:"station_id"`
+	Name            string `json:"name"`
+	DaysOfWeek      []int  `json:"days_of_week"` // 0 = Sunday ... 6 = Saturday
+	StartTime       string `json:"start_time"`   // HH:MM in the station's timezone
+	DurationMinutes int    `json:"duration_minutes"`
+	Rule            string `json:"rule"` // 'votes', 'playlist', 'genre' or 'live'
+	PlaylistID      *int   `json:"playlist_id,omitempty"`
+	Tag             string `json:"tag,omitempty"`
+	ArtistID        *int   `json:"artist_id,omitempty"`
+}
+
+// ScheduleOccurrence is one concrete airing of a slot
+type ScheduleOccurrence struct {
+	ScheduleSlot
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// Playlist is an ordered list of songs a schedule slot can play
+type Playlist struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy *int      `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Tracks    []Song    `json:"tracks"`
+}
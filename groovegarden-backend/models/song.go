@@ -10,10 +10,26 @@ type Song struct {
     Title       string    `json:"title"`
     Duration    int       `json:"duration"`
     UploadDate  time.Time `json:"upload_date"`
-    Votes       int       `json:"votes"`
+    Votes       int       `json:"votes"` // Lifetime votes; boosts only weigh in a station's round
+    Skips       int       `json:"skips"` // Times listeners voted it off the air
     StoragePath string    `json:"storage_path"` 
     ArtistID    *int      `json:"artist_id,omitempty"`
+    Genre       string    `json:"genre,omitempty"`
+    Moods       []string  `json:"moods"`
+    Tags        []string  `json:"tags"`
+    Explicit    bool      `json:"explicit"`
+    ReleaseID   *int      `json:"release_id,omitempty"`
+    TrackNumber *int      `json:"track_number,omitempty"`
     // This field isn't stored in the database table directly
     // It's populated from the JOIN with users table
     Artist      string    `json:"artist,omitempty"` 
 }
+
+// Tag is an entry in the genre/mood/tag vocabulary
+type Tag struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // 'genre', 'mood' or 'tag'
+	Curated   bool   `json:"curated"`
+	SongCount int    `json:"song_count"`
+}
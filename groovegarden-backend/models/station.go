@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// Station statuses
+const (
+	StationActive = "active"
+	StationPaused = "paused"
+)
+
+// Station is a channel with its own song pool, queue, vote rounds and output mount
+type Station struct {
+	ID                  int       `json:"id"`
+	Name                string    `json:"name"`
+	Slug                string    `json:"slug"`
+	Mount               string    `json:"mount"`                       // Icecast mount point, e.g. /lofi
+	Status              string    `json:"status"`                      // 'active' or 'paused'
+	PoolTags            []string  `json:"pool_tags"`                   // Songs must carry one of these genres/moods/tags (empty = any)
+	PoolMaxAgeDays      *int      `json:"pool_max_age_days,omitempty"` // Only songs uploaded in the last N days
+	VoteRound           int       `json:"vote_round"`
+	Timezone            string    `json:"timezone"`              // IANA name the schedule is defined in
+	RepeatWindowMinutes int       `json:"repeat_window_minutes"` // Minutes a played song stays out of rotation (0 = off)
+	SkipRatio           float64   `json:"skip_ratio"`            // Share of current listeners whose skip votes cut a track
+	SkipMinVotes        int       `json:"skip_min_votes"`        // Skip votes always needed, however few are listening
+	AutoApproveRequests bool      `json:"auto_approve_requests"` // Queue song requests without a dedication unmoderated
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// QueueEntry is a song waiting in a station's queue ahead of the vote winner
+type QueueEntry struct {
+	ID        int       `json:"id"`
+	StationID int       `json:"station_id"`
+	Song      Song      `json:"song"`
+	Source    string    `json:"source"` // who put it there, e.g. 'admin'
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// VoteStanding is a song's vote tally in a station's current round
+type VoteStanding struct {
+	SongID int    `json:"song_id"`
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Votes  int    `json:"votes"`
+}
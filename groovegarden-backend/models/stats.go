@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// ArtistStats is an artist's dashboard over a date range, built from the daily rollups
+type ArtistStats struct {
+	ArtistID     int              `json:"artist_id"`
+	From         time.Time        `json:"from"`
+	To           time.Time        `json:"to"`
+	Totals       ArtistTotals     `json:"totals"`
+	Daily        []ArtistDay      `json:"daily"`
+	TopHours     []ArtistHour     `json:"top_hours"`
+	TopLocations []ArtistLocation `json:"top_locations"`
+	UpdatedAt    *time.Time       `json:"updated_at,omitempty"` // When the rollups last ran
+}
+
+// ArtistTotals sums an artist's range
+type ArtistTotals struct {
+	Plays             int            `json:"plays"`
+	FullPlays         int            `json:"full_plays"`
+	Skips             int            `json:"skips"`
+	Votes             int            `json:"votes"`
+	Reactions         int            `json:"reactions"`
+	ReactionCounts    map[string]int `json:"reaction_counts"` // By reaction, e.g. "fire"
+	UniqueListeners   int            `json:"unique_listeners"`
+	Conversion        float64        `json:"conversion"`          // Votes per play
+	ListenThroughRate float64        `json:"listen_through_rate"` // Share of each track heard on average, 0-1
+}
+
+// ArtistDay is one day of an artist's plays, votes and reactions
+type ArtistDay struct {
+	Day       string `json:"day"` // YYYY-MM-DD
+	Plays     int    `json:"plays"`
+	Skips     int    `json:"skips"`
+	Votes     int    `json:"votes"`
+	Reactions int    `json:"reactions"`
+	Listeners int    `json:"listeners"` // Unique listeners that day
+}
+
+// ArtistHour is how an artist's plays do at one hour of the day
+type ArtistHour struct {
+	Hour     int `json:"hour"` // 0-23, server time
+	Plays    int `json:"plays"`
+	Audience int `json:"audience"` // Listeners summed over those plays
+}
+
+// ArtistLocation is how many unique listeners an artist reached in a country
+type ArtistLocation struct {
+	Country   string `json:"country"`
+	Listeners int    `json:"listeners"`
+}
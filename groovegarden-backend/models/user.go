@@ -24,3 +24,11 @@ type User struct {
 func (u *User) IsArtist() bool {
 	return u.AccountType == "artist"
 }
+
+// MusicPreferences is the validated shape of users.music_preferences; every
+// entry comes from the same vocabulary used to tag songs
+type MusicPreferences struct {
+	Genres []string `json:"genres"`
+	Moods  []string `json:"moods"`
+	Tags   []string `json:"tags"`
+}
@@ -0,0 +1,57 @@
+package playout
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func pcmOf(samples ...int16) []byte {
+	pcm := make([]byte, len(samples)*bytesPerSample)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(pcm[i*bytesPerSample:], uint16(sample))
+	}
+	return pcm
+}
+
+func samplesOf(pcm []byte) []int16 {
+	samples := make([]int16, len(pcm)/bytesPerSample)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*bytesPerSample:]))
+	}
+	return samples
+}
+
+func TestFadeOut(t *testing.T) {
+	tests := []struct {
+		name      string
+		samples   []int16
+		remaining int
+		total     int
+		want      []int16
+	}{
+		{"start of the fade", []int16{1000, -1000, 1000, -1000}, 8, 8, []int16{1000, -750, 500, -250}},
+		{"middle of the fade", []int16{1000, -1000, 1000, -1000}, 4, 8, []int16{500, -250, 0, 0}},
+		{"fade already over", []int16{1000, -1000}, 0, 8, []int16{0, 0}},
+		{"fade longer than the chunk", []int16{1000, 1000}, 400, 400, []int16{1000, 995}},
+		{"full scale samples", []int16{32767, -32768}, 4, 4, []int16{32767, -16384}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm := pcmOf(tt.samples...)
+			fadeOut(pcm, tt.remaining, tt.total)
+			if got := samplesOf(pcm); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("trailing odd byte left alone", func(t *testing.T) {
+		pcm := append(pcmOf(1000), 0x7f)
+		fadeOut(pcm, 0, 8)
+		if pcm[2] != 0x7f || samplesOf(pcm[:2])[0] != 0 {
+			t.Errorf("got %v", pcm)
+		}
+	})
+}
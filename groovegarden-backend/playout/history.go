@@ -0,0 +1,60 @@
+package playout
+
+import (
+	"log"
+
+	"github.com/lib/pq"
+
+	"groovegarden/database"
+	"groovegarden/listeners"
+)
+
+// logPlayStart records a song going on air, with what it was and who is
+// listening, and returns its plays row, or 0 if it couldn't be logged
+func logPlayStart(stationID int, t *track) int {
+	var playID int
+	err := database.DB.QueryRow(`
+		INSERT INTO plays (song_id, station_id, source, listener_count, title, artist, artist_id, duration)
+		SELECT s.id, $2, $3, $4, s.title, COALESCE(s.artist, u.name, 'Unknown'), s.artist_id, COALESCE(s.duration, 0)
+		FROM songs s
+		LEFT JOIN users u ON u.id = s.artist_id
+		WHERE s.id = $1
+		RETURNING id
+	`, t.songID, stationID, t.source, listeners.Current(stationID).Listeners).Scan(&playID)
+	if err != nil {
+		log.Printf("Station %d: could not log play of %s: %v", stationID, t, err)
+		return 0
+	}
+
+	audience := listeners.Audience(stationID)
+	if len(audience) == 0 {
+		return playID
+	}
+	keys := make([]string, len(audience))
+	countries := make([]string, len(audience))
+	for i, listener := range audience {
+		keys[i] = listener.Key
+		countries[i] = listener.Country
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO play_listeners (play_id, listener_key, country)
+		SELECT $1, key, country FROM unnest($2::text[], $3::text[]) AS a(key, country)
+		ON CONFLICT DO NOTHING
+	`, playID, pq.Array(keys), pq.Array(countries))
+	if err != nil {
+		log.Printf("Station %d: could not log audience of play %d: %v", stationID, playID, err)
+	}
+	return playID
+}
+
+// logPlayEnd closes a plays row once the song stops, noting whether it was
+// cut short (a skip marks the row as soon as the vote passes)
+func logPlayEnd(playID int, skipped bool) {
+	if playID == 0 {
+		return
+	}
+	_, err := database.DB.Exec("UPDATE plays SET ended_at = NOW(), skipped = skipped OR $1 WHERE id = $2", skipped, playID)
+	if err != nil {
+		log.Printf("Could not close play %d: %v", playID, err)
+	}
+}
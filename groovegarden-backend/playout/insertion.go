@@ -0,0 +1,151 @@
+package playout
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+// insertions tracks when each of a station's insertion rules last fired
+type insertions struct {
+	since     time.Time         // when the worker started evaluating rules
+	tracks    map[int]int       // music tracks aired since each every-N rule fired
+	lastFired map[int]time.Time // when each clock rule last fired
+}
+
+func newInsertions() *insertions {
+	return &insertions{
+		since:     time.Now(),
+		tracks:    make(map[int]int),
+		lastFired: make(map[int]time.Time),
+	}
+}
+
+// trackPlayed counts a music track toward every rule
+func (ins *insertions) trackPlayed(rules []models.InsertionRule) {
+	for _, rule := range rules {
+		ins.tracks[rule.ID]++
+	}
+}
+
+// due returns the rules that fire at this track boundary: every-N rules that
+// have seen N tracks, and clock rules whose mark passed since they last fired
+func (ins *insertions) due(rules []models.InsertionRule, loc *time.Location, now time.Time) []models.InsertionRule {
+	var due []models.InsertionRule
+	for _, rule := range rules {
+		switch {
+		case rule.EveryTracks != nil:
+			if ins.tracks[rule.ID] >= *rule.EveryTracks {
+				ins.tracks[rule.ID] = 0
+				due = append(due, rule)
+			}
+		case len(rule.AtMinutes) > 0:
+			last, ok := ins.lastFired[rule.ID]
+			if !ok {
+				last = ins.since
+			}
+			if latestMark(rule.AtMinutes, loc, now).After(last) {
+				ins.lastFired[rule.ID] = now
+				due = append(due, rule)
+			}
+		}
+	}
+	return due
+}
+
+// latestMark returns the most recent time at one of the given minutes past the hour
+func latestMark(minutes []int, loc *time.Location, now time.Time) time.Time {
+	local := now.In(loc)
+	hour := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+
+	var latest time.Time
+	for _, minute := range minutes {
+		mark := hour.Add(time.Duration(minute) * time.Minute)
+		if mark.After(now) {
+			mark = mark.Add(-time.Hour)
+		}
+		if mark.After(latest) {
+			latest = mark
+		}
+	}
+	return latest
+}
+
+// insertJingles plays a jingle for each rule due at this track boundary
+func (w *worker) insertJingles(ctx context.Context, out *encoder, ins *insertions) error {
+	rules, err := database.ListInsertionRules(w.station.ID)
+	if err != nil {
+		log.Printf("Station %d: could not load insertion rules: %v", w.station.ID, err)
+		return nil
+	}
+	ins.trackPlayed(rules)
+
+	for _, rule := range ins.due(rules, StationLocation(w.station), time.Now()) {
+		if w.livePending() {
+			return nil
+		}
+
+		t, jingle, err := pickJingle(w.station.ID, rule.Kind)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			log.Printf("Station %d: %v", w.station.ID, err)
+			continue
+		}
+
+		var playID int
+		err = database.DB.QueryRow(
+			"INSERT INTO jingle_plays (jingle_id, station_id, rule_id) VALUES ($1, $2, $3) RETURNING id",
+			jingle.ID, w.station.ID, rule.ID,
+		).Scan(&playID)
+		if err != nil {
+			log.Printf("Station %d: could not log jingle %d: %v", w.station.ID, jingle.ID, err)
+		}
+
+		websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventJinglePlaying, websocket.JinglePlaying{
+			StationID: w.station.ID,
+			Jingle:    jingle,
+		})
+		if _, err := w.play(ctx, t, out); err != nil {
+			return err
+		}
+
+		if playID != 0 {
+			if _, err := database.DB.Exec("UPDATE jingle_plays SET ended_at = NOW() WHERE id = $1", playID); err != nil {
+				log.Printf("Station %d: could not log jingle %d: %v", w.station.ID, jingle.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pickJingle chooses the station's least recently aired jingle of a kind
+func pickJingle(stationID int, kind string) (*track, models.Jingle, error) {
+	t := &track{source: "jingle"}
+	var jingle models.Jingle
+	var jingleStation sql.NullInt64
+	err := database.DB.QueryRow(`
+		SELECT j.id, j.title, j.kind, j.duration, j.station_id, j.created_at, j.storage_path
+		FROM jingles j
+		WHERE j.kind = $2 AND (j.station_id IS NULL OR j.station_id = $1)
+		ORDER BY (
+			SELECT MAX(p.started_at) FROM jingle_plays p WHERE p.jingle_id = j.id AND p.station_id = $1
+		) NULLS FIRST, random()
+		LIMIT 1
+	`, stationID, kind).Scan(&jingle.ID, &jingle.Title, &jingle.Kind, &jingle.Duration, &jingleStation,
+		&jingle.CreatedAt, &t.path)
+	if err == sql.ErrNoRows {
+		return nil, jingle, err
+	} else if err != nil {
+		return nil, jingle, fmt.Errorf("failed to pick %s jingle for station %d: %w", kind, stationID, err)
+	}
+	jingle.StationID = database.NullIntPtr(jingleStation)
+	t.jingleID = jingle.ID
+	return t, jingle, nil
+}
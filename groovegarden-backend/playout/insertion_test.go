@@ -0,0 +1,127 @@
+package playout
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"groovegarden/models"
+)
+
+func TestLatestMark(t *testing.T) {
+	kolkata := mustLocation(t, "Asia/Kolkata") // UTC+05:30
+
+	tests := []struct {
+		name    string
+		minutes []int
+		loc     *time.Location
+		now     time.Time
+		want    time.Time
+	}{
+		{"last mark this hour", []int{0, 30}, time.UTC, time.Date(2024, 6, 8, 10, 45, 0, 0, time.UTC), time.Date(2024, 6, 8, 10, 30, 0, 0, time.UTC)},
+		{"earlier mark this hour", []int{0, 30}, time.UTC, time.Date(2024, 6, 8, 10, 15, 0, 0, time.UTC), time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC)},
+		{"exactly on a mark", []int{0, 30}, time.UTC, time.Date(2024, 6, 8, 10, 30, 0, 0, time.UTC), time.Date(2024, 6, 8, 10, 30, 0, 0, time.UTC)},
+		{"mark from the previous hour", []int{50}, time.UTC, time.Date(2024, 6, 8, 10, 10, 0, 0, time.UTC), time.Date(2024, 6, 8, 9, 50, 0, 0, time.UTC)},
+		{"unsorted minutes", []int{45, 15}, time.UTC, time.Date(2024, 6, 8, 10, 50, 0, 0, time.UTC), time.Date(2024, 6, 8, 10, 45, 0, 0, time.UTC)},
+		{"half-hour timezone offset", []int{0}, kolkata, time.Date(2024, 6, 8, 10, 40, 0, 0, time.UTC), time.Date(2024, 6, 8, 10, 30, 0, 0, time.UTC)},
+		{"no minutes", nil, time.UTC, time.Date(2024, 6, 8, 10, 40, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestMark(tt.minutes, tt.loc, tt.now); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertionsDue(t *testing.T) {
+	every := func(n int) *int { return &n }
+	at := func(hour, minute int) time.Time { return time.Date(2024, 6, 8, hour, minute, 0, 0, time.UTC) }
+
+	// step is one track boundary: the track that just ended is counted, then due is checked
+	type step struct {
+		now  time.Time
+		want []int // IDs of the rules due
+	}
+	tests := []struct {
+		name  string
+		rules []models.InsertionRule
+		since time.Time
+		steps []step
+	}{
+		{
+			name:  "every N tracks",
+			rules: []models.InsertionRule{{ID: 1, EveryTracks: every(3)}},
+			since: at(10, 0),
+			steps: []step{
+				{at(10, 3), nil},
+				{at(10, 6), nil},
+				{at(10, 9), []int{1}},
+				{at(10, 12), nil},
+				{at(10, 15), nil},
+				{at(10, 18), []int{1}},
+			},
+		},
+		{
+			name:  "clock rule fires once per mark",
+			rules: []models.InsertionRule{{ID: 1, AtMinutes: []int{0}}},
+			since: at(10, 5),
+			steps: []step{
+				{at(10, 30), nil},
+				{at(11, 2), []int{1}},
+				{at(11, 10), nil},
+				{at(11, 59), nil},
+				{at(12, 4), []int{1}},
+			},
+		},
+		{
+			name:  "clock rule ignores marks before the worker started",
+			rules: []models.InsertionRule{{ID: 1, AtMinutes: []int{0}}},
+			since: at(10, 0).Add(30 * time.Second),
+			steps: []step{
+				{at(10, 5), nil},
+			},
+		},
+		{
+			name:  "missed marks fire once",
+			rules: []models.InsertionRule{{ID: 1, AtMinutes: []int{0, 15, 30, 45}}},
+			since: at(10, 1),
+			steps: []step{
+				{at(10, 50), []int{1}},
+				{at(10, 55), nil},
+			},
+		},
+		{
+			name: "several rules due at once",
+			rules: []models.InsertionRule{
+				{ID: 1, EveryTracks: every(2)},
+				{ID: 2, AtMinutes: []int{30}},
+				{ID: 3},
+			},
+			since: at(10, 0),
+			steps: []step{
+				{at(10, 20), nil},
+				{at(10, 33), []int{1, 2}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins := newInsertions()
+			ins.since = tt.since
+			for i, s := range tt.steps {
+				ins.trackPlayed(tt.rules)
+				ids := []int{}
+				for _, rule := range ins.due(tt.rules, time.UTC, s.now) {
+					ids = append(ids, rule.ID)
+				}
+				if !slices.Equal(ids, s.want) {
+					t.Errorf("step %d at %s: got rules %v, want %v", i, s.now.Format("15:04"), ids, s.want)
+				}
+			}
+		})
+	}
+}
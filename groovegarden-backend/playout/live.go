@@ -0,0 +1,237 @@
+package playout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"groovegarden/cluster"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+// liveSourceTimeout is how long a live source may send nothing before it is
+// considered dropped and the station falls back to its queue
+const liveSourceTimeout = 5 * time.Second
+
+var (
+	// ErrOffAir means the station has no running playout to take over
+	ErrOffAir = errors.New("station is not on air")
+	// ErrAlreadyLive means another source is already live on the station
+	ErrAlreadyLive = errors.New("station already has a live source")
+	// ErrOtherInstance means the station's playout runs on another instance,
+	// where live sources have to connect
+	ErrOtherInstance = errors.New("station's playout runs on another instance")
+)
+
+// liveSession is a live source handed to a worker
+type liveSession struct {
+	info   models.LiveSession
+	src    io.Reader
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed by the worker when the session is over
+}
+
+// GoLive hands an encoded live stream to a station's playout, which fades out
+// the rotation and relays src to listeners. It blocks until the source ends,
+// drops, is kicked, or ctx is cancelled; the station then resumes its queue.
+func GoLive(ctx context.Context, stationID int, info models.LiveSession, src io.Reader) error {
+	w, ok := localWorker(stationID)
+	if !ok {
+		if IsRunning(stationID) {
+			return ErrOtherInstance
+		}
+		return ErrOffAir
+	}
+
+	info.StartedAt = time.Now()
+	s := &liveSession{info: info, src: src, done: make(chan struct{})}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	defer s.cancel()
+
+	w.mu.Lock()
+	if w.liveSession != nil {
+		w.mu.Unlock()
+		return ErrAlreadyLive
+	}
+	w.liveSession = s
+	w.mu.Unlock()
+
+	// The channel holds one session and liveSession guards it, so this never blocks
+	w.live <- s
+
+	select {
+	case <-s.done:
+	case <-w.done:
+	case <-s.ctx.Done():
+		// The source may have gone before the worker took the session; release
+		// the station so the next source isn't turned away. A session already
+		// on air ends on its own now that its context is done.
+		w.mu.Lock()
+		if w.liveSession == s {
+			w.liveSession = nil
+		}
+		select {
+		case <-w.live:
+		default:
+		}
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// EndLive disconnects a station's live source; it reports whether one was on air
+func EndLive(stationID int) bool {
+	if !cluster.IsLeader() {
+		if LiveSession(stationID) == nil {
+			return false
+		}
+		websocket.SendInstanceCommand(commandEndLive, stationCommand{StationID: stationID})
+		return true
+	}
+	return endLiveLocal(stationID)
+}
+
+func endLiveLocal(stationID int) bool {
+	w, ok := localWorker(stationID)
+	if !ok {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.liveSession == nil {
+		return false
+	}
+	w.liveSession.cancel()
+	return true
+}
+
+// LiveSession returns the live session on a station, or nil
+func LiveSession(stationID int) *models.LiveSession {
+	if !cluster.IsLeader() {
+		if state := remoteState(stationID); state != nil && state.NowPlaying != nil {
+			return state.NowPlaying.Live
+		}
+		return nil
+	}
+
+	w, ok := localWorker(stationID)
+	if !ok {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.liveSession == nil {
+		return nil
+	}
+	info := w.liveSession.info
+	return &info
+}
+
+// livePending reports whether a live source is waiting to take over
+func (w *worker) livePending() bool {
+	return len(w.live) > 0
+}
+
+// playLive relays a live session to the encoder until the source ends or
+// goes quiet. Only encoder errors and worker shutdown are returned.
+func (w *worker) playLive(ctx context.Context, s *liveSession, out *encoder) error {
+	reason := "source_ended"
+	defer func() { w.endLive(s, reason) }()
+
+	liveCtx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	if liveCtx.Err() != nil {
+		reason = "disconnected"
+		return ctx.Err()
+	}
+
+	dec, err := startStreamDecoder(liveCtx, s.src)
+	if err != nil {
+		log.Printf("Station %d: live source from artist %d failed: %v", w.station.ID, s.info.ArtistID, err)
+		reason = "decoder_failed"
+		return nil
+	}
+	defer dec.Close()
+
+	log.Printf("Station %d: artist %d (%s) is live", w.station.ID, s.info.ArtistID, s.info.ArtistName)
+	nowPlaying := &models.NowPlaying{StationID: w.station.ID, Live: &s.info, StartedAt: s.info.StartedAt}
+	w.setNowPlaying(nowPlaying)
+	websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventNowPlaying, nowPlaying)
+
+	// Read in the background so a source that goes quiet can be detected
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, chunkSize)
+			n, err := io.ReadFull(dec, buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-liveCtx.Done():
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	timeout := time.NewTimer(liveSourceTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return nil
+			}
+			if _, err := out.Write(chunk); err != nil {
+				reason = "encoder_failed"
+				return err
+			}
+			timeout.Reset(liveSourceTimeout)
+		case <-timeout.C:
+			reason = "source_timeout"
+			return nil
+		case <-liveCtx.Done():
+			if ctx.Err() != nil {
+				reason = "station_stopped"
+				return ctx.Err()
+			}
+			reason = "disconnected"
+			return nil
+		}
+	}
+}
+
+// endLive releases the station for the next live source and tells listeners
+// the rotation is back
+func (w *worker) endLive(s *liveSession, reason string) {
+	s.cancel()
+
+	w.mu.Lock()
+	if w.liveSession == s {
+		w.liveSession = nil
+	}
+	w.nowPlaying = nil
+	w.mu.Unlock()
+	w.publishState()
+	close(s.done)
+
+	log.Printf("Station %d: live session of artist %d ended (%s)", w.station.ID, s.info.ArtistID, reason)
+	websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventLiveEnded, websocket.LiveEnded{
+		StationID: w.station.ID,
+		ArtistID:  s.info.ArtistID,
+		Reason:    reason,
+	})
+}
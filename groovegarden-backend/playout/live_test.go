@@ -0,0 +1,151 @@
+package playout
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"groovegarden/models"
+)
+
+// idleWorker registers a worker for a station that never takes live sessions
+// off its channel, like one busy playing a track
+func idleWorker(t *testing.T, stationID int) *worker {
+	t.Helper()
+	w := &worker{
+		station: models.Station{ID: stationID},
+		done:    make(chan struct{}),
+		live:    make(chan *liveSession, 1),
+	}
+	workersMu.Lock()
+	workers[stationID] = w
+	workersMu.Unlock()
+	t.Cleanup(func() {
+		workersMu.Lock()
+		delete(workers, stationID)
+		workersMu.Unlock()
+	})
+	return w
+}
+
+// goLive runs GoLive in the background and returns its result channel
+func goLive(ctx context.Context, stationID int) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- GoLive(ctx, stationID, models.LiveSession{ArtistID: 7}, strings.NewReader(""))
+	}()
+	return result
+}
+
+func waitFor(t *testing.T, result chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("GoLive did not return")
+		return nil
+	}
+}
+
+// waitPending waits until a session is waiting for the worker
+func waitPending(t *testing.T, w *worker) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !w.livePending() {
+		if time.Now().After(deadline) {
+			t.Fatal("session was never handed to the worker")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// heldBy returns the artist of the session holding a worker's station, or 0
+func heldBy(w *worker) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.liveSession == nil {
+		return 0
+	}
+	return w.liveSession.info.ArtistID
+}
+
+func TestGoLive(t *testing.T) {
+	tests := []struct {
+		name string
+		// end finishes the pending session the way the test case describes
+		end func(w *worker, cancel context.CancelFunc)
+	}{
+		{
+			name: "source drops before the worker takes over",
+			end:  func(w *worker, cancel context.CancelFunc) { cancel() },
+		},
+		{
+			name: "worker stops",
+			end:  func(w *worker, cancel context.CancelFunc) { close(w.done) },
+		},
+		{
+			name: "worker ends the session",
+			end: func(w *worker, cancel context.CancelFunc) {
+				s := <-w.live
+				w.mu.Lock()
+				w.liveSession = nil
+				w.mu.Unlock()
+				close(s.done)
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stationID := 1000 + i
+			w := idleWorker(t, stationID)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			result := goLive(ctx, stationID)
+			waitPending(t, w)
+			if got := heldBy(w); got != 7 {
+				t.Fatalf("station held by artist %d, want the pending session's", got)
+			}
+			tt.end(w, cancel)
+			if err := waitFor(t, result); err != nil {
+				t.Fatalf("GoLive returned %v", err)
+			}
+		})
+	}
+}
+
+func TestGoLiveReleasesStationWhenSourceDrops(t *testing.T) {
+	w := idleWorker(t, 2000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := goLive(ctx, 2000)
+	waitPending(t, w)
+
+	// A second source is turned away while the first is pending
+	if err := GoLive(context.Background(), 2000, models.LiveSession{}, strings.NewReader("")); err != ErrAlreadyLive {
+		t.Fatalf("second source: got %v, want ErrAlreadyLive", err)
+	}
+
+	cancel()
+	if err := waitFor(t, first); err != nil {
+		t.Fatalf("GoLive returned %v", err)
+	}
+	if w.livePending() {
+		t.Error("dropped session is still waiting for the worker")
+	}
+	if heldBy(w) != 0 {
+		t.Error("dropped session still holds the station")
+	}
+
+	// The next source can take over
+	next, cancelNext := context.WithCancel(context.Background())
+	result := goLive(next, 2000)
+	waitPending(t, w)
+	cancelNext()
+	if err := waitFor(t, result); err != nil {
+		t.Fatalf("next source: GoLive returned %v", err)
+	}
+}
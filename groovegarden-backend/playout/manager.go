@@ -0,0 +1,273 @@
+// Package playout runs one playout worker per active station. Each worker
+// picks tracks from the station's queue and vote pool, decodes them to PCM
+// and feeds a long-running encoder connected to the station's Icecast mount.
+//
+// Only the leader instance (see package cluster) runs workers. It publishes
+// each station's state to the playout_state table, which the other
+// instances read, and they send start, stop, update, skip and end-live
+// commands to the leader through the websocket bus.
+package playout
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"groovegarden/cluster"
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+// Instance commands handled by the leader
+const (
+	commandStart   = "playout_start"
+	commandStop    = "playout_stop"
+	commandUpdate  = "playout_update"
+	commandSkip    = "playout_skip"
+	commandEndLive = "playout_end_live"
+)
+
+// stationCommand is the data of an instance command for the leader
+type stationCommand struct {
+	StationID int `json:"station_id"`
+	PlayID    int `json:"play_id,omitempty"`
+}
+
+var (
+	workers   = make(map[int]*worker)
+	workersMu sync.Mutex
+)
+
+// Lead starts the active stations when this instance becomes the leader and
+// stops them all when it no longer is
+func Lead(leading bool) {
+	if !leading {
+		workersMu.Lock()
+		defer workersMu.Unlock()
+		for stationID, w := range workers {
+			w.stop()
+			delete(workers, stationID)
+		}
+		return
+	}
+
+	if err := database.ClearPlayoutState(); err != nil {
+		log.Printf("Warning: could not clear playout state: %v", err)
+	}
+	if err := StartActiveStations(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// HandleInstanceCommands lets the leader act on commands from the other instances
+func HandleInstanceCommands() {
+	handle := func(command string, run func(stationCommand)) {
+		websocket.OnInstanceCommand(command, func(data json.RawMessage) {
+			if !cluster.IsLeader() {
+				return
+			}
+			var cmd stationCommand
+			if err := json.Unmarshal(data, &cmd); err != nil {
+				log.Printf("Invalid %s command: %v", command, err)
+				return
+			}
+			run(cmd)
+		})
+	}
+
+	handle(commandStart, func(cmd stationCommand) {
+		station, err := database.GetStation(cmd.StationID)
+		if err != nil {
+			log.Printf("Could not load station %d to start it: %v", cmd.StationID, err)
+			return
+		}
+		startLocal(station)
+	})
+	handle(commandStop, func(cmd stationCommand) { stopLocal(cmd.StationID) })
+	handle(commandUpdate, func(cmd stationCommand) {
+		station, err := database.GetStation(cmd.StationID)
+		if err != nil {
+			log.Printf("Could not load station %d to update it: %v", cmd.StationID, err)
+			return
+		}
+		updateLocal(station)
+	})
+	handle(commandSkip, func(cmd stationCommand) { skipLocal(cmd.StationID, cmd.PlayID) })
+	handle(commandEndLive, func(cmd stationCommand) { endLiveLocal(cmd.StationID) })
+}
+
+// StartActiveStations starts a worker for every station marked active
+func StartActiveStations() error {
+	stations, err := database.ListStations(models.StationActive)
+	if err != nil {
+		return fmt.Errorf("failed to load active stations: %w", err)
+	}
+	for _, station := range stations {
+		startLocal(station)
+	}
+	log.Printf("Started playout for %d active station(s)", len(stations))
+	return nil
+}
+
+// Start runs a station's playout, restarting it if it was already running
+// so changes to the station's mount, pool or timezone take effect
+func Start(station models.Station) {
+	if !cluster.IsLeader() {
+		websocket.SendInstanceCommand(commandStart, stationCommand{StationID: station.ID})
+		return
+	}
+	startLocal(station)
+}
+
+func startLocal(station models.Station) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+
+	if existing, ok := workers[station.ID]; ok {
+		existing.stop()
+	}
+	workers[station.ID] = newWorker(station)
+}
+
+// Update hands new settings to a running station's worker without
+// restarting it; a new mount, pool or timezone needs Start instead
+func Update(station models.Station) {
+	if !cluster.IsLeader() {
+		websocket.SendInstanceCommand(commandUpdate, stationCommand{StationID: station.ID})
+		return
+	}
+	updateLocal(station)
+}
+
+func updateLocal(station models.Station) {
+	if w, ok := localWorker(station.ID); ok {
+		w.update(station)
+	}
+}
+
+// Stop stops a station's playout; it is a no-op if the station isn't running
+func Stop(stationID int) {
+	if !cluster.IsLeader() {
+		websocket.SendInstanceCommand(commandStop, stationCommand{StationID: stationID})
+		return
+	}
+	stopLocal(stationID)
+}
+
+func stopLocal(stationID int) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+
+	if existing, ok := workers[stationID]; ok {
+		existing.stop()
+		delete(workers, stationID)
+	}
+}
+
+// localWorker returns the station's worker if it runs in this instance
+func localWorker(stationID int) (*worker, bool) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	w, ok := workers[stationID]
+	return w, ok
+}
+
+// RunsHere reports whether a station's playout runs in this instance, which
+// is where a live source has to connect
+func RunsHere(stationID int) bool {
+	_, ok := localWorker(stationID)
+	return ok
+}
+
+// remoteState reads a station's state as published by the leader, or nil
+// when it isn't running
+func remoteState(stationID int) *database.PlayoutState {
+	state, err := database.GetPlayoutState(stationID)
+	if err != nil {
+		log.Printf("Error loading playout state of station %d: %v", stationID, err)
+		return nil
+	}
+	return state
+}
+
+// IsRunning reports whether a station has a playout worker
+func IsRunning(stationID int) bool {
+	if cluster.IsLeader() {
+		return RunsHere(stationID)
+	}
+	return remoteState(stationID) != nil
+}
+
+// NowPlaying returns what a station is playing, or nil when it is off air or idle
+func NowPlaying(stationID int) *models.NowPlaying {
+	if !cluster.IsLeader() {
+		if state := remoteState(stationID); state != nil {
+			return state.NowPlaying
+		}
+		return nil
+	}
+
+	w, ok := localWorker(stationID)
+	if !ok {
+		return nil
+	}
+	return w.current()
+}
+
+// CurrentPlay returns the plays row of the song on air, or 0 when nothing
+// skippable is playing (off air, idle, jingles or a live session)
+func CurrentPlay(stationID int) int {
+	if !cluster.IsLeader() {
+		if state := remoteState(stationID); state != nil {
+			return state.PlayID
+		}
+		return 0
+	}
+
+	w, ok := localWorker(stationID)
+	if !ok {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.playID
+}
+
+// Skip fades out the song on air if it is still playID. It reports whether
+// this call started the skip; the plays row decides, so a skip is only acted
+// on once across all instances.
+func Skip(stationID, playID int) bool {
+	result, err := database.DB.Exec(
+		"UPDATE plays SET skipped = TRUE WHERE id = $1 AND station_id = $2 AND ended_at IS NULL AND NOT skipped",
+		playID, stationID,
+	)
+	if err != nil {
+		log.Printf("Error skipping play %d on station %d: %v", playID, stationID, err)
+		return false
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return false
+	}
+
+	if !cluster.IsLeader() {
+		websocket.SendInstanceCommand(commandSkip, stationCommand{StationID: stationID, PlayID: playID})
+		return true
+	}
+	skipLocal(stationID, playID)
+	return true
+}
+
+func skipLocal(stationID, playID int) {
+	w, ok := localWorker(stationID)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.playID == playID {
+		w.skipping = true
+	}
+}
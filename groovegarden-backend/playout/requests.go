@@ -0,0 +1,80 @@
+package playout
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+// requestCredits are earned by a listener when their request airs
+const requestCredits = 20
+
+// markRequestPlayed marks the request behind a queued track as played and
+// credits the listener who asked for it. It must run before startNextRound
+// removes the queue entry. It returns the request, or nil if the track
+// wasn't requested.
+func markRequestPlayed(stationID int, t *track) *websocket.Dedication {
+	if t.queueID == 0 || t.source != "request" {
+		return nil
+	}
+	d := &websocket.Dedication{StationID: stationID, SongID: t.songID}
+	err := database.DB.QueryRow(`
+		UPDATE song_requests r SET status = 'played', played_at = NOW()
+		FROM users u
+		WHERE r.queue_id = $1 AND r.status = 'approved' AND u.id = r.user_id
+		RETURNING r.id, r.user_id, COALESCE(u.name, ''), r.dedication
+	`, t.queueID).Scan(&d.RequestID, &d.UserID, &d.UserName, &d.Dedication)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		log.Printf("Station %d: could not mark request for %s played: %v", stationID, t, err)
+		return nil
+	}
+
+	_, err = database.AddCredits(database.DB, models.CreditTransaction{
+		UserID:    d.UserID,
+		Amount:    requestCredits,
+		Kind:      database.CreditRequest,
+		StationID: &stationID,
+		SongID:    &t.songID,
+	}, fmt.Sprintf("request:%d", d.RequestID))
+	if err != nil {
+		log.Printf("Station %d: could not award credits for request %d: %v", stationID, d.RequestID, err)
+	}
+	websocket.NotifyUser(d.UserID, websocket.EventYourRequestPlaying, d)
+	return d
+}
+
+// notifyRequestUpNext tells the listener whose request is the queue entry
+// nextTrack will pick that it plays next
+func notifyRequestUpNext(stationID int) {
+	var requestID, userID, songID int
+	err := database.DB.QueryRow(`
+		SELECT r.id, r.user_id, r.song_id
+		FROM (`+nextQueueEntry+`) next
+		JOIN song_requests r ON r.queue_id = next.id AND r.status = 'approved'
+	`, stationID).Scan(&requestID, &userID, &songID)
+	if err == sql.ErrNoRows {
+		return
+	} else if err != nil {
+		log.Printf("Station %d: could not check the next queue entry: %v", stationID, err)
+		return
+	}
+	websocket.NotifyUser(userID, websocket.EventYourRequestUpNext, websocket.RequestUpNext{
+		StationID: stationID,
+		RequestID: requestID,
+		SongID:    songID,
+	})
+}
+
+// dedicate tells listeners who requested the song on air and why
+func (w *worker) dedicate(d *websocket.Dedication) {
+	if d == nil || d.Dedication == "" {
+		return
+	}
+	websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventDedication, d)
+}
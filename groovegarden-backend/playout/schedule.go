@@ -0,0 +1,88 @@
+package playout
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	_ "time/tzdata" // Station timezones must resolve even on minimal container images
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+// StationLocation resolves a station's timezone, falling back to UTC
+func StationLocation(station models.Station) *time.Location {
+	loc, err := time.LoadLocation(station.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Occurrences expands weekly slots into concrete airings overlapping [from, to),
+// computed in the station's timezone so slots keep their wall-clock time across DST
+func Occurrences(slots []models.ScheduleSlot, loc *time.Location, from, to time.Time) []models.ScheduleOccurrence {
+	occurrences := []models.ScheduleOccurrence{}
+
+	// Start a day early so a slot that began yesterday and is still running is included
+	local := from.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, slot := range slots {
+			if !containsDay(slot.DaysOfWeek, int(day.Weekday())) {
+				continue
+			}
+
+			var hour, minute int
+			if _, err := fmt.Sscanf(slot.StartTime, "%d:%d", &hour, &minute); err != nil {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+			end := start.Add(time.Duration(slot.DurationMinutes) * time.Minute)
+			if end.After(from) && start.Before(to) {
+				occurrences = append(occurrences, models.ScheduleOccurrence{
+					ScheduleSlot: slot,
+					StartsAt:     start,
+					EndsAt:       end,
+				})
+			}
+		}
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool {
+		if occurrences[i].StartsAt.Equal(occurrences[j].StartsAt) {
+			return occurrences[i].ID < occurrences[j].ID
+		}
+		return occurrences[i].StartsAt.Before(occurrences[j].StartsAt)
+	})
+	return occurrences
+}
+
+// ActiveSlot returns the slot airing on a station right now, or nil
+func ActiveSlot(station models.Station) (*models.ScheduleOccurrence, error) {
+	slots, err := database.ListScheduleSlots(station.ID)
+	if err != nil {
+		return nil, err
+	}
+	return activeOccurrence(slots, StationLocation(station), time.Now()), nil
+}
+
+// activeOccurrence returns the slot airing at now. When slots overlap, the
+// one that started most recently wins, so short specials override long blocks.
+func activeOccurrence(slots []models.ScheduleSlot, loc *time.Location, now time.Time) *models.ScheduleOccurrence {
+	occurrences := Occurrences(slots, loc, now, now.Add(time.Nanosecond))
+	if len(occurrences) == 0 {
+		return nil
+	}
+	latest := occurrences[len(occurrences)-1]
+	return &latest
+}
+
+func containsDay(days []int, day int) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
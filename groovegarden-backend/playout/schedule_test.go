@@ -0,0 +1,172 @@
+package playout
+
+import (
+	"testing"
+	"time"
+
+	"groovegarden/models"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestOccurrences(t *testing.T) {
+	london := mustLocation(t, "Europe/London")
+	everyDay := []int{0, 1, 2, 3, 4, 5, 6}
+
+	tests := []struct {
+		name  string
+		slots []models.ScheduleSlot
+		loc   *time.Location
+		from  time.Time
+		to    time.Time
+		want  [][2]time.Time // StartsAt and EndsAt of each occurrence
+	}{
+		{
+			name:  "weekly slot in a week",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: []int{1}, StartTime: "09:00", DurationMinutes: 60}},
+			loc:   time.UTC,
+			from:  time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), // Sunday
+			to:    time.Date(2024, 6, 9, 0, 0, 0, 0, time.UTC),
+			want: [][2]time.Time{
+				{time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC), time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "slot still running from the day before",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: []int{5}, StartTime: "23:00", DurationMinutes: 120}},
+			loc:   time.UTC,
+			from:  time.Date(2024, 6, 8, 0, 30, 0, 0, time.UTC), // Saturday
+			to:    time.Date(2024, 6, 8, 12, 0, 0, 0, time.UTC),
+			want: [][2]time.Time{
+				{time.Date(2024, 6, 7, 23, 0, 0, 0, time.UTC), time.Date(2024, 6, 8, 1, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "slot ending exactly at from is excluded",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: everyDay, StartTime: "10:00", DurationMinutes: 60}},
+			loc:   time.UTC,
+			from:  time.Date(2024, 6, 8, 11, 0, 0, 0, time.UTC),
+			to:    time.Date(2024, 6, 8, 12, 0, 0, 0, time.UTC),
+			want:  [][2]time.Time{},
+		},
+		{
+			name:  "invalid start time is skipped",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: everyDay, StartTime: "noon", DurationMinutes: 60}},
+			loc:   time.UTC,
+			from:  time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC),
+			to:    time.Date(2024, 6, 9, 0, 0, 0, 0, time.UTC),
+			want:  [][2]time.Time{},
+		},
+		{
+			name: "same start sorted by slot ID",
+			slots: []models.ScheduleSlot{
+				{ID: 2, DaysOfWeek: everyDay, StartTime: "10:00", DurationMinutes: 30},
+				{ID: 1, DaysOfWeek: everyDay, StartTime: "10:00", DurationMinutes: 60},
+			},
+			loc:  time.UTC,
+			from: time.Date(2024, 6, 8, 9, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, 6, 8, 11, 0, 0, 0, time.UTC),
+			want: [][2]time.Time{
+				{time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC), time.Date(2024, 6, 8, 11, 0, 0, 0, time.UTC)},
+				{time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC), time.Date(2024, 6, 8, 10, 30, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "keeps wall-clock time across the spring DST change",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: everyDay, StartTime: "08:00", DurationMinutes: 60}},
+			loc:   london,
+			from:  time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC), // Clocks go forward on 31 March
+			to:    time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			want: [][2]time.Time{
+				{time.Date(2024, 3, 30, 8, 0, 0, 0, time.UTC), time.Date(2024, 3, 30, 9, 0, 0, 0, time.UTC)},
+				{time.Date(2024, 3, 31, 7, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 8, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "keeps wall-clock time across the autumn DST change",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: everyDay, StartTime: "08:00", DurationMinutes: 60}},
+			loc:   london,
+			from:  time.Date(2024, 10, 26, 0, 0, 0, 0, time.UTC), // Clocks go back on 27 October
+			to:    time.Date(2024, 10, 28, 0, 0, 0, 0, time.UTC),
+			want: [][2]time.Time{
+				{time.Date(2024, 10, 26, 7, 0, 0, 0, time.UTC), time.Date(2024, 10, 26, 8, 0, 0, 0, time.UTC)},
+				{time.Date(2024, 10, 27, 8, 0, 0, 0, time.UTC), time.Date(2024, 10, 27, 9, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "duration is elapsed time over the DST change",
+			slots: []models.ScheduleSlot{{ID: 1, DaysOfWeek: []int{0}, StartTime: "00:00", DurationMinutes: 180}},
+			loc:   london,
+			from:  time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+			to:    time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC),
+			want: [][2]time.Time{
+				// 00:00 GMT to 04:00 BST
+				{time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 3, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Occurrences(tt.slots, tt.loc, tt.from, tt.to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				if !got[i].StartsAt.Equal(want[0]) || !got[i].EndsAt.Equal(want[1]) {
+					t.Errorf("occurrence %d: got %s to %s, want %s to %s",
+						i, got[i].StartsAt.UTC(), got[i].EndsAt.UTC(), want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+func TestActiveOccurrence(t *testing.T) {
+	london := mustLocation(t, "Europe/London")
+	everyDay := []int{0, 1, 2, 3, 4, 5, 6}
+	block := models.ScheduleSlot{ID: 1, DaysOfWeek: everyDay, StartTime: "06:00", DurationMinutes: 12 * 60}
+	special := models.ScheduleSlot{ID: 2, DaysOfWeek: everyDay, StartTime: "12:00", DurationMinutes: 60}
+	morning := models.ScheduleSlot{ID: 3, DaysOfWeek: everyDay, StartTime: "09:00", DurationMinutes: 60}
+
+	tests := []struct {
+		name   string
+		slots  []models.ScheduleSlot
+		loc    *time.Location
+		now    time.Time
+		wantID int // 0 for no slot
+	}{
+		{"nothing scheduled", nil, time.UTC, time.Date(2024, 6, 8, 12, 0, 0, 0, time.UTC), 0},
+		{"inside a slot", []models.ScheduleSlot{block}, time.UTC, time.Date(2024, 6, 8, 8, 0, 0, 0, time.UTC), 1},
+		{"before a slot", []models.ScheduleSlot{block}, time.UTC, time.Date(2024, 6, 8, 5, 59, 0, 0, time.UTC), 0},
+		{"at the end of a slot", []models.ScheduleSlot{block}, time.UTC, time.Date(2024, 6, 8, 18, 0, 0, 0, time.UTC), 0},
+		{"later start overrides", []models.ScheduleSlot{block, special}, time.UTC, time.Date(2024, 6, 8, 12, 30, 0, 0, time.UTC), 2},
+		{"block resumes after the special", []models.ScheduleSlot{block, special}, time.UTC, time.Date(2024, 6, 8, 13, 0, 0, 0, time.UTC), 1},
+		// 08:30 UTC is 09:30 BST on the first day of summer time
+		{"local time after spring DST change", []models.ScheduleSlot{morning}, london, time.Date(2024, 3, 31, 8, 30, 0, 0, time.UTC), 3},
+		{"UTC time after spring DST change", []models.ScheduleSlot{morning}, london, time.Date(2024, 3, 31, 9, 30, 0, 0, time.UTC), 0},
+		// 09:30 UTC is 09:30 GMT on the first day of winter time
+		{"local time after autumn DST change", []models.ScheduleSlot{morning}, london, time.Date(2024, 10, 27, 9, 30, 0, 0, time.UTC), 3},
+		{"UTC time after autumn DST change", []models.ScheduleSlot{morning}, london, time.Date(2024, 10, 27, 8, 30, 0, 0, time.UTC), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := activeOccurrence(tt.slots, tt.loc, tt.now)
+			gotID := 0
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.wantID {
+				t.Errorf("got slot %d, want %d", gotID, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package playout
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"groovegarden/database"
+	"groovegarden/models"
+)
+
+// errNothingToPlay means the station's queue is empty and its pool has no songs
+var errNothingToPlay = errors.New("nothing to play")
+
+// track is a song picked for a station, with where it came from
+type track struct {
+	songID   int
+	jingleID int // set instead of songID for inserted jingles
+	path     string
+	queueID  int    // station_queue row, 0 for vote winners
+	source   string // 'queue' source value, 'vote', 'schedule' or 'jingle'
+	position int    // playlist position for scheduled playlist tracks
+}
+
+// String names the track in logs
+func (t *track) String() string {
+	if t.jingleID != 0 {
+		return fmt.Sprintf("jingle %d", t.jingleID)
+	}
+	return fmt.Sprintf("song %d", t.songID)
+}
+
+// poolRestriction narrows the vote pool while a schedule slot is on air
+type poolRestriction struct {
+	tag      string // only songs carrying this genre/mood/tag
+	artistID int    // only songs by this artist
+}
+
+// nextQueueEntry selects the entry a station ($1) plays next from its queue:
+// the first, with paid queue jumps ahead, whose song has audio and is outside
+// the repeat window
+const nextQueueEntry = `
+	SELECT q.id, q.song_id, q.source, s.storage_path
+	FROM station_queue q
+	JOIN songs s ON s.id = q.song_id
+	JOIN stations st ON st.id = q.station_id
+	WHERE q.station_id = $1 AND s.storage_path IS NOT NULL
+	  AND NOT ` + database.RecentlyPlayed + `
+	ORDER BY q.priority DESC, q.added_at, q.id
+	LIMIT 1`
+
+// nextTrack picks what a station plays next: queued songs first, in order
+// with paid queue jumps ahead, then whatever the active schedule slot calls
+// for, then the song with the most votes in the current round of the
+// station's pool. Ties (including a round with no votes) are broken at random.
+//
+// No source may bring back a song within the station's repeat window: queued
+// songs (approved requests included) wait in the queue until it has passed,
+// and playlists and the pool skip them. When nothing else is left the
+// station plays silence until a song is due again.
+func nextTrack(stationID int, lastSongID int, prog *programme) (*track, error) {
+	t := &track{}
+	err := database.DB.QueryRow(nextQueueEntry, stationID).Scan(&t.queueID, &t.songID, &t.source, &t.path)
+	if err == nil {
+		return t, nil
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read queue for station %d: %w", stationID, err)
+	}
+
+	// A slot with nothing playable falls back to the station's normal pool
+	if slot := prog.slot(); slot != nil {
+		var t *track
+		var err error
+		switch slot.Rule {
+		case database.RulePlaylist:
+			if slot.PlaylistID != nil {
+				t, err = nextPlaylistTrack(stationID, *slot.PlaylistID, prog.playlistPos)
+			}
+		case database.RuleGenre:
+			t, err = voteWinner(stationID, lastSongID, poolRestriction{tag: slot.Tag})
+		case database.RuleLive:
+			if slot.ArtistID != nil {
+				t, err = voteWinner(stationID, lastSongID, poolRestriction{artistID: *slot.ArtistID})
+			}
+		}
+		if err != nil && err != errNothingToPlay {
+			return nil, err
+		} else if t != nil {
+			return t, nil
+		}
+	}
+
+	return voteWinner(stationID, lastSongID, poolRestriction{})
+}
+
+// voteWinner picks the current round's most voted song in the station's
+// pool, leaving out songs played within the station's repeat window.
+func voteWinner(stationID int, lastSongID int, restrict poolRestriction) (*track, error) {
+	t := &track{source: "vote"}
+	err := database.DB.QueryRow(`
+		SELECT s.id, s.storage_path
+		FROM songs s
+		JOIN stations st ON st.id = $1
+		WHERE `+database.StationPoolFilter+`
+		  AND s.id <> $2
+		  AND ($3 = '' OR EXISTS (
+			SELECT 1 FROM song_tags rst JOIN tags rt ON rt.id = rst.tag_id
+			WHERE rst.song_id = s.id AND rt.name = $3))
+		  AND ($4 = 0 OR s.artist_id = $4)
+		  AND NOT `+database.RecentlyPlayed+`
+		ORDER BY COALESCE((
+			SELECT SUM(v.weight) FROM votes v
+			WHERE v.station_id = st.id AND v.round = st.vote_round AND v.song_id = s.id
+		), 0) DESC, random()
+		LIMIT 1
+	`, stationID, lastSongID, restrict.tag, restrict.artistID).Scan(&t.songID, &t.path)
+	if err == sql.ErrNoRows {
+		return nil, errNothingToPlay
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to pick vote winner for station %d: %w", stationID, err)
+	}
+	return t, nil
+}
+
+// nextPlaylistTrack returns the playlist's first track after position,
+// wrapping around to the start when the playlist has been played through.
+// Tracks within the station's repeat window are passed over.
+func nextPlaylistTrack(stationID int, playlistID int, position int) (*track, error) {
+	t := &track{source: "schedule"}
+	err := database.DB.QueryRow(`
+		SELECT pt.position, s.id, s.storage_path
+		FROM playlist_tracks pt
+		JOIN songs s ON s.id = pt.song_id
+		JOIN stations st ON st.id = $3
+		WHERE pt.playlist_id = $1 AND s.storage_path IS NOT NULL
+		  AND NOT `+database.RecentlyPlayed+`
+		ORDER BY pt.position <= $2, pt.position
+		LIMIT 1
+	`, playlistID, position, stationID).Scan(&t.position, &t.songID, &t.path)
+	if err == sql.ErrNoRows {
+		return nil, errNothingToPlay
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read playlist %d: %w", playlistID, err)
+	}
+	return t, nil
+}
+
+// startNextRound removes a queued track once it airs and opens a new vote round
+func startNextRound(stationID int, t *track) (int, error) {
+	if t.queueID != 0 {
+		if _, err := database.DB.Exec("DELETE FROM station_queue WHERE id = $1", t.queueID); err != nil {
+			return 0, fmt.Errorf("failed to remove queue entry %d: %w", t.queueID, err)
+		}
+	}
+
+	var round int
+	err := database.DB.QueryRow(
+		"UPDATE stations SET vote_round = vote_round + 1 WHERE id = $1 RETURNING vote_round", stationID,
+	).Scan(&round)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start vote round for station %d: %w", stationID, err)
+	}
+	return round, nil
+}
+
+// programme tracks which schedule slot a worker is airing
+type programme struct {
+	current     *models.ScheduleOccurrence
+	playlistPos int // last playlist position aired in this occurrence
+}
+
+// slot returns the slot on air, or nil outside the schedule
+func (p *programme) slot() *models.ScheduleOccurrence {
+	if p == nil {
+		return nil
+	}
+	return p.current
+}
@@ -0,0 +1,314 @@
+package playout
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"groovegarden/database"
+	"groovegarden/models"
+	"groovegarden/websocket"
+)
+
+const (
+	// idleCheckInterval is how long a station plays silence before looking for songs again
+	idleCheckInterval = 10 * time.Second
+	// restartDelay is how long to wait before reconnecting a failed encoder
+	restartDelay = 15 * time.Second
+)
+
+// worker runs the playout loop of one station. Its station's mount and
+// timezone are fixed for the worker's lifetime; the other settings may be
+// updated while it runs, under mu.
+type worker struct {
+	station models.Station
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	live chan *liveSession // a live source waiting to take over
+
+	mu          sync.Mutex
+	nowPlaying  *models.NowPlaying
+	liveSession *liveSession // pending or on air
+	playID      int          // plays row of the song on air
+	skipping    bool         // listeners voted the song on air off
+}
+
+// newWorker starts a worker for a station
+func newWorker(station models.Station) *worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &worker{
+		station: station,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		live:    make(chan *liveSession, 1),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// stop cancels the worker and waits for its processes to exit
+func (w *worker) stop() {
+	w.cancel()
+	<-w.done
+}
+
+// update takes on station settings that apply without reconnecting the encoder
+func (w *worker) update(station models.Station) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.station.Name = station.Name
+	w.station.Slug = station.Slug
+	w.station.Status = station.Status
+	w.station.RepeatWindowMinutes = station.RepeatWindowMinutes
+	w.station.SkipRatio = station.SkipRatio
+	w.station.SkipMinVotes = station.SkipMinVotes
+	w.station.AutoApproveRequests = station.AutoApproveRequests
+}
+
+func (w *worker) name() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.station.Name
+}
+
+// current returns the track on air, or nil
+func (w *worker) current() *models.NowPlaying {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.nowPlaying
+}
+
+// run keeps an encoder connected to the station's mount and feeds it tracks
+func (w *worker) run(ctx context.Context) {
+	defer close(w.done)
+	w.publishState()
+	defer func() {
+		if err := database.DeletePlayoutState(w.station.ID); err != nil {
+			log.Printf("Station %d: could not clear playout state: %v", w.station.ID, err)
+		}
+	}()
+	log.Printf("Playout started for station %d (%s) on mount %s", w.station.ID, w.name(), w.station.Mount)
+
+	for ctx.Err() == nil {
+		out, err := startEncoder(ctx, w.station.Mount)
+		if err != nil {
+			log.Printf("Station %d: %v", w.station.ID, err)
+		} else {
+			err = w.playLoop(ctx, out)
+			out.Close()
+			if ctx.Err() == nil {
+				log.Printf("Station %d: encoder stopped: %v", w.station.ID, err)
+			}
+		}
+		w.setNowPlaying(nil)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(restartDelay):
+		}
+	}
+
+	log.Printf("Playout stopped for station %d (%s)", w.station.ID, w.name())
+}
+
+// playLoop plays track after track until the encoder fails or the worker stops
+func (w *worker) playLoop(ctx context.Context, out *encoder) error {
+	lastSongID := 0
+	prog := &programme{}
+	ins := newInsertions()
+	for ctx.Err() == nil {
+		// A live source takes over from the rotation until it drops
+		select {
+		case s := <-w.live:
+			if err := w.playLive(ctx, s, out); err != nil {
+				return err
+			}
+			continue
+		default:
+		}
+
+		w.updateProgramme(prog)
+
+		t, err := nextTrack(w.station.ID, lastSongID, prog)
+		if err == errNothingToPlay {
+			if err := w.idle(ctx, out); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			log.Printf("Station %d: %v", w.station.ID, err)
+			if err := w.idle(ctx, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		request := markRequestPlayed(w.station.ID, t)
+		round, err := startNextRound(w.station.ID, t)
+		if err != nil {
+			log.Printf("Station %d: %v", w.station.ID, err)
+		} else {
+			websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventVoteRoundStarted, websocket.VoteRoundStarted{
+				StationID: w.station.ID,
+				Round:     round,
+			})
+		}
+
+		w.announce(t)
+		w.dedicate(request)
+		notifyRequestUpNext(w.station.ID)
+		lastSongID = t.songID
+		if t.source == "schedule" {
+			prog.playlistPos = t.position
+		}
+
+		playID := logPlayStart(w.station.ID, t)
+		w.setPlay(playID)
+		completed, err := w.play(ctx, t, out)
+		w.setPlay(0)
+		logPlayEnd(playID, !completed)
+		if err != nil {
+			return err
+		}
+
+		// Station IDs, sponsor spots and promos go between songs
+		if err := w.insertJingles(ctx, out, ins); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// updateProgramme checks the schedule at a track boundary and announces when
+// a different slot (or no slot) takes over
+func (w *worker) updateProgramme(prog *programme) {
+	slots, err := database.ListScheduleSlots(w.station.ID)
+	if err != nil {
+		log.Printf("Station %d: could not load schedule: %v", w.station.ID, err)
+		return
+	}
+	next := activeOccurrence(slots, StationLocation(w.station), time.Now())
+	// Keep edits to the running slot, but only a new airing restarts its playlist
+	changed := !sameOccurrence(prog.current, next)
+	prog.current = next
+	if !changed {
+		return
+	}
+
+	prog.playlistPos = 0
+	websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventProgrammeChanged, websocket.ProgrammeChanged{
+		StationID: w.station.ID,
+		Slot:      next,
+	})
+}
+
+func sameOccurrence(a, b *models.ScheduleOccurrence) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID && a.StartsAt.Equal(b.StartsAt)
+}
+
+// idle plays silence for idleCheckInterval, cut short when a live source is waiting
+func (w *worker) idle(ctx context.Context, out *encoder) error {
+	for remaining := idleCheckInterval; remaining > 0 && !w.livePending(); remaining -= pcmDuration(chunkSize) {
+		if err := out.writeSilence(ctx, pcmDuration(chunkSize)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// play decodes one track into the encoder, fading it out early if a live
+// source is waiting or listeners skip it, and reports whether it played to
+// the end. Only encoder errors are returned; a track that can't be decoded is
+// logged and skipped.
+func (w *worker) play(ctx context.Context, t *track, out *encoder) (bool, error) {
+	dec, err := startDecoder(ctx, t.path)
+	if err != nil {
+		log.Printf("Station %d: skipping %s: %v", w.station.ID, t, err)
+		return false, nil
+	}
+	defer dec.Close()
+
+	buf := make([]byte, chunkSize)
+	fading, fadeLeft, fadeTotal := false, 0, 0
+	for ctx.Err() == nil {
+		n, err := io.ReadFull(dec, buf)
+		if !fading {
+			if w.livePending() {
+				fading, fadeLeft, fadeTotal = true, fadeLength, fadeLength
+			} else if w.skipRequested() {
+				fading, fadeLeft, fadeTotal = true, skipFadeLength, skipFadeLength
+			}
+		}
+		if n > 0 {
+			if fading {
+				fadeOut(buf[:n], fadeLeft, fadeTotal)
+				fadeLeft -= n
+			}
+			if _, werr := out.Write(buf[:n]); werr != nil {
+				return false, werr
+			}
+		}
+		if fading && fadeLeft <= 0 {
+			return false, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true, nil
+		} else if err != nil {
+			log.Printf("Station %d: error decoding %s: %v", w.station.ID, t, err)
+			return false, nil
+		}
+	}
+	return false, ctx.Err()
+}
+
+// announce publishes now-playing metadata (with the album it's from) to the station's listeners
+func (w *worker) announce(t *track) {
+	nowPlaying, err := database.GetNowPlaying(t.songID)
+	if err != nil {
+		log.Printf("Station %d: could not load now-playing metadata for song %d: %v", w.station.ID, t.songID, err)
+		return
+	}
+	nowPlaying.StationID = w.station.ID
+
+	w.setNowPlaying(nowPlaying)
+	websocket.NotifyTopic(websocket.StationTopic(w.station.ID), websocket.EventNowPlaying, nowPlaying)
+}
+
+// setPlay marks which plays row is on air and clears any pending skip
+func (w *worker) setPlay(playID int) {
+	w.mu.Lock()
+	w.playID = playID
+	w.skipping = false
+	w.mu.Unlock()
+	w.publishState()
+}
+
+func (w *worker) skipRequested() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.skipping
+}
+
+func (w *worker) setNowPlaying(nowPlaying *models.NowPlaying) {
+	w.mu.Lock()
+	w.nowPlaying = nowPlaying
+	w.mu.Unlock()
+	w.publishState()
+}
+
+// publishState lets the other instances see what the station is doing
+func (w *worker) publishState() {
+	w.mu.Lock()
+	state := database.PlayoutState{StationID: w.station.ID, PlayID: w.playID, NowPlaying: w.nowPlaying}
+	w.mu.Unlock()
+
+	if err := database.SetPlayoutState(state); err != nil {
+		log.Printf("Station %d: could not publish playout state: %v", w.station.ID, err)
+	}
+}
@@ -0,0 +1,183 @@
+// Package reactions collects listeners' emoji reactions to the song on air.
+// Reactions are tallied in short windows and each window is broadcast once,
+// so a popular track sends clients a running count rather than every
+// reaction, then added to the song's stored totals. Tallies are kept by the
+// leader instance, which runs playout; the others forward reactions to it.
+package reactions
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"groovegarden/cluster"
+	"groovegarden/database"
+	"groovegarden/playout"
+	"groovegarden/websocket"
+)
+
+// window is how long reactions are collected before being broadcast and stored
+const window = 2 * time.Second
+
+// commandReact forwards a reaction to the leader
+const commandReact = "react"
+
+// reactCommand is a reaction forwarded to the leader
+type reactCommand struct {
+	StationID int    `json:"station_id"`
+	UserID    int    `json:"user_id"`
+	Reaction  string `json:"reaction"`
+}
+
+var (
+	ErrUnknownReaction = errors.New("reaction must be fire, heart or sleepy")
+	ErrNothingPlaying  = errors.New("Nothing to react to right now")
+)
+
+// tally is one play's reactions
+type tally struct {
+	stationID int
+	songID    int
+	counts    map[string]int // Since the last window
+	reacted   map[reacted]bool
+}
+
+// reacted is a listener's reaction; each counts once per play
+type reacted struct {
+	userID   int
+	reaction string
+}
+
+var (
+	tallies   = make(map[int]*tally) // By play
+	talliesMu sync.Mutex
+)
+
+// React counts a listener's reaction (its name or emoji) to the song on a
+// station's air. It reports false when they already sent that reaction to
+// this play. Other instances than the leader forward the reaction and report
+// it as counted; the leader still counts it only once.
+func React(stationID, userID int, reaction string) (bool, error) {
+	reaction, ok := reactionName(reaction)
+	if !ok {
+		return false, ErrUnknownReaction
+	}
+	if !cluster.IsLeader() {
+		if playout.CurrentPlay(stationID) == 0 {
+			return false, ErrNothingPlaying
+		}
+		websocket.SendInstanceCommand(commandReact, reactCommand{StationID: stationID, UserID: userID, Reaction: reaction})
+		return true, nil
+	}
+	return react(stationID, userID, reaction)
+}
+
+// HandleInstanceCommands lets the leader count reactions forwarded by the other instances
+func HandleInstanceCommands() {
+	websocket.OnInstanceCommand(commandReact, func(data json.RawMessage) {
+		if !cluster.IsLeader() {
+			return
+		}
+		var cmd reactCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			log.Printf("Invalid react command: %v", err)
+			return
+		}
+		if _, err := react(cmd.StationID, cmd.UserID, cmd.Reaction); err != nil && err != ErrNothingPlaying {
+			log.Printf("Error counting reaction on station %d: %v", cmd.StationID, err)
+		}
+	})
+}
+
+// react tallies a reaction on the leader
+func react(stationID, userID int, reaction string) (bool, error) {
+	playID := playout.CurrentPlay(stationID)
+	nowPlaying := playout.NowPlaying(stationID)
+	if playID == 0 || nowPlaying == nil || nowPlaying.Song == nil {
+		return false, ErrNothingPlaying
+	}
+
+	talliesMu.Lock()
+	defer talliesMu.Unlock()
+
+	t, ok := tallies[playID]
+	if !ok {
+		t = &tally{
+			stationID: stationID,
+			songID:    nowPlaying.Song.ID,
+			counts:    make(map[string]int),
+			reacted:   make(map[reacted]bool),
+		}
+		tallies[playID] = t
+	}
+	key := reacted{userID, reaction}
+	if t.reacted[key] {
+		return false, nil
+	}
+	t.reacted[key] = true
+	t.counts[reaction]++
+	return true, nil
+}
+
+// Run broadcasts and stores each window's reactions until the process exits;
+// only the leader has any to send
+func Run() {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for range ticker.C {
+		flush()
+	}
+}
+
+// flush sends out the reactions counted since the last window
+func flush() {
+	type batch struct {
+		playID int
+		tally
+	}
+	var batches []batch
+
+	talliesMu.Lock()
+	for playID, t := range tallies {
+		if len(t.counts) == 0 {
+			// Who reacted is kept for as long as the song is on air
+			if playout.CurrentPlay(t.stationID) != playID {
+				delete(tallies, playID)
+			}
+			continue
+		}
+		batches = append(batches, batch{playID, tally{stationID: t.stationID, songID: t.songID, counts: t.counts}})
+		t.counts = make(map[string]int)
+	}
+	talliesMu.Unlock()
+
+	for _, b := range batches {
+		websocket.NotifyTopic(websocket.StationTopic(b.stationID), websocket.EventReactions, websocket.Reactions{
+			StationID: b.stationID,
+			PlayID:    b.playID,
+			SongID:    b.songID,
+			Counts:    b.counts,
+		})
+		if err := database.AddSongReactions(b.songID, b.counts); err != nil {
+			log.Printf("Error storing reactions to song %d: %v", b.songID, err)
+		}
+	}
+}
+
+// reactionName resolves a reaction sent by name or as its emoji, with or
+// without the emoji presentation selector
+func reactionName(reaction string) (string, bool) {
+	if _, ok := database.ReactionEmoji[reaction]; ok {
+		return reaction, true
+	}
+	reaction = strings.TrimSuffix(reaction, "\uFE0F")
+	for name, emoji := range database.ReactionEmoji {
+		if strings.TrimSuffix(emoji, "\uFE0F") == reaction {
+			return name, true
+		}
+	}
+	return "", false
+}
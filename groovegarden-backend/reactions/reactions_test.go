@@ -0,0 +1,46 @@
+package reactions
+
+import (
+	"testing"
+
+	"groovegarden/database"
+)
+
+func TestReactionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		reaction string
+		want     string
+		wantOK   bool
+	}{
+		{"by name", "fire", "fire", true},
+		{"by emoji", "🔥", "fire", true},
+		{"emoji with presentation selector", "❤️", "heart", true},
+		{"emoji without presentation selector", "❤", "heart", true},
+		{"selector added to a plain emoji", "😴️", "sleepy", true},
+		{"names are case sensitive", "Fire", "", false},
+		{"unknown emoji", "👍", "", false},
+		{"bare selector", "️", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := reactionName(tt.reaction)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("reactionName(%q) = %q, %v, want %q, %v", tt.reaction, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEveryReactionResolvesAndIsWeighted(t *testing.T) {
+	for name, emoji := range database.ReactionEmoji {
+		if got, ok := reactionName(emoji); !ok || got != name {
+			t.Errorf("emoji %q resolved to %q, %v, want %q", emoji, got, ok, name)
+		}
+		if _, ok := database.ReactionWeight[name]; !ok {
+			t.Errorf("reaction %q has no rank weight", name)
+		}
+	}
+}
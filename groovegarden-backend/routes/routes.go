@@ -19,7 +19,9 @@ func RegisterRoutes(router *chi.Mux) {
 
 	// Song-related routes
 	router.Route("/songs", func(r chi.Router) {
-		r.Get("/", controllers.GetSongs) // Public route to fetch songs
+		r.Get("/", controllers.GetSongs)               // Public route to fetch songs, optional ?tag= filters
+		r.Get("/{id}/plays", controllers.GetSongPlays) // Public airplay history of a song
+		r.Get("/{id}/reactions", controllers.GetSongReactions)
 
 		// Routes requiring authentication
 		r.Group(func(auth chi.Router) {
@@ -28,6 +30,11 @@ func RegisterRoutes(router *chi.Mux) {
 			// Voting for songs
 			auth.Post("/vote/{id}", controllers.VoteForSong)
 
+			// Editing and deleting songs (owning artist or admin, checked in the handler)
+			auth.Patch("/{id}", controllers.UpdateSong)
+			auth.Delete("/{id}", controllers.DeleteSong)
+			auth.Put("/{id}/audio", controllers.ReplaceSongAudio)
+
 			// Routes restricted to artists
 			auth.Group(func(artist chi.Router) {
 				artist.Use(middleware.RoleCheckMiddleware("artist"))
@@ -37,16 +44,174 @@ func RegisterRoutes(router *chi.Mux) {
 		})
 	})
 
+	// Search routes (public)
+	router.Route("/search", func(r chi.Router) {
+		r.Get("/", controllers.Search)                   // Ranked songs and artists
+		r.Get("/autocomplete", controllers.Autocomplete) // Suggestions for the search box
+	})
+
+	// Genre, mood and tag vocabulary
+	router.Route("/tags", func(r chi.Router) {
+		r.Get("/", controllers.GetTags) // Public, optional ?kind=genre|mood|tag
+
+		r.Group(func(admin chi.Router) {
+			admin.Use(middleware.JWTAuthMiddleware)
+			admin.Use(middleware.RoleCheckMiddleware("admin"))
+			admin.Post("/", controllers.CreateTag) // Add curated genres and moods
+		})
+	})
+
+	// Release routes
+	router.Route("/releases", func(r chi.Router) {
+		r.Get("/{id}", controllers.GetRelease)            // Release with ordered track listing (public)
+		r.Get("/{id}/cover", controllers.GetReleaseCover) // Cover image (public)
+
+		r.Group(func(artist chi.Router) {
+			artist.Use(middleware.JWTAuthMiddleware)
+			artist.Use(middleware.RoleCheckMiddleware("artist"))
+			artist.Post("/", controllers.CreateRelease) // Bulk upload of a whole release
+		})
+	})
+
+	// Artist routes
+	router.Route("/artists", func(r chi.Router) {
+		r.Get("/{id}/releases", controllers.GetArtistReleases) // Public discography
+
+		r.Group(func(artist chi.Router) {
+			artist.Use(middleware.JWTAuthMiddleware)
+			artist.Use(middleware.RoleCheckMiddleware("artist"))
+			artist.Get("/me/stats", controllers.GetMyArtistStats) // Own plays, audience and votes
+		})
+	})
+
+	// Station routes
+	router.Route("/stations", func(r chi.Router) {
+		r.Get("/", controllers.ListStations)                    // Public list with now-playing
+		r.Get("/{id}", controllers.GetStation)                  // Public station details
+		r.Get("/{id}/queue", controllers.GetStationQueue)       // Public queue and vote standings
+		r.Get("/{id}/schedule", controllers.GetStationSchedule) // Public weekly slot definitions
+		r.Get("/{id}/chat", controllers.GetStationChat)         // Public chat scrollback, ?before=<message id>
+		// Signed-in listeners tuned in now, minus those who hide their presence
+		r.Get("/{id}/listeners", controllers.GetStationListeners)
+
+		r.Group(func(auth chi.Router) {
+			auth.Use(middleware.JWTAuthMiddleware)
+
+			// Listeners vote within a station
+			auth.Post("/{id}/vote/{songID}", controllers.VoteInStation)
+			auth.Post("/{id}/skip", controllers.VoteToSkip)      // Vote the song on air off
+			auth.Post("/{id}/requests", controllers.RequestSong) // Request a song, optionally with a dedication
+			auth.Post("/{id}/queue/jump", controllers.JumpQueue) // Spend credits to play a song next
+			auth.Post("/{id}/chat", controllers.PostChatMessage) // Chat without a websocket
+
+			// Station management is restricted to admins
+			auth.Group(func(admin chi.Router) {
+				admin.Use(middleware.RoleCheckMiddleware("admin"))
+				admin.Post("/", controllers.CreateStation)
+				admin.Patch("/{id}", controllers.UpdateStation)
+				admin.Delete("/{id}", controllers.DeleteStation)
+				admin.Post("/{id}/pause", controllers.PauseStation)
+				admin.Post("/{id}/resume", controllers.ResumeStation)
+				admin.Post("/{id}/queue", controllers.EnqueueSong)
+				admin.Delete("/{id}/live", controllers.EndLiveSession)
+				admin.Get("/{id}/listener-stats", controllers.GetListenerStats)
+				admin.Get("/{id}/requests", controllers.GetStationRequests)
+				admin.Post("/{id}/requests/{requestID}/approve", controllers.ApproveRequest)
+				admin.Post("/{id}/requests/{requestID}/reject", controllers.RejectRequest)
+				admin.Delete("/{id}/chat/{messageID}", controllers.DeleteChatMessage)
+				admin.Get("/{id}/chat/restrictions", controllers.GetChatRestrictions)
+				admin.Put("/{id}/chat/restrictions/{userID}", controllers.RestrictChatUser)
+				admin.Delete("/{id}/chat/restrictions/{userID}", controllers.LiftChatRestriction)
+				admin.Get("/{id}/insertion-rules", controllers.GetInsertionRules)
+				admin.Post("/{id}/insertion-rules", controllers.CreateInsertionRule)
+				admin.Delete("/{id}/insertion-rules/{ruleID}", controllers.DeleteInsertionRule)
+				admin.Post("/{id}/schedule", controllers.CreateScheduleSlot)
+				admin.Delete("/{id}/schedule/{slotID}", controllers.DeleteScheduleSlot)
+			})
+		})
+	})
+
+	// Station IDs, sponsor spots and promos (admin only)
+	router.Route("/jingles", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Use(middleware.RoleCheckMiddleware("admin"))
+		r.Get("/", controllers.ListJingles)
+		r.Post("/", controllers.UploadJingle)
+		r.Delete("/{id}", controllers.DeleteJingle)
+	})
+
+	// Live input: artists and admins take over a station (authenticated in the handler,
+	// since source clients send their token as a Basic password)
+	chi.RegisterMethod("SOURCE")
+	router.Route("/live", func(r chi.Router) {
+		r.Method("SOURCE", "/{id}", http.HandlerFunc(controllers.LiveSource))
+		r.Put("/{id}", controllers.LiveSource)
+		r.Get("/{id}/ws", controllers.LiveWebSocket)
+	})
+
+	// Private listening parties: a host plays songs in sync for the members
+	router.Route("/parties", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Post("/", controllers.CreateParty)
+		r.Post("/join", controllers.JoinParty) // With the party's invite code
+		r.Get("/{id}", controllers.GetParty)
+		r.Post("/{id}/control", controllers.ControlParty) // Host: load, play, pause or seek
+		r.Post("/{id}/leave", controllers.LeaveParty)
+		r.Delete("/{id}", controllers.EndParty)
+	})
+
+	// Listener credits earned by listening and requests, spent on vote boosts and queue jumps
+	router.Route("/credits", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Get("/", controllers.GetMyCredits)              // Own balance and recent transactions
+		r.Post("/daily", controllers.ClaimDailyCredits)   // Once per UTC day
+		r.Post("/listening", controllers.RecordListening) // Player heartbeat while tuned in
+
+		r.Group(func(admin chi.Router) {
+			admin.Use(middleware.RoleCheckMiddleware("admin"))
+			admin.Get("/users/{userID}", controllers.GetUserCredits)
+			admin.Post("/users/{userID}/grant", controllers.GrantCredits)
+			admin.Post("/transactions/{transactionID}/refund", controllers.RefundCredits)
+		})
+	})
+
+	// Websocket hub connections and queue depths (admin only)
+	router.With(middleware.JWTAuthMiddleware, middleware.RoleCheckMiddleware("admin")).
+		Get("/ws/metrics", controllers.GetWebSocketMetrics)
+
+	// Recently played songs (public, optional ?since= and ?station=)
+	router.Get("/history", controllers.GetHistory)
+
+	// Programme for the next 7 days (public, optional ?station=ID)
+	router.Get("/schedule", controllers.GetSchedule)
+
+	// Playlists played by schedule slots (admin only)
+	router.Route("/playlists", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Use(middleware.RoleCheckMiddleware("admin"))
+		r.Get("/", controllers.ListPlaylists)
+		r.Post("/", controllers.CreatePlaylist)
+		r.Get("/{id}", controllers.GetPlaylist)
+	})
+
 	// Song streaming routes
 	router.Route("/stream", func(r chi.Router) {
-		r.Get("/{id}", controllers.StreamSong)       // Stream a specific song (public access)
-		r.Post("/start", controllers.StartStream)    // Start the global stream (requires admin privileges later)
-		r.Post("/stop", controllers.StopStream)      // Stop the global stream (requires admin privileges later)
+		r.Get("/now-playing", controllers.GetNowPlaying) // Current track with release info
+		r.Get("/{id}", controllers.StreamSong)           // Stream a specific song (public access)
+
+		// Put the default station on or off air (admin only)
+		r.Group(func(admin chi.Router) {
+			admin.Use(middleware.JWTAuthMiddleware)
+			admin.Use(middleware.RoleCheckMiddleware("admin"))
+			admin.Post("/start", controllers.StartStream)
+			admin.Post("/stop", controllers.StopStream)
+		})
 	})
 
 	// User-related routes
 	router.Route("/users", func(r chi.Router) {
 		r.Post("/upsert", controllers.UpsertUser)
+		r.With(middleware.JWTAuthMiddleware).Put("/me/presence", controllers.SetPresenceVisibility)
 		r.Get("/", controllers.GetUserByEmail)
 		r.Get("/{id}", controllers.GetUserByID)
 	})
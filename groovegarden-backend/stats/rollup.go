@@ -0,0 +1,158 @@
+// Package stats rolls the play log, votes and reactions up into per-artist daily
+// tables, so artist dashboards never scan raw plays.
+package stats
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"groovegarden/cluster"
+	"groovegarden/database"
+)
+
+// rollupInterval is how often the rollups are refreshed
+const rollupInterval = 10 * time.Minute
+
+// artistRollup names the artist rollups in stats_rollups
+const artistRollup = "artist"
+
+// Run refreshes the rollups on the leader instance until the process exits
+func Run() {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		if cluster.IsLeader() {
+			if err := RollupArtists(); err != nil {
+				log.Printf("Artist stats rollup failed: %v", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// RollupArtists rebuilds the artist rollups for every day that can still
+// change: from the day of the last run (plays that started then may have
+// ended since) up to today. The first run backfills everything.
+func RollupArtists() error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var from time.Time
+	err = tx.QueryRow("SELECT rolled_from FROM stats_rollups WHERE name = $1 FOR UPDATE", artistRollup).Scan(&from)
+	if err == sql.ErrNoRows {
+		from = time.Time{} // Everything
+	} else if err != nil {
+		return fmt.Errorf("failed to read rollup state: %w", err)
+	}
+
+	for _, table := range []string{"artist_daily_stats", "artist_daily_listeners", "artist_hourly_stats", "artist_country_stats", "artist_daily_reactions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE day >= $1", from); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+
+	// Listen-through compares how long each play lasted with the track length
+	_, err = tx.Exec(`
+		INSERT INTO artist_daily_stats (artist_id, day, plays, full_plays, skips, listen_seconds, track_seconds, audience)
+		SELECT p.artist_id, p.started_at::date,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE p.ended_at IS NOT NULL AND NOT p.skipped),
+		       COUNT(*) FILTER (WHERE p.skipped),
+		       COALESCE(SUM(LEAST(EXTRACT(EPOCH FROM p.ended_at - p.started_at), p.duration))
+		                FILTER (WHERE p.ended_at IS NOT NULL AND p.duration > 0), 0),
+		       COALESCE(SUM(p.duration) FILTER (WHERE p.ended_at IS NOT NULL AND p.duration > 0), 0),
+		       SUM(p.listener_count)
+		FROM plays p
+		WHERE p.artist_id IS NOT NULL AND p.started_at >= $1
+		GROUP BY 1, 2
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up plays: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO artist_daily_stats (artist_id, day, votes)
+		SELECT s.artist_id, v.created_at::date, COUNT(*)
+		FROM votes v
+		JOIN songs s ON s.id = v.song_id
+		WHERE s.artist_id IS NOT NULL AND v.created_at >= $1
+		GROUP BY 1, 2
+		ON CONFLICT (artist_id, day) DO UPDATE SET votes = EXCLUDED.votes
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up votes: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO artist_daily_reactions (artist_id, day, reaction, count)
+		SELECT s.artist_id, r.day, r.reaction, SUM(r.count)
+		FROM song_reactions r
+		JOIN songs s ON s.id = r.song_id
+		WHERE s.artist_id IS NOT NULL AND r.day >= $1
+		GROUP BY 1, 2, 3
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up reactions: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO artist_daily_stats (artist_id, day, reactions)
+		SELECT artist_id, day, SUM(count)
+		FROM artist_daily_reactions
+		WHERE day >= $1
+		GROUP BY 1, 2
+		ON CONFLICT (artist_id, day) DO UPDATE SET reactions = EXCLUDED.reactions
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up reaction totals: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO artist_daily_listeners (artist_id, day, listener_key)
+		SELECT DISTINCT p.artist_id, p.started_at::date, pl.listener_key
+		FROM play_listeners pl
+		JOIN plays p ON p.id = pl.play_id
+		WHERE p.artist_id IS NOT NULL AND p.started_at >= $1
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up listeners: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO artist_hourly_stats (artist_id, day, hour, plays, audience)
+		SELECT p.artist_id, p.started_at::date, EXTRACT(HOUR FROM p.started_at), COUNT(*), SUM(p.listener_count)
+		FROM plays p
+		WHERE p.artist_id IS NOT NULL AND p.started_at >= $1
+		GROUP BY 1, 2, 3
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up hours: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO artist_country_stats (artist_id, day, country, listeners)
+		SELECT p.artist_id, p.started_at::date, pl.country, COUNT(DISTINCT pl.listener_key)
+		FROM play_listeners pl
+		JOIN plays p ON p.id = pl.play_id
+		WHERE p.artist_id IS NOT NULL AND p.started_at >= $1 AND pl.country <> ''
+		GROUP BY 1, 2, 3
+	`, from)
+	if err != nil {
+		return fmt.Errorf("failed to roll up countries: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO stats_rollups (name, rolled_from, updated_at) VALUES ($1, CURRENT_DATE, NOW())
+		ON CONFLICT (name) DO UPDATE SET rolled_from = EXCLUDED.rolled_from, updated_at = EXCLUDED.updated_at
+	`, artistRollup)
+	if err != nil {
+		return fmt.Errorf("failed to save rollup state: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"groovegarden/utils"
+)
+
+// authTimeout is how long a connection that must authenticate has to send its token
+const authTimeout = 10 * time.Second
+
+// tokenSubprotocol marks a JWT passed as the following subprotocol, for
+// browsers that can't set headers on websocket requests:
+// new WebSocket(url, ["access_token", token])
+const tokenSubprotocol = "access_token"
+
+var (
+	allowedOrigins = originsFromEnv()
+	// requireAuth closes connections that haven't authenticated within authTimeout
+	requireAuth = os.Getenv("WS_REQUIRE_AUTH") == "true"
+)
+
+var errInvalidToken = errors.New("invalid user_id in token")
+
+// Identity is the user behind an authenticated connection
+type Identity struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// identityFromToken validates a JWT and reads the user it was issued to
+func identityFromToken(token string) (Identity, error) {
+	claims, err := utils.ValidateJWTAndGetClaims(token)
+	if err != nil {
+		return Identity{}, err
+	}
+	userID, ok := claims["user_id"].(float64) // JWT numbers are float64
+	if !ok || userID <= 0 {
+		return Identity{}, errInvalidToken
+	}
+	role, _ := claims["role"].(string)
+	return Identity{UserID: int(userID), Role: role}, nil
+}
+
+// handshakeToken finds a JWT in the upgrade request: a Bearer header, the
+// token query parameter or the access_token subprotocol. It also returns the
+// subprotocol to echo back, if the token came that way.
+func handshakeToken(r *http.Request) (token string, subprotocol string) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer "), ""
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, ""
+	}
+	protocols := splitHeader(r.Header.Get("Sec-WebSocket-Protocol"))
+	for i, protocol := range protocols {
+		if protocol == tokenSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1], tokenSubprotocol
+		}
+	}
+	return "", ""
+}
+
+// CheckOrigin accepts requests without an Origin (native apps, scripts), from
+// an allowed origin, or from the server's own host. Other websocket endpoints
+// use it too, so a page from another site can't open them with a user's token.
+func CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// originsFromEnv reads WS_ALLOWED_ORIGINS (comma separated), defaulting to the Flutter dev server
+func originsFromEnv() []string {
+	origins := splitHeader(os.Getenv("WS_ALLOWED_ORIGINS"))
+	if len(origins) == 0 {
+		return []string{"http://localhost:54321"}
+	}
+	return origins
+}
+
+func splitHeader(value string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
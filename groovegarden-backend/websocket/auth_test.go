@@ -0,0 +1,38 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	previous := allowedOrigins
+	allowedOrigins = []string{"https://app.groovegarden.com"}
+	t.Cleanup(func() { allowedOrigins = previous })
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"allowed origin", "https://app.groovegarden.com", true},
+		{"allowed origin in another case", "https://App.GrooveGarden.com", true},
+		{"same host", "http://api.groovegarden.com", true},
+		{"other site", "https://evil.example", false},
+		{"allowed host as a prefix", "http://app.groovegarden.com.evil.example", false},
+		{"malformed origin", "://", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://api.groovegarden.com/live/1/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := CheckOrigin(r); got != tt.want {
+				t.Errorf("CheckOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
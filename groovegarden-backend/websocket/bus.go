@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Bus carries events between backend instances. Every event published on any
+// instance is handed to the subscribers on every instance (including the
+// publisher's), which then fan it out to their own clients. Instances may
+// receive events from different publishers in different orders, so each one
+// numbers events itself as they arrive (see HandleMessages): a sequence
+// number only means something on the instance that assigned it.
+type Bus interface {
+	// Publish sends an event to every instance; it must not block on the network
+	Publish(msg Message) error
+	// Subscribe registers a handler for events from all instances
+	Subscribe(handler func(Message))
+	Close() error
+}
+
+var (
+	bus   Bus = subscribed(NewMemoryBus())
+	busMu sync.RWMutex
+)
+
+// UseBus switches the hub to another bus, closing the previous one. Call it
+// before serving connections, e.g. with a PostgresBus when running several instances.
+func UseBus(b Bus) {
+	busMu.Lock()
+	previous := bus
+	bus = subscribed(b)
+	busMu.Unlock()
+
+	if err := previous.Close(); err != nil {
+		log.Printf("Warning: error closing websocket bus: %v", err)
+	}
+}
+
+// subscribed connects a bus to this instance's clients
+func subscribed(b Bus) Bus {
+	b.Subscribe(receive)
+	return b
+}
+
+// instanceTopic carries commands between backend instances, e.g. a skip for
+// the instance running playout. Its messages never reach clients.
+const instanceTopic = "instance"
+
+// InstanceCommandHandler runs a command sent by any instance, with its data as JSON
+type InstanceCommandHandler func(data json.RawMessage)
+
+var (
+	instanceHandlers   = make(map[string]InstanceCommandHandler)
+	instanceHandlersMu sync.RWMutex
+)
+
+// OnInstanceCommand registers the handler for an instance command. Every
+// instance (the sender included) receives each command, so handlers for work
+// only one instance does check that they are that instance.
+func OnInstanceCommand(command string, handler InstanceCommandHandler) {
+	instanceHandlersMu.Lock()
+	instanceHandlers[command] = handler
+	instanceHandlersMu.Unlock()
+}
+
+// SendInstanceCommand sends a command through the bus to every instance
+func SendInstanceCommand(command string, data interface{}) {
+	publish(Message{Type: command, Topic: instanceTopic, Data: data})
+}
+
+// commandUnsubscribe drops a topic from connections on every instance
+const commandUnsubscribe = "unsubscribe"
+
+// unsubscribeCommand names the topic to drop and whose connections lose it (0 for everyone's)
+type unsubscribeCommand struct {
+	Topic  string `json:"topic"`
+	UserID int    `json:"user_id,omitempty"`
+}
+
+// UnsubscribeUser drops a topic from a user's connections on every
+// instance, e.g. once they leave a private room
+func UnsubscribeUser(userID int, topic string) {
+	SendInstanceCommand(commandUnsubscribe, unsubscribeCommand{Topic: topic, UserID: userID})
+}
+
+// CloseTopic drops a topic from every connection on every instance
+func CloseTopic(topic string) {
+	SendInstanceCommand(commandUnsubscribe, unsubscribeCommand{Topic: topic})
+}
+
+// runInstanceCommand hands a command to its handler, in its own goroutine so
+// a slow handler doesn't hold up the events behind it. Unsubscribing runs in
+// line instead, so events sent before it still reach the connections.
+func runInstanceCommand(msg Message) {
+	instanceHandlersMu.RLock()
+	handler := instanceHandlers[msg.Type]
+	instanceHandlersMu.RUnlock()
+	if handler == nil && msg.Type != commandUnsubscribe {
+		return
+	}
+
+	// The memory bus hands over the value as published, Postgres its JSON
+	data, ok := msg.Data.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(msg.Data); err != nil {
+			log.Printf("Error encoding %s instance command: %v", msg.Type, err)
+			return
+		}
+	}
+
+	if msg.Type == commandUnsubscribe {
+		var cmd unsubscribeCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			log.Printf("Invalid unsubscribe command: %v", err)
+			return
+		}
+		unsubscribeLocal(cmd)
+		return
+	}
+	go handler(data)
+}
+
+// unsubscribeLocal drops a topic from this instance's matching connections
+func unsubscribeLocal(cmd unsubscribeCommand) {
+	mutex.RLock()
+	targets := []*client{}
+	for c := range clients {
+		if c.subscribed(cmd.Topic) && (cmd.UserID == 0 || c.user().UserID == cmd.UserID) {
+			targets = append(targets, c)
+		}
+	}
+	mutex.RUnlock()
+
+	for _, c := range targets {
+		c.unsubscribe([]string{cmd.Topic})
+	}
+}
+
+// receive queues an event from the bus for HandleMessages without blocking;
+// if the buffer is full the event is dropped and counted
+func receive(msg Message) {
+	select {
+	case broadcast <- msg:
+	default:
+		metrics.broadcastDropped.Add(1)
+		log.Printf("Warning: websocket broadcast buffer full, dropping %s message", msg.Type)
+	}
+}
+
+// MemoryBus delivers events within one process. It is the default for a
+// single instance and stands in for a real bus in tests.
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers []func(Message)
+	closed   bool
+}
+
+// NewMemoryBus creates an in-process bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Publish hands the event to every subscriber
+func (b *MemoryBus) Publish(msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errBusClosed
+	}
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for published events
+func (b *MemoryBus) Subscribe(handler func(Message)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// Close stops delivering events
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.handlers = nil
+	b.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMemoryBus(t *testing.T) {
+	tests := []struct {
+		name        string
+		subscribers int
+		publish     []string // message types, in order
+		closeFirst  bool
+		wantErr     error
+	}{
+		{"no subscribers", 0, []string{"a"}, false, nil},
+		{"one subscriber", 1, []string{"a", "b", "c"}, false, nil},
+		{"every subscriber gets every event", 3, []string{"a", "b"}, false, nil},
+		{"closed bus", 2, []string{"a"}, true, errBusClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBus()
+			received := make([][]string, tt.subscribers)
+			for i := range received {
+				received[i] = []string{}
+				b.Subscribe(func(msg Message) { received[i] = append(received[i], msg.Type) })
+			}
+			if tt.closeFirst {
+				b.Close()
+			}
+
+			for _, msgType := range tt.publish {
+				if err := b.Publish(Message{Type: msgType, Topic: StationTopic(1)}); err != tt.wantErr {
+					t.Fatalf("publishing %s: got error %v, want %v", msgType, err, tt.wantErr)
+				}
+			}
+
+			want := tt.publish
+			if tt.wantErr != nil {
+				want = []string{}
+			}
+			for i, got := range received {
+				if !slices.Equal(got, want) {
+					t.Errorf("subscriber %d got %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryBusLeavesNumberingToReceivers(t *testing.T) {
+	b := NewMemoryBus()
+	var got Message
+	b.Subscribe(func(msg Message) { got = msg })
+
+	data := map[string]int{"station_id": 1}
+	if err := b.Publish(Message{Type: EventQueueUpdated, Topic: StationTopic(1), Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Seq != 0 {
+		t.Errorf("bus numbered the event %d; instances number events as they receive them", got.Seq)
+	}
+	if got.Type != EventQueueUpdated || got.Topic != StationTopic(1) || got.Data == nil {
+		t.Errorf("event changed in transit: %+v", got)
+	}
+}
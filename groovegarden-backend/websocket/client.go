@@ -0,0 +1,424 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single write may take before the client is dropped
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent (no pong or message) before it is dropped
+	pongWait = 60 * time.Second
+	// pingPeriod is how often clients are pinged; it must be shorter than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize limits messages read from clients
+	maxMessageSize = 4096
+	// defaultSendQueue is how many messages can wait for a client before it counts as slow
+	defaultSendQueue = 64
+)
+
+// Slow consumer policies, chosen with WS_SLOW_CONSUMER
+const (
+	// PolicyDisconnect closes a client whose queue is full; it reconnects and refetches state
+	PolicyDisconnect = "disconnect"
+	// PolicyDrop skips messages for a client whose queue is full
+	PolicyDrop = "drop"
+)
+
+var (
+	sendQueueSize      = envInt("WS_SEND_QUEUE", defaultSendQueue)
+	slowConsumerPolicy = slowConsumerFromEnv()
+)
+
+// client is a connection with the topics it subscribed to (none receives every public event).
+// Messages wait in send until the client's writer goroutine delivers them.
+// Server-Sent Events streams are clients without a websocket conn.
+type client struct {
+	conn     *websocket.Conn
+	listener Listener
+
+	mu       sync.RWMutex
+	identity Identity // Zero until the client authenticates
+	topics   map[string]bool
+
+	present   map[int]bool // Stations counted as presentAs listening to them
+	presentAs int
+
+	send      chan *frame
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// user returns who the client authenticated as, or a zero Identity
+func (c *client) user() Identity {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.identity
+}
+
+func (c *client) setUser(identity Identity) {
+	c.mu.Lock()
+	c.identity = identity
+	c.mu.Unlock()
+	c.updatePresence()
+}
+
+// wants reports whether a message on topic should reach this client
+func (c *client) wants(topic string) bool {
+	if topic == "" {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	kind, id, _ := parseTopic(topic)
+	if kind == "user" && id == c.identity.UserID {
+		return true
+	}
+	if c.topics[topic] {
+		return true
+	}
+	if len(c.topics) != 0 || kind == "user" {
+		return false
+	}
+	// Clients that never subscribed get every public event, as before topics existed
+	_, private := privateTopic(kind)
+	return !private
+}
+
+// subscribed reports whether the client explicitly follows a topic
+func (c *client) subscribed(topic string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.topics[topic]
+}
+
+// subscriptions lists the client's topics
+func (c *client) subscriptions() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// subscribe adds topics, checking that user topics belong to the client
+// (admins may follow anyone's) and private topics let the client in
+func (c *client) subscribe(topics []string) error {
+	// Authorizers may hit the database, so don't hold the lock fan-out needs
+	identity := c.user()
+	for _, topic := range topics {
+		kind, id, ok := parseTopic(topic)
+		if !ok {
+			return NewCommandError(ErrCodeBadRequest, fmt.Sprintf("unknown topic %q", topic))
+		}
+		if kind == "user" && id != identity.UserID && identity.Role != "admin" {
+			return NewCommandError(ErrCodeForbidden, fmt.Sprintf("not allowed to subscribe to %s", topic))
+		}
+		if authorize, private := privateTopic(kind); private {
+			allowed := false
+			if authorize != nil && identity.UserID != 0 {
+				var err error
+				if allowed, err = authorize(identity, id); err != nil {
+					return err
+				}
+			}
+			if !allowed {
+				return NewCommandError(ErrCodeForbidden, fmt.Sprintf("not allowed to subscribe to %s", topic))
+			}
+		}
+	}
+
+	defer c.updatePresence() // Runs once the lock below is released
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		if !c.topics[topic] && len(c.topics) >= maxSubscriptions {
+			return NewCommandError(ErrCodeBadRequest, fmt.Sprintf("at most %d subscriptions", maxSubscriptions))
+		}
+		c.topics[topic] = true
+	}
+	return nil
+}
+
+func (c *client) unsubscribe(topics []string) {
+	c.mu.Lock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+	c.mu.Unlock()
+	c.updatePresence()
+}
+
+// reply queues a message for this client alone
+func (c *client) reply(msg Message) {
+	f, err := prepare(msg)
+	if err != nil {
+		log.Printf("Error preparing %s message: %v", msg.Type, err)
+		return
+	}
+	c.enqueue(f)
+}
+
+// replyError answers a command with an error, keeping internal details in the log
+func (c *client) replyError(id string, err error) {
+	cmdErr, ok := err.(*CommandError)
+	if !ok {
+		log.Printf("WebSocket command %s failed: %v", id, err)
+		cmdErr = NewCommandError(ErrCodeInternal, "Something went wrong")
+	}
+	c.reply(Message{Type: EventError, ID: id, Data: cmdErr})
+}
+
+func newClient(conn *websocket.Conn, listener Listener) *client {
+	return &client{
+		conn:     conn,
+		listener: listener,
+		topics:   make(map[string]bool),
+		send:     make(chan *frame, sendQueueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// enqueue hands a message to the client without blocking, applying the slow
+// consumer policy when its queue is full
+func (c *client) enqueue(f *frame) {
+	select {
+	case c.send <- f:
+		return
+	case <-c.done:
+		return
+	default:
+	}
+
+	if slowConsumerPolicy == PolicyDrop {
+		metrics.dropped.Add(1)
+		return
+	}
+	metrics.slowDisconnects.Add(1)
+	log.Printf("WebSocket client %s is too slow (%d queued), disconnecting", c.listener.Key, len(c.send))
+	c.close()
+}
+
+// close stops the writer and closes the connection, which ends the reader;
+// it is safe to call more than once and from any goroutine
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.updatePresence()
+	})
+}
+
+// writePump delivers queued messages and keeps the connection alive with pings
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close()
+	}()
+
+	for {
+		select {
+		case f := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WritePreparedMessage(f.prepared); err != nil {
+				return
+			}
+			metrics.sent.Add(1)
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// clientMessage is a command sent by a client
+type clientMessage struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Data    json.RawMessage `json:"data"`
+
+	received time.Time // When the server read it, for time_sync
+}
+
+// readPump reads and runs the client's commands until it goes away, which
+// also processes pongs and close frames
+func (c *client) readPump() error {
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		msg := clientMessage{received: time.Now()}
+		if err := json.Unmarshal(payload, &msg); err != nil || msg.Type == "" {
+			c.replyError("", NewCommandError(ErrCodeBadRequest, "Invalid message"))
+			continue
+		}
+		if msg.Version > ProtocolVersion {
+			c.replyError(msg.ID, NewCommandError(ErrCodeBadRequest, fmt.Sprintf("unsupported protocol version %d", msg.Version)))
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+// handle runs one client command and replies to it
+func (c *client) handle(msg clientMessage) {
+	switch msg.Type {
+	case "auth":
+		c.authenticate(msg)
+		return
+	case "resume":
+		c.resume(msg)
+		return
+	case "time_sync":
+		c.timeSync(msg)
+		return
+	case "subscribe", "unsubscribe":
+		var req struct {
+			Topics []string `json:"topics"`
+		}
+		if err := json.Unmarshal(msg.Data, &req); err != nil || len(req.Topics) == 0 {
+			c.replyError(msg.ID, NewCommandError(ErrCodeBadRequest, "topics are required"))
+			return
+		}
+		if msg.Type == "subscribe" {
+			if err := c.subscribe(req.Topics); err != nil {
+				c.replyError(msg.ID, err)
+				return
+			}
+		} else {
+			c.unsubscribe(req.Topics)
+		}
+		c.reply(Message{Type: EventAck, ID: msg.ID, Data: map[string][]string{"topics": c.subscriptions()}})
+		return
+	}
+
+	handler := commandHandler(msg.Type)
+	if handler == nil {
+		c.replyError(msg.ID, NewCommandError(ErrCodeUnknownCommand, fmt.Sprintf("unknown command %q", msg.Type)))
+		return
+	}
+	user := c.user()
+	if user.UserID == 0 {
+		c.replyError(msg.ID, NewCommandError(ErrCodeUnauthorized, "authenticate first"))
+		return
+	}
+	result, err := handler(user, msg.Data)
+	if err != nil {
+		c.replyError(msg.ID, err)
+		return
+	}
+	c.reply(Message{Type: EventAck, ID: msg.ID, Data: result})
+}
+
+// resume replays the events a reconnecting client missed since last_seq, for
+// the topics it follows now. A client that was connected to another instance
+// (or to this one before a restart) gets snapshot_required. Live events may arrive interleaved with the
+// replay, so clients drop any seq they have already applied.
+func (c *client) resume(msg clientMessage) {
+	var req struct {
+		Epoch   string `json:"epoch"`
+		LastSeq int64  `json:"last_seq"`
+	}
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.Epoch == "" || req.LastSeq <= 0 {
+		c.replyError(msg.ID, NewCommandError(ErrCodeBadRequest, "epoch and last_seq are required"))
+		return
+	}
+
+	events, ok := replayEvents(req.Epoch, req.LastSeq, c.wants)
+	// A replay that can't fit in the send queue would trip the slow consumer policy
+	if !ok || len(events) > cap(c.send)-len(c.send)-1 {
+		c.replyError(msg.ID, NewCommandError(ErrCodeSnapshotRequired, "Too many events were missed, refetch the current state"))
+		return
+	}
+	for _, e := range events {
+		c.enqueue(e.frame)
+	}
+	c.reply(Message{Type: EventAck, ID: msg.ID, Data: map[string]interface{}{
+		"replayed": len(events),
+		"epoch":    epoch,
+		"last_seq": LastSeq(),
+	}})
+}
+
+// timeSync answers a clock sync probe with the server's receive and send times
+func (c *client) timeSync(msg clientMessage) {
+	var req struct {
+		ClientTime int64 `json:"client_time"`
+	}
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.ClientTime <= 0 {
+		c.replyError(msg.ID, NewCommandError(ErrCodeBadRequest, "client_time is required"))
+		return
+	}
+	c.reply(Message{Type: EventAck, ID: msg.ID, Data: TimeSync{
+		ClientTime:     req.ClientTime,
+		ServerReceived: msg.received.UnixMilli(),
+		ServerSent:     time.Now().UnixMilli(),
+	}})
+}
+
+// authenticate handles an auth message; a bad token closes the connection
+func (c *client) authenticate(msg clientMessage) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(msg.Data, &req)
+
+	identity, err := identityFromToken(req.Token)
+	if err != nil {
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Invalid or expired token"),
+			time.Now().Add(writeWait))
+		c.close()
+		return
+	}
+	c.setUser(identity)
+	c.reply(Message{Type: EventAuthenticated, ID: msg.ID, Data: identity})
+}
+
+func envInt(name string, def int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return def
+}
+
+func slowConsumerFromEnv() string {
+	switch policy := os.Getenv("WS_SLOW_CONSUMER"); policy {
+	case PolicyDrop, PolicyDisconnect:
+		return policy
+	case "":
+		return PolicyDisconnect
+	default:
+		log.Printf("Warning: unknown WS_SLOW_CONSUMER %q, using %q", policy, PolicyDisconnect)
+		return PolicyDisconnect
+	}
+}
@@ -0,0 +1,190 @@
+package websocket
+
+import (
+	"groovegarden/models"
+)
+
+// Server events, by topic, with their payload type
+const (
+	// Sent to each connection when it opens: Hello
+	EventHello = "hello"
+	// Reply to an auth message: Identity
+	EventAuthenticated = "authenticated"
+	// Replies to commands, echoing the command's id: the command's result, or a CommandError
+	EventAck   = "ack"
+	EventError = "error"
+
+	// station:{id}
+	EventNowPlaying       = "now_playing"        // models.NowPlaying
+	EventVoteCast         = "vote_cast"          // VoteCast (song:{id} carries models.Song for legacy votes)
+	EventVoteRoundStarted = "vote_round_started" // VoteRoundStarted
+	EventSkipVote         = "skip_vote"          // SkipVote
+	EventTrackSkipped     = "track_skipped"      // TrackSkipped
+	EventQueueUpdated     = "queue_updated"      // StationRef
+	EventScheduleUpdated  = "schedule_updated"   // StationRef
+	EventProgrammeChanged = "programme_changed"  // ProgrammeChanged
+	EventJinglePlaying    = "jingle_playing"     // JinglePlaying
+	EventLiveEnded        = "live_ended"         // LiveEnded
+	EventListenersUpdated = "listeners_updated"  // models.ListenerCount
+	EventStationUpdated   = "station_updated"    // models.Station
+	EventStationStatus    = "station_status"     // StationStatus
+	EventStationDeleted   = "station_deleted"    // Deleted
+	EventRequestApproved  = "request_approved"   // RequestDecision
+	EventRequestRejected  = "request_rejected"   // RequestDecision
+	EventDedication       = "dedication"         // Dedication
+	EventChatMessage      = "chat_message"       // models.ChatMessage
+	EventChatDeleted      = "chat_deleted"       // ChatDeleted
+	EventPresenceJoin     = "presence_join"      // Presence
+	EventPresenceLeave    = "presence_leave"     // Presence
+	EventReactions        = "reactions"          // Reactions
+
+	// song:{id}
+	EventSongUpdated       = "song_updated"        // models.Song
+	EventSongAudioReplaced = "song_audio_replaced" // models.Song
+	EventSongDeleted       = "song_deleted"        // Deleted
+
+	// user:{id}
+	EventYourRequestApproved = "your_request_approved" // models.SongRequest
+	EventYourRequestRejected = "your_request_rejected" // models.SongRequest
+	EventYourRequestUpNext   = "your_request_up_next"  // RequestUpNext
+	EventYourRequestPlaying  = "your_request_playing"  // Dedication
+	EventYourChatRestricted  = "your_chat_restricted"  // models.ChatRestriction
+
+	// party:{id}
+	EventPartyState        = "party_state"         // models.PartyState
+	EventPartyMemberJoined = "party_member_joined" // models.PartyMember
+	EventPartyMemberLeft   = "party_member_left"   // models.PartyMember
+	EventPartyEnded        = "party_ended"         // Deleted
+
+	// Untopiced
+	EventReleaseCreated = "release_created" // models.Release
+)
+
+// TimeSync answers a time_sync command; times are Unix milliseconds
+type TimeSync struct {
+	ClientTime     int64 `json:"client_time"`     // Echoed from the command
+	ServerReceived int64 `json:"server_received"` // When the server read the command
+	ServerSent     int64 `json:"server_sent"`     // When the server answered
+}
+
+// Hello greets a new connection with the protocol it speaks and its state
+type Hello struct {
+	Version int       `json:"version"`
+	Topics  []string  `json:"topics"`
+	User    *Identity `json:"user,omitempty"`
+	Epoch   string    `json:"epoch"` // Resume with this and last_seq after a reconnect
+	LastSeq int64     `json:"last_seq"`
+}
+
+// StationRef tells listeners to refetch something about a station
+type StationRef struct {
+	StationID int `json:"station_id"`
+}
+
+// Deleted names a removed station or song, or an ended party
+type Deleted struct {
+	ID int `json:"id"`
+}
+
+// StationStatus is a station going on or off air
+type StationStatus struct {
+	StationID int    `json:"station_id"`
+	Status    string `json:"status"`
+}
+
+// VoteCast is a song's new tally in a station's current round
+type VoteCast struct {
+	StationID int `json:"station_id"`
+	SongID    int `json:"song_id"`
+	Round     int `json:"round"`
+	Votes     int `json:"votes"`
+}
+
+// VoteRoundStarted opens a new vote round as a track goes on air
+type VoteRoundStarted struct {
+	StationID int `json:"station_id"`
+	Round     int `json:"round"`
+}
+
+// SkipVote is a listener voting the song on air off
+type SkipVote struct {
+	StationID int `json:"station_id"`
+	PlayID    int `json:"play_id"`
+	SongID    int `json:"song_id"`
+	Votes     int `json:"votes"`
+	Needed    int `json:"needed"`
+}
+
+// TrackSkipped is the song on air being faded out by listener votes
+type TrackSkipped struct {
+	StationID int `json:"station_id"`
+	PlayID    int `json:"play_id"`
+	SongID    int `json:"song_id"`
+	Votes     int `json:"votes"`
+}
+
+// ProgrammeChanged is a schedule slot starting or ending; Slot is nil outside the schedule
+type ProgrammeChanged struct {
+	StationID int                        `json:"station_id"`
+	Slot      *models.ScheduleOccurrence `json:"slot"`
+}
+
+// JinglePlaying is a jingle inserted between songs
+type JinglePlaying struct {
+	StationID int           `json:"station_id"`
+	Jingle    models.Jingle `json:"jingle"`
+}
+
+// LiveEnded is a live session handing back to the rotation
+type LiveEnded struct {
+	StationID int    `json:"station_id"`
+	ArtistID  int    `json:"artist_id"`
+	Reason    string `json:"reason"`
+}
+
+// RequestDecision is a moderator approving or rejecting a song request
+type RequestDecision struct {
+	StationID int `json:"station_id"`
+	RequestID int `json:"request_id"`
+	SongID    int `json:"song_id"`
+	UserID    int `json:"user_id"`
+}
+
+// RequestUpNext tells a listener their request plays after the current track
+type RequestUpNext struct {
+	StationID int `json:"station_id"`
+	RequestID int `json:"request_id"`
+	SongID    int `json:"song_id"`
+}
+
+// Dedication is a requested song going on air, with the requester's message
+type Dedication struct {
+	RequestID  int    `json:"request_id"`
+	StationID  int    `json:"station_id"`
+	SongID     int    `json:"song_id"`
+	UserID     int    `json:"user_id"`
+	UserName   string `json:"user_name"`
+	Dedication string `json:"dedication"`
+}
+
+// ChatDeleted lists chat messages removed by a moderator
+type ChatDeleted struct {
+	StationID  int     `json:"station_id"`
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+// Presence is a signed-in listener tuning in to or leaving a station. Users
+// who hide their presence are not announced.
+type Presence struct {
+	StationID int    `json:"station_id"`
+	UserID    int    `json:"user_id"`
+	UserName  string `json:"user_name"`
+}
+
+// Reactions are the reactions to the song on air since the last batch
+type Reactions struct {
+	StationID int            `json:"station_id"`
+	PlayID    int            `json:"play_id"`
+	SongID    int            `json:"song_id"`
+	Counts    map[string]int `json:"counts"` // By reaction, e.g. "fire"
+}
@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"sync/atomic"
+)
+
+// metrics counts hub activity since the server started
+var metrics struct {
+	sent             atomic.Int64 // Messages written to clients
+	dropped          atomic.Int64 // Messages skipped for slow clients (drop policy)
+	slowDisconnects  atomic.Int64 // Clients closed for being slow (disconnect policy)
+	broadcastDropped atomic.Int64 // Events lost because the broadcast buffer was full
+}
+
+// Metrics is a snapshot of the hub's connections and queues
+type Metrics struct {
+	Clients          int    `json:"clients"`
+	QueueCapacity    int    `json:"queue_capacity"`    // Per client
+	QueuedMessages   int    `json:"queued_messages"`   // Across all clients
+	MaxQueueDepth    int    `json:"max_queue_depth"`   // Deepest single client queue
+	BroadcastPending int    `json:"broadcast_pending"` // Events waiting to be fanned out
+	SlowPolicy       string `json:"slow_consumer_policy"`
+	Sent             int64  `json:"sent"`
+	Dropped          int64  `json:"dropped"`
+	SlowDisconnects  int64  `json:"slow_disconnects"`
+	BroadcastDropped int64  `json:"broadcast_dropped"`
+}
+
+// Stats reports current queue depths and the hub's counters
+func Stats() Metrics {
+	m := Metrics{
+		QueueCapacity:    sendQueueSize,
+		BroadcastPending: len(broadcast),
+		SlowPolicy:       slowConsumerPolicy,
+		Sent:             metrics.sent.Load(),
+		Dropped:          metrics.dropped.Load(),
+		SlowDisconnects:  metrics.slowDisconnects.Load(),
+		BroadcastDropped: metrics.broadcastDropped.Load(),
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+	m.Clients = len(clients)
+	for c := range clients {
+		depth := len(c.send)
+		m.QueuedMessages += depth
+		if depth > m.MaxQueueDepth {
+			m.MaxQueueDepth = depth
+		}
+	}
+	return m
+}
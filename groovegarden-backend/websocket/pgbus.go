@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// notifyPayloadLimit keeps NOTIFY payloads under Postgres' 8000 byte limit;
+	// larger events go through the bus_events table
+	notifyPayloadLimit = 7900
+	// busOutboxSize is how many events can wait to be sent to Postgres
+	busOutboxSize = 1024
+	// busEventRetention is how long oversized events are kept for instances to fetch
+	busEventRetention = 5 * time.Minute
+	// listenerPingInterval checks the LISTEN connection when no events arrive
+	listenerPingInterval = 90 * time.Second
+)
+
+var (
+	errBusClosed = errors.New("bus is closed")
+	errBusFull   = errors.New("bus outbox is full")
+)
+
+// busEnvelope is a NOTIFY payload: an event, or a reference to an oversized one
+type busEnvelope struct {
+	Ref   int64           `json:"ref,omitempty"`
+	Type  string          `json:"type,omitempty"`
+	Topic string          `json:"topic,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// PostgresBus shares events between instances with LISTEN/NOTIFY on one channel
+type PostgresBus struct {
+	db       *sql.DB
+	channel  string
+	listener *pq.Listener
+	outbox   chan busEnvelope
+
+	mu       sync.RWMutex
+	handlers []func(Message)
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewPostgresBus listens on channel with a dedicated connection (connInfo)
+// and publishes through db
+func NewPostgresBus(db *sql.DB, connInfo string, channel string) (*PostgresBus, error) {
+	b := &PostgresBus{
+		db:      db,
+		channel: channel,
+		outbox:  make(chan busEnvelope, busOutboxSize),
+		done:    make(chan struct{}),
+	}
+	b.listener = pq.NewListener(connInfo, 10*time.Second, time.Minute, b.listenerEvent)
+	if err := b.listener.Listen(channel); err != nil {
+		b.listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	b.wg.Add(2)
+	go b.sendLoop()
+	go b.receiveLoop()
+	return b, nil
+}
+
+// Publish queues an event for NOTIFY without waiting on the database
+func (b *PostgresBus) Publish(msg Message) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-b.done:
+		return errBusClosed
+	default:
+	}
+	select {
+	case b.outbox <- busEnvelope{Type: msg.Type, Topic: msg.Topic, Data: data}:
+		return nil
+	default:
+		return errBusFull
+	}
+}
+
+// Subscribe registers a handler for events from every instance
+func (b *PostgresBus) Subscribe(handler func(Message)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// Close stops listening and drops events still waiting to be sent
+func (b *PostgresBus) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		err = b.listener.Close()
+		b.wg.Wait()
+	})
+	return err
+}
+
+func (b *PostgresBus) sendLoop() {
+	defer b.wg.Done()
+	for {
+		select {
+		case env := <-b.outbox:
+			if err := b.send(env); err != nil {
+				metrics.broadcastDropped.Add(1)
+				log.Printf("Warning: could not send websocket event to Postgres: %v", err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// send notifies the channel of an event, storing oversized events and
+// sending their ID instead
+func (b *PostgresBus) send(env busEnvelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > notifyPayloadLimit {
+		var id int64
+		if err := b.db.QueryRow("INSERT INTO bus_events (payload) VALUES ($1) RETURNING id", string(payload)).Scan(&id); err != nil {
+			return err
+		}
+		if _, err := b.db.Exec("DELETE FROM bus_events WHERE created_at < $1", time.Now().Add(-busEventRetention)); err != nil {
+			log.Printf("Warning: could not prune bus_events: %v", err)
+		}
+		ref, _ := json.Marshal(busEnvelope{Ref: id})
+		payload = ref
+	}
+	_, err = b.db.Exec("SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+func (b *PostgresBus) receiveLoop() {
+	defer b.wg.Done()
+	for {
+		select {
+		case n := <-b.listener.Notify:
+			// nil follows a reconnect; events sent while disconnected are lost
+			if n != nil {
+				b.deliver(n.Extra)
+			}
+		case <-time.After(listenerPingInterval):
+			go b.listener.Ping()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// deliver decodes a NOTIFY payload and hands the event to the subscribers
+func (b *PostgresBus) deliver(payload string) {
+	var env busEnvelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil {
+		log.Printf("Warning: invalid websocket event from Postgres: %v", err)
+		return
+	}
+	if env.Ref != 0 {
+		var stored string
+		if err := b.db.QueryRow("SELECT payload FROM bus_events WHERE id = $1", env.Ref).Scan(&stored); err != nil {
+			log.Printf("Warning: could not load websocket event %d: %v", env.Ref, err)
+			return
+		}
+		env = busEnvelope{}
+		if err := json.Unmarshal([]byte(stored), &env); err != nil {
+			log.Printf("Warning: invalid stored websocket event: %v", err)
+			return
+		}
+	}
+
+	msg := Message{Type: env.Type, Topic: env.Topic, Data: env.Data}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+}
+
+func (b *PostgresBus) listenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		log.Printf("Warning: websocket bus lost its Postgres connection: %v", err)
+	case pq.ListenerEventReconnected:
+		log.Printf("Websocket bus reconnected to Postgres")
+	case pq.ListenerEventConnectionAttemptFailed:
+		log.Printf("Warning: websocket bus could not reconnect to Postgres: %v", err)
+	}
+}
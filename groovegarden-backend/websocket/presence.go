@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// presenceGrace is how long a user's last connection to a station may be
+// gone before they count as having left, so reconnects don't flap
+const presenceGrace = 15 * time.Second
+
+// PresenceHandler is told when an authenticated user tunes in to a station
+// (their first connection subscribing to it) and when they have left (their
+// last connection has been gone for presenceGrace). Calls come one at a time,
+// in order.
+type PresenceHandler func(stationID, userID int, joined bool)
+
+type presenceKey struct {
+	stationID int
+	userID    int
+}
+
+type presenceChange struct {
+	presenceKey
+	joined bool
+}
+
+var presence = struct {
+	sync.Mutex
+	conns   map[presenceKey]int // Open connections per user and station
+	leaving map[presenceKey]*time.Timer
+	pending []presenceChange // Waiting for the handler, which may be slow
+	wake    chan struct{}
+}{
+	conns:   make(map[presenceKey]int),
+	leaving: make(map[presenceKey]*time.Timer),
+	wake:    make(chan struct{}, 1),
+}
+
+// OnPresence starts passing presence changes to a handler
+func OnPresence(handler PresenceHandler) {
+	go func() {
+		for range presence.wake {
+			presence.Lock()
+			changes := presence.pending
+			presence.pending = nil
+			presence.Unlock()
+
+			for _, change := range changes {
+				handler(change.stationID, change.userID, change.joined)
+			}
+		}
+	}()
+}
+
+// PresentUsers lists the users tuned in to each station through this instance
+func PresentUsers() map[int][]int {
+	presence.Lock()
+	defer presence.Unlock()
+
+	users := make(map[int][]int)
+	for key := range presence.conns {
+		users[key.stationID] = append(users[key.stationID], key.userID)
+	}
+	return users
+}
+
+// queuePresence hands a change to the handler; the caller holds the lock
+func queuePresence(change presenceChange) {
+	presence.pending = append(presence.pending, change)
+	select {
+	case presence.wake <- struct{}{}:
+	default:
+	}
+}
+
+func presenceJoin(key presenceKey) {
+	presence.Lock()
+	defer presence.Unlock()
+
+	presence.conns[key]++
+	if timer, ok := presence.leaving[key]; ok {
+		// Back within the grace period, so they never left
+		timer.Stop()
+		delete(presence.leaving, key)
+		return
+	}
+	if presence.conns[key] == 1 {
+		queuePresence(presenceChange{key, true})
+	}
+}
+
+func presenceLeave(key presenceKey) {
+	presence.Lock()
+	defer presence.Unlock()
+
+	if presence.conns[key] == 0 {
+		return
+	}
+	presence.conns[key]--
+	if presence.conns[key] > 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(presenceGrace, func() {
+		presence.Lock()
+		defer presence.Unlock()
+		// A rejoin stops the timer, but it may already have fired
+		if presence.leaving[key] != timer {
+			return
+		}
+		delete(presence.leaving, key)
+		delete(presence.conns, key)
+		queuePresence(presenceChange{key, false})
+	})
+	presence.leaving[key] = timer
+}
+
+// updatePresence brings the stations a client counts as present on in line
+// with its identity and subscriptions; closed clients are present nowhere
+func (c *client) updatePresence() {
+	c.mu.Lock()
+	userID := c.identity.UserID
+	stations := make(map[int]bool)
+	select {
+	case <-c.done:
+	default:
+		if userID != 0 {
+			for topic := range c.topics {
+				if id, ok := strings.CutPrefix(topic, "station:"); ok {
+					stationID, _ := strconv.Atoi(id)
+					stations[stationID] = true
+				}
+			}
+		}
+	}
+
+	var left, joined []presenceKey
+	for stationID := range c.present {
+		if !stations[stationID] || userID != c.presentAs {
+			left = append(left, presenceKey{stationID, c.presentAs})
+		}
+	}
+	for stationID := range stations {
+		if !c.present[stationID] || userID != c.presentAs {
+			joined = append(joined, presenceKey{stationID, userID})
+		}
+	}
+	c.present = stations
+	c.presentAs = userID
+	c.mu.Unlock()
+
+	for _, key := range left {
+		presenceLeave(key)
+	}
+	for _, key := range joined {
+		presenceJoin(key)
+	}
+}
@@ -0,0 +1,170 @@
+// Package websocket is the realtime hub behind /ws.
+//
+// Protocol version 1: every frame in either direction is a JSON object
+//
+//	{"v": 1, "type": "...", "topic": "...", "id": "...", "data": {...}}
+//
+// Clients subscribe to topics (station:{id}, song:{id}, user:{id}, party:{id})
+// and only receive events for those, plus untopiced announcements; a client
+// with no subscriptions receives every public event. Events for user:{id}
+// always reach that user's authenticated connections; party:{id} is only open
+// to the party's members, and a member's connections are unsubscribed when
+// they leave or the party ends. Server events and their payloads are listed
+// in events.go.
+//
+// Clients send commands with an optional request "id", answered by an "ack"
+// (with the command's result as data) or an "error" ({"code", "message"})
+// carrying the same id:
+//
+//	auth        {"token": "<jwt>"}
+//	subscribe   {"topics": ["station:1", "song:42"]}
+//	unsubscribe {"topics": ["song:42"]}
+//	resume      {"epoch": "...", "last_seq": 1234}
+//	time_sync   {"client_time": <unix ms>}
+//
+// and the commands registered with HandleCommand, which need an authenticated
+// connection (vote, skip_vote, chat, react and party_control).
+//
+// Broadcast events carry an increasing "seq". Each backend instance numbers
+// events in the order it received them, so seqs only compare within one
+// instance's epoch, given in hello. After reconnecting (and re-subscribing),
+// a client sends resume with that epoch and the last seq it applied and gets
+// the events it missed before the ack, or a snapshot_required error when the
+// server no longer has them all, or the epoch is another instance's, and the
+// client must refetch its state.
+//
+// time_sync is answered straight away, without authentication, with the
+// client_time echoed back and the server's receive and send times (TimeSync),
+// NTP style: the client's clock offset is ((received - client_time) +
+// (sent - now)) / 2, the round trip (now - client_time) - (sent - received).
+//
+// The same events are available read-only as Server-Sent Events from /events
+// (see HandleEvents), with "<epoch>:<seq>" as the event id.
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProtocolVersion is sent as "v" on every server message
+const ProtocolVersion = 1
+
+// maxSubscriptions caps how many topics one connection can follow
+const maxSubscriptions = 50
+
+// Error codes sent in error replies
+const (
+	ErrCodeBadRequest     = "bad_request"
+	ErrCodeUnauthorized   = "unauthorized"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeConflict       = "conflict"
+	ErrCodeRateLimited    = "rate_limited"
+	ErrCodeUnknownCommand = "unknown_command"
+	ErrCodeInternal       = "internal"
+)
+
+// CommandError is a command failure reported to the client
+type CommandError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+// NewCommandError builds a CommandError for a command handler to return
+func NewCommandError(code string, message string) *CommandError {
+	return &CommandError{Code: code, Message: message}
+}
+
+// CommandHandler runs a client command for an authenticated user and returns
+// the ack payload. Errors other than *CommandError are logged and reported as
+// internal errors.
+type CommandHandler func(user Identity, data json.RawMessage) (interface{}, error)
+
+var (
+	commands   = make(map[string]CommandHandler)
+	commandsMu sync.RWMutex
+)
+
+// HandleCommand registers the handler for a client command
+func HandleCommand(name string, handler CommandHandler) {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	commands[name] = handler
+}
+
+func commandHandler(name string) CommandHandler {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	return commands[name]
+}
+
+// StationTopic is the topic for events belonging to one station
+func StationTopic(stationID int) string {
+	return fmt.Sprintf("station:%d", stationID)
+}
+
+// SongTopic is the topic for changes to one song
+func SongTopic(songID int) string {
+	return fmt.Sprintf("song:%d", songID)
+}
+
+// UserTopic is the topic for messages meant for one user
+func UserTopic(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// PartyTopic is the topic for a listening party's members
+func PartyTopic(partyID int) string {
+	return fmt.Sprintf("party:%d", partyID)
+}
+
+// TopicAuthorizer decides whether a user may follow a private topic
+type TopicAuthorizer func(user Identity, id int) (bool, error)
+
+var (
+	// Private topic kinds only reach subscribers their authorizer lets in
+	topicAuthorizers   = map[string]TopicAuthorizer{"party": nil}
+	topicAuthorizersMu sync.RWMutex
+)
+
+// AuthorizeTopics registers who may subscribe to a private topic kind. Until
+// one is registered, nobody can.
+func AuthorizeTopics(kind string, authorize TopicAuthorizer) {
+	topicAuthorizersMu.Lock()
+	defer topicAuthorizersMu.Unlock()
+	topicAuthorizers[kind] = authorize
+}
+
+// privateTopic reports whether a topic kind needs authorizing, and its authorizer
+func privateTopic(kind string) (TopicAuthorizer, bool) {
+	topicAuthorizersMu.RLock()
+	defer topicAuthorizersMu.RUnlock()
+	authorize, private := topicAuthorizers[kind]
+	return authorize, private
+}
+
+// parseTopic splits a topic into its kind and ID, rejecting unknown kinds
+func parseTopic(topic string) (string, int, bool) {
+	kind, id, found := strings.Cut(topic, ":")
+	if !found {
+		return "", 0, false
+	}
+	switch kind {
+	case "station", "song", "user", "party":
+	default:
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n <= 0 || strconv.Itoa(n) != id {
+		return "", 0, false
+	}
+	return kind, n, true
+}
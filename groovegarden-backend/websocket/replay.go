@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+const (
+	// replayPerTopic is how many recent events each topic keeps for resuming clients
+	replayPerTopic = 256
+	// maxReplayTopics bounds how many topics keep history; the least recently
+	// active topic is forgotten first
+	maxReplayTopics = 2000
+)
+
+// ErrCodeSnapshotRequired means a resuming client missed more than the
+// history covers and has to refetch its state
+const ErrCodeSnapshotRequired = "snapshot_required"
+
+// epoch names this instance's event numbering. Clients resume with the epoch
+// they were given, so a seq from another instance is never mistaken for one
+// of ours.
+var epoch = newEpoch()
+
+func newEpoch() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// replayEvent is a broadcast event kept for replay
+type replayEvent struct {
+	seq   int64
+	topic string
+	msg   Message
+	frame *frame
+}
+
+// ring holds a topic's latest events in sequence order
+type ring struct {
+	events  []replayEvent
+	start   int   // Index of the oldest event once the ring is full
+	evicted int64 // Highest sequence number pushed out of the ring
+	lastSeq int64
+}
+
+func (r *ring) push(e replayEvent) {
+	if len(r.events) < replayPerTopic {
+		r.events = append(r.events, e)
+	} else {
+		r.evicted = r.events[r.start].seq
+		r.events[r.start] = e
+		r.start = (r.start + 1) % replayPerTopic
+	}
+	r.lastSeq = e.seq
+}
+
+// since returns the ring's events after seq, oldest first
+func (r *ring) since(seq int64) []replayEvent {
+	events := []replayEvent{}
+	for i := range r.events {
+		e := r.events[(r.start+i)%len(r.events)]
+		if e.seq > seq {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// history is every topic's replay ring, plus the span of sequence numbers this instance has seen
+var history = struct {
+	sync.Mutex
+	rings    map[string]*ring
+	firstSeq int64 // First event this instance received; anything older is unknown here
+	lastSeq  int64
+}{rings: make(map[string]*ring)}
+
+// remember keeps a broadcast event for replay
+func remember(msg Message, f *frame) {
+	if msg.Seq == 0 {
+		return
+	}
+	history.Lock()
+	defer history.Unlock()
+
+	if history.firstSeq == 0 {
+		history.firstSeq = msg.Seq
+	}
+	if msg.Seq > history.lastSeq {
+		history.lastSeq = msg.Seq
+	}
+
+	r, ok := history.rings[msg.Topic]
+	if !ok {
+		if len(history.rings) >= maxReplayTopics {
+			forgetStalestTopic()
+		}
+		r = &ring{}
+		history.rings[msg.Topic] = r
+	}
+	r.push(replayEvent{seq: msg.Seq, topic: msg.Topic, msg: msg, frame: f})
+}
+
+// forgetStalestTopic drops the ring that went longest without an event.
+// Its events count as evicted, so resuming past them asks for a snapshot.
+func forgetStalestTopic() {
+	stalest := ""
+	var stalestSeq int64 = -1
+	for topic, r := range history.rings {
+		if stalestSeq == -1 || r.lastSeq < stalestSeq {
+			stalest, stalestSeq = topic, r.lastSeq
+		}
+	}
+	delete(history.rings, stalest)
+	if stalestSeq >= history.firstSeq {
+		history.firstSeq = stalestSeq + 1
+	}
+}
+
+// LastSeq returns the sequence number of the latest event this instance has seen
+func LastSeq() int64 {
+	history.Lock()
+	defer history.Unlock()
+	return history.lastSeq
+}
+
+// Replay returns the events after lastSeq that pass the filter, in sequence
+// order. It reports false when events after lastSeq may have been lost
+// (evicted, from before this instance started, or lastSeq is from another
+// instance's epoch), in which case the client needs a snapshot.
+func Replay(fromEpoch string, lastSeq int64, wants func(topic string) bool) ([]Message, bool) {
+	events, ok := replayEvents(fromEpoch, lastSeq, wants)
+	msgs := make([]Message, len(events))
+	for i, e := range events {
+		msgs[i] = e.msg
+	}
+	return msgs, ok
+}
+
+func replayEvents(fromEpoch string, lastSeq int64, wants func(topic string) bool) ([]replayEvent, bool) {
+	if fromEpoch != epoch {
+		return nil, false
+	}
+
+	history.Lock()
+	defer history.Unlock()
+
+	if lastSeq > history.lastSeq {
+		return nil, false
+	}
+	if lastSeq == history.lastSeq {
+		// Nothing has happened since
+		return []replayEvent{}, true
+	}
+	if lastSeq < history.firstSeq-1 {
+		return nil, false
+	}
+
+	events := []replayEvent{}
+	for topic, r := range history.rings {
+		if !wants(topic) {
+			continue
+		}
+		if r.evicted > lastSeq {
+			return nil, false
+		}
+		events = append(events, r.since(lastSeq)...)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].seq < events[j].seq })
+	return events, true
+}
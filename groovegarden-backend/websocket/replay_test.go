@@ -0,0 +1,207 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// resetHistory empties the replay history for a test and restores it after
+func resetHistory(t *testing.T) {
+	t.Helper()
+	history.Lock()
+	rings, firstSeq, lastSeq := history.rings, history.firstSeq, history.lastSeq
+	history.rings, history.firstSeq, history.lastSeq = make(map[string]*ring), 0, 0
+	history.Unlock()
+
+	t.Cleanup(func() {
+		history.Lock()
+		history.rings, history.firstSeq, history.lastSeq = rings, firstSeq, lastSeq
+		history.Unlock()
+	})
+}
+
+func seqsOf(events []replayEvent) []int64 {
+	seqs := []int64{}
+	for _, e := range events {
+		seqs = append(seqs, e.seq)
+	}
+	return seqs
+}
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		name        string
+		pushed      int // events pushed, numbered from 1
+		since       int64
+		wantFirst   int64 // first seq returned by since, 0 for none
+		wantCount   int
+		wantEvicted int64
+	}{
+		{"empty", 0, 0, 0, 0, 0},
+		{"not full", 10, 0, 1, 10, 0},
+		{"not full, since the middle", 10, 4, 5, 6, 0},
+		{"exactly full", replayPerTopic, 0, 1, replayPerTopic, 0},
+		{"wrapped once", replayPerTopic + 1, 0, 2, replayPerTopic, 1},
+		{"wrapped, since the middle", replayPerTopic + 10, replayPerTopic, replayPerTopic + 1, 10, 10},
+		{"wrapped twice", 2*replayPerTopic + 3, 0, replayPerTopic + 4, replayPerTopic, replayPerTopic + 3},
+		{"since the latest", 20, 20, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ring{}
+			for seq := int64(1); seq <= int64(tt.pushed); seq++ {
+				r.push(replayEvent{seq: seq})
+			}
+
+			got := seqsOf(r.since(tt.since))
+			if len(got) != tt.wantCount {
+				t.Fatalf("got %d events, want %d", len(got), tt.wantCount)
+			}
+			if len(got) > 0 && got[0] != tt.wantFirst {
+				t.Errorf("first event %d, want %d", got[0], tt.wantFirst)
+			}
+			if !slices.IsSorted(got) {
+				t.Errorf("events out of order: %v", got)
+			}
+			if r.evicted != tt.wantEvicted {
+				t.Errorf("evicted %d, want %d", r.evicted, tt.wantEvicted)
+			}
+			if tt.pushed > 0 && r.lastSeq != int64(tt.pushed) {
+				t.Errorf("lastSeq %d, want %d", r.lastSeq, tt.pushed)
+			}
+		})
+	}
+}
+
+func TestReplayEvents(t *testing.T) {
+	wantAll := func(string) bool { return true }
+	wantTopic := func(topic string) func(string) bool {
+		return func(other string) bool { return other == topic }
+	}
+
+	// Events 101 to 106 alternate between station:1 and station:2, then
+	// station:3 gets enough events to evict its oldest ones
+	fill := func() {
+		for seq := int64(101); seq <= 106; seq++ {
+			topic := StationTopic(1)
+			if seq%2 == 0 {
+				topic = StationTopic(2)
+			}
+			remember(Message{Seq: seq, Topic: topic}, nil)
+		}
+		for seq := int64(1001); seq < 1001+replayPerTopic+5; seq++ {
+			remember(Message{Seq: seq, Topic: StationTopic(3)}, nil)
+		}
+	}
+	last := int64(1000 + replayPerTopic + 5)
+
+	tests := []struct {
+		name    string
+		lastSeq int64
+		wants   func(string) bool
+		wantOK  bool
+		want    []int64 // nil to skip checking the events
+	}{
+		{"up to date", last, wantAll, true, []int64{}},
+		{"ahead of this instance", last + 1, wantAll, false, nil},
+		{"from before this instance started", 99, wantTopic(StationTopic(1)), false, nil},
+		{"right before the first event", 100, wantTopic(StationTopic(1)), true, []int64{101, 103, 105}},
+		{"one topic since the middle", 102, wantTopic(StationTopic(2)), true, []int64{104, 106}},
+		{"merged in sequence order", 103, func(topic string) bool { return topic != StationTopic(3) }, true, []int64{104, 105, 106}},
+		{"evicted events of a wanted topic", 1002, wantTopic(StationTopic(3)), false, nil},
+		{"evicted events of an unwanted topic", 104, wantTopic(StationTopic(1)), true, []int64{105}},
+		{"after the evictions", last - 2, wantTopic(StationTopic(3)), true, []int64{last - 1, last}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetHistory(t)
+			fill()
+
+			events, ok := replayEvents(epoch, tt.lastSeq, tt.wants)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if tt.want != nil && !slices.Equal(seqsOf(events), tt.want) {
+				t.Errorf("got events %v, want %v", seqsOf(events), tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayForgetsStalestTopic(t *testing.T) {
+	resetHistory(t)
+	for i := 0; i < maxReplayTopics+1; i++ {
+		remember(Message{Seq: int64(i + 1), Topic: fmt.Sprintf("song:%d", i)}, nil)
+	}
+
+	// song:0 was forgotten, so resuming from before it needs a snapshot
+	if _, ok := replayEvents(epoch, 0, func(string) bool { return true }); ok {
+		t.Errorf("resuming from before a forgotten topic should need a snapshot")
+	}
+	events, ok := replayEvents(epoch, 1, func(string) bool { return true })
+	if !ok || len(events) != maxReplayTopics {
+		t.Errorf("got %d events (ok %v), want %d", len(events), ok, maxReplayTopics)
+	}
+}
+
+func TestResume(t *testing.T) {
+	resetHistory(t)
+	for seq := int64(1); seq <= 3; seq++ {
+		msg := Message{Type: EventQueueUpdated, Topic: StationTopic(1), Seq: seq}
+		f, err := prepare(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remember(msg, f)
+	}
+
+	tests := []struct {
+		name     string
+		epoch    string
+		lastSeq  int64
+		wantType string
+		wantCode string  // error code, for wantType error
+		want     []int64 // seqs replayed before the reply
+	}{
+		{"same instance", epoch, 1, EventAck, "", []int64{2, 3}},
+		{"up to date", epoch, 3, EventAck, "", []int64{}},
+		{"another instance", "0123456789abcdef", 1, EventError, ErrCodeSnapshotRequired, []int64{}},
+		{"same seq on another instance", "0123456789abcdef", 3, EventError, ErrCodeSnapshotRequired, []int64{}},
+		{"no epoch", "", 1, EventError, ErrCodeBadRequest, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(nil, Listener{})
+			data, _ := json.Marshal(map[string]interface{}{"epoch": tt.epoch, "last_seq": tt.lastSeq})
+			c.resume(clientMessage{Type: "resume", ID: "1", Data: data})
+
+			var frames []*frame
+			for len(c.send) > 0 {
+				frames = append(frames, <-c.send)
+			}
+			if len(frames) == 0 {
+				t.Fatal("got no reply")
+			}
+			reply := frames[len(frames)-1]
+			if reply.msgType != tt.wantType {
+				t.Fatalf("got %s reply, want %s: %s", reply.msgType, tt.wantType, reply.payload)
+			}
+			if tt.wantCode != "" && !strings.Contains(string(reply.payload), `"code":"`+tt.wantCode+`"`) {
+				t.Errorf("got %s, want code %s", reply.payload, tt.wantCode)
+			}
+			replayed := []int64{}
+			for _, f := range frames[:len(frames)-1] {
+				replayed = append(replayed, f.seq)
+			}
+			if !slices.Equal(replayed, tt.want) {
+				t.Errorf("replayed %v, want %v", replayed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment line, so
+// proxies don't time it out
+const sseHeartbeat = 15 * time.Second
+
+// HandleEvents streams the hub's events as Server-Sent Events, for clients
+// that can't keep a websocket open. Each event's data is the same JSON
+// message websocket clients receive, its id is "<epoch>:<seq>".
+//
+// Query parameters: topics (comma separated, e.g. station:1,song:42) or
+// station=<id>; token=<jwt> (or a Bearer header) for the user's own events.
+// Reconnects resume from Last-Event-ID (or ?last_event_id=); when the server
+// no longer has every missed event, or the id is from another instance, it
+// sends snapshot_required instead.
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	topics := splitHeader(r.URL.Query().Get("topics"))
+	if station := r.URL.Query().Get("station"); station != "" {
+		stationID, err := strconv.Atoi(station)
+		if err != nil {
+			http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+			return
+		}
+		topics = append(topics, StationTopic(stationID))
+	}
+
+	var identity Identity
+	if token, _ := handshakeToken(r); token != "" {
+		var err error
+		if identity, err = identityFromToken(token); err != nil {
+			http.Error(w, "Invalid or expired token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+	} else if requireAuth {
+		http.Error(w, "Authorization required", http.StatusUnauthorized)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastEpoch string
+	var lastSeq int64
+	if lastEventID != "" {
+		var seq string
+		var found bool
+		lastEpoch, seq, found = strings.Cut(lastEventID, ":")
+		var err error
+		if lastSeq, err = strconv.ParseInt(seq, 10, 64); !found || err != nil || lastSeq <= 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	c := newClient(nil, ListenerFromRequest(r))
+	c.identity = identity
+	if err := c.subscribe(topics); err != nil {
+		code := http.StatusBadRequest
+		if cmdErr, ok := err.(*CommandError); ok && cmdErr.Code == ErrCodeForbidden {
+			code = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), code)
+		c.close()
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Tell nginx not to buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	openStream(c, lastEpoch, lastSeq)
+	defer func() {
+		mutex.Lock()
+		delete(clients, c)
+		mutex.Unlock()
+		c.close()
+	}()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case f := <-c.send:
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			err = writeEvent(w, f)
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-c.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+		metrics.sent.Add(1)
+	}
+}
+
+// openStream registers an event stream's client and queues its hello and,
+// when resuming, the events it missed. It holds the client list throughout,
+// so no live event is queued ahead of the replay and ids never go backwards;
+// an event being fanned out meanwhile may arrive again after the replay.
+func openStream(c *client, lastEpoch string, lastSeq int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	clients[c] = true
+
+	identity := c.user()
+	hello := Hello{Version: ProtocolVersion, Topics: c.subscriptions(), Epoch: epoch, LastSeq: LastSeq()}
+	if identity.UserID != 0 {
+		hello.User = &identity
+	}
+	c.reply(Message{Type: EventHello, Data: hello})
+
+	if lastSeq == 0 {
+		return
+	}
+	events, ok := replayEvents(lastEpoch, lastSeq, c.wants)
+	if !ok || len(events) > cap(c.send)-len(c.send)-1 {
+		c.reply(Message{Type: EventError, Data: NewCommandError(ErrCodeSnapshotRequired,
+			"Too many events were missed, refetch the current state")})
+		return
+	}
+	for _, e := range events {
+		c.enqueue(e.frame)
+	}
+}
+
+// writeEvent writes one frame in event-stream format. JSON has no raw
+// newlines, so the payload fits on a single data line.
+func writeEvent(w http.ResponseWriter, f *frame) error {
+	var b strings.Builder
+	if f.seq != 0 {
+		fmt.Fprintf(&b, "id: %s:%d\n", epoch, f.seq)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", f.msgType, f.payload)
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
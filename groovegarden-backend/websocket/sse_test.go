@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var startHub sync.Once
+
+// publishEvents sends n events for station:1 through the hub
+func publishEvents(n int) {
+	for i := 0; i < n; i++ {
+		broadcast <- Message{Type: EventQueueUpdated, Topic: StationTopic(1)}
+	}
+}
+
+func TestOpenStreamKeepsIDsInOrder(t *testing.T) {
+	resetHistory(t)
+	// Let the hub fan out in parallel with the stream opening, even on one CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	startHub.Do(func() { go HandleMessages() })
+
+	publishEvents(20)
+	for deadline := time.Now().Add(time.Second); LastSeq() == 0 || len(broadcast) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("hub did not number the events")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Resume while events keep being published, many times over to catch the
+	// stream between an event's numbering and its fan-out
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				// One at a time, so the stream's queue doesn't overflow
+				publishEvents(1)
+				for len(broadcast) > 0 {
+					runtime.Gosched()
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 2000; i++ {
+		c := newClient(nil, Listener{})
+		openStream(c, epoch, LastSeq()-10)
+		mutex.Lock()
+		delete(clients, c)
+		mutex.Unlock()
+
+		var last int64
+		for len(c.send) > 0 {
+			f := <-c.send
+			if f.seq == 0 {
+				// hello, or snapshot_required when the test fell too far behind
+				continue
+			}
+			if f.seq < last {
+				t.Fatalf("resume %d: id %d after %d", i, f.seq, last)
+			}
+			last = f.seq
+		}
+	}
+}
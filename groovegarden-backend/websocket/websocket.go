@@ -1,77 +1,256 @@
 package websocket
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// WebSocket upgrader
+// WebSocket upgrader, accepting browsers only from allowed origins
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin: CheckOrigin,
 }
 
-var clients = make(map[*websocket.Conn]bool)
-var broadcast = make(chan Message)
-var mutex sync.Mutex
+// Listener identifies who is behind a connection without storing their address
+type Listener struct {
+	Key     string // Hash of the client's address and user agent
+	Country string // ISO country code from the proxy's geo header, if any
+}
+
+// broadcastBuffer is how many events can wait to be fanned out before new ones are dropped
+const broadcastBuffer = 1024
 
-// Message struct to send data to clients
+var clients = make(map[*client]bool)
+var broadcast = make(chan Message, broadcastBuffer)
+var mutex sync.RWMutex
+
+// Message is a frame sent to clients (see the protocol in protocol.go)
 type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Version int         `json:"v"`
+	Seq     int64       `json:"seq,omitempty"` // Broadcast events only, increasing across all topics on one instance
+	Type    string      `json:"type"`
+	Topic   string      `json:"topic,omitempty"`
+	ID      string      `json:"id,omitempty"` // The command a reply answers
+	Data    interface{} `json:"data"`
 }
 
-// Function to handle new WebSocket connections
+// Function to handle new WebSocket connections.
+// Clients can pass ?station=<id> to start subscribed to that station, and
+// authenticate with a JWT in the handshake (see handshakeToken) or an auth
+// command to also receive messages meant for them.
 func HandleConnections(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
+	topics := []string{}
+	if station := r.URL.Query().Get("station"); station != "" {
+		stationID, err := strconv.Atoi(station)
+		if err != nil {
+			http.Error(w, "Invalid station ID format", http.StatusBadRequest)
+			return
+		}
+		topics = append(topics, StationTopic(stationID))
+	}
+
+	var identity Identity
+	var responseHeader http.Header
+	if token, subprotocol := handshakeToken(r); token != "" {
+		var err error
+		if identity, err = identityFromToken(token); err != nil {
+			http.Error(w, "Invalid or expired token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if subprotocol != "" {
+			responseHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+		}
+	}
+
+	ws, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		fmt.Println("Error upgrading to WebSocket:", err)
 		return
 	}
-	defer ws.Close()
 
+	c := newClient(ws, ListenerFromRequest(r))
+	c.identity = identity
+	c.subscribe(topics)
 	mutex.Lock()
-	clients[ws] = true
+	clients[c] = true
 	mutex.Unlock()
 
 	fmt.Println("New WebSocket connection established")
 
-	// Listen for messages (if needed)
-	for {
-		var msg Message
-		err := ws.ReadJSON(&msg)
-		if err != nil {
-			fmt.Println("Error reading JSON:", err)
-			mutex.Lock()
-			delete(clients, ws)
-			mutex.Unlock()
-			break
+	go c.writePump()
+	hello := Hello{Version: ProtocolVersion, Topics: c.subscriptions(), Epoch: epoch, LastSeq: LastSeq()}
+	if identity.UserID != 0 {
+		hello.User = &identity
+	}
+	c.reply(Message{Type: EventHello, Data: hello})
+	if identity.UserID == 0 && requireAuth {
+		time.AfterFunc(authTimeout, func() {
+			if c.user().UserID == 0 {
+				c.close()
+			}
+		})
+	}
+	err = c.readPump()
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+		fmt.Println("WebSocket connection closed:", err)
+	}
+
+	mutex.Lock()
+	delete(clients, c)
+	mutex.Unlock()
+	c.close()
+}
+
+// ListenerCount returns how many connections are subscribed to a topic
+func ListenerCount(topic string) int {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	count := 0
+	for c := range clients {
+		if c.subscribed(topic) {
+			count++
 		}
 	}
+	return count
+}
+
+// Audience returns who is behind the connections subscribed to a topic, one entry per listener
+func Audience(topic string) []Listener {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	audience := []Listener{}
+	for c := range clients {
+		if c.subscribed(topic) && !seen[c.listener.Key] {
+			seen[c.listener.Key] = true
+			audience = append(audience, c.listener)
+		}
+	}
+	return audience
+}
+
+// ListenerFromRequest identifies the listener behind a request. The address
+// comes from X-Forwarded-For when behind a proxy, the country from
+// CF-IPCountry or X-Country-Code when the proxy adds one.
+func ListenerFromRequest(r *http.Request) Listener {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		address = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	country := r.Header.Get("CF-IPCountry")
+	if country == "" {
+		country = r.Header.Get("X-Country-Code")
+	}
+	return Listener{
+		Key:     ListenerKey(address, r.UserAgent()),
+		Country: strings.ToUpper(country),
+	}
 }
 
-// Function to broadcast messages to all clients
+// ListenerKey hashes an address and user agent into an anonymous listener ID
+func ListenerKey(address, userAgent string) string {
+	sum := sha256.Sum256([]byte(address + "|" + userAgent))
+	return hex.EncodeToString(sum[:12])
+}
+
+// eventSeq numbers broadcast events in the order this instance receives them.
+// It starts from the clock, so sequence numbers from before a restart are
+// always older than new ones. Only HandleMessages touches it.
+var eventSeq = time.Now().UnixMicro()
+
+// HandleMessages numbers broadcast events and fans them out to the clients'
+// send queues. It encodes each event once and never waits on a client's
+// connection.
 func HandleMessages() {
-	for {
-		msg := <-broadcast
-		mutex.Lock()
-		for client := range clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				fmt.Println("Error broadcasting message:", err)
-				client.Close()
-				delete(clients, client)
+	for msg := range broadcast {
+		if msg.Topic == instanceTopic {
+			runInstanceCommand(msg)
+			continue
+		}
+
+		eventSeq++
+		msg.Seq = eventSeq
+
+		f, err := prepare(msg)
+		if err != nil {
+			log.Printf("Error preparing %s message: %v", msg.Type, err)
+			continue
+		}
+
+		remember(msg, f)
+
+		mutex.RLock()
+		for c := range clients {
+			if c.wants(msg.Topic) {
+				c.enqueue(f)
 			}
 		}
-		mutex.Unlock()
+		mutex.RUnlock()
+	}
+}
+
+// frame is a message encoded once for every client and transport it goes to
+type frame struct {
+	seq      int64
+	msgType  string
+	payload  []byte // JSON, as sent over Server-Sent Events
+	prepared *websocket.PreparedMessage
+}
+
+// prepare encodes a message for delivery
+func prepare(msg Message) (*frame, error) {
+	msg.Version = ProtocolVersion
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := websocket.NewPreparedMessage(websocket.TextMessage, payload)
+	if err != nil {
+		return nil, err
 	}
+	return &frame{seq: msg.Seq, msgType: msg.Type, payload: payload, prepared: prepared}, nil
 }
 
 // Function to notify clients of updates
 func NotifyClients(messageType string, data interface{}) {
-	broadcast <- Message{Type: messageType, Data: data}
+	publish(Message{Type: messageType, Data: data})
+}
+
+// NotifyTopic notifies the clients subscribed to a topic, plus those listening to everything
+func NotifyTopic(topic string, messageType string, data interface{}) {
+	publish(Message{Type: messageType, Topic: topic, Data: data})
+}
+
+// NotifyUser sends a message on the user's topic, which reaches every
+// connection they authenticated on
+func NotifyUser(userID int, messageType string, data interface{}) {
+	NotifyTopic(UserTopic(userID), messageType, data)
+}
+
+// publish sends an event through the bus, so clients on every instance get it
+func publish(msg Message) {
+	busMu.RLock()
+	b := bus
+	busMu.RUnlock()
+
+	if err := b.Publish(msg); err != nil {
+		metrics.broadcastDropped.Add(1)
+		log.Printf("Warning: could not publish %s message: %v", msg.Type, err)
+	}
 }